@@ -16,23 +16,31 @@ import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
 	"gorm.io/gorm"
 
 	"harmonista/analytics"
 	"harmonista/cache"
 	emailpkg "harmonista/email"
+	"harmonista/media"
 	"harmonista/models"
 )
 
 type AdminModule struct {
 	db        *gorm.DB
 	analytics *analytics.AnalyticsModule
+	storage   media.Storage
+
+	stopPurger chan struct{}
+	purgerDone chan struct{}
 }
 
-func NewAdminModule(db *gorm.DB, analyticsModule *analytics.AnalyticsModule) *AdminModule {
+func NewAdminModule(db *gorm.DB, analyticsModule *analytics.AnalyticsModule, mediaStorage media.Storage) *AdminModule {
 	return &AdminModule{
 		db:        db,
 		analytics: analyticsModule,
+		storage:   mediaStorage,
 	}
 }
 
@@ -66,6 +74,15 @@ func (a *AdminModule) RegisterRoutes(router *gin.Engine) {
 		adminGroup.POST("/page/:id", a.updatePage)
 		adminGroup.POST("/page/:id/autosave", a.autoSaveExistingPage)
 		adminGroup.DELETE("/page/:id", a.deletePage)
+		adminGroup.GET("/tags", a.listTags)
+		adminGroup.POST("/tags/:id", a.updateTag)
+		adminGroup.POST("/tags/:id/juntar", a.mergeTag)
+		adminGroup.DELETE("/tags/:id", a.deleteTag)
+		adminGroup.GET("/lixeira", a.trash)
+		adminGroup.POST("/lixeira/post/:id/restaurar", a.restorePost)
+		adminGroup.DELETE("/lixeira/post/:id", a.purgeTrashedPost)
+		adminGroup.POST("/lixeira/page/:id/restaurar", a.restorePage)
+		adminGroup.DELETE("/lixeira/page/:id", a.purgeTrashedPage)
 		adminGroup.GET("/tema", a.theme)
 		adminGroup.POST("/tema", a.saveTheme)
 		adminGroup.POST("/tema/aplicar", a.applyTheme)
@@ -74,6 +91,11 @@ func (a *AdminModule) RegisterRoutes(router *gin.Engine) {
 		adminGroup.GET("/config", a.config)
 		adminGroup.POST("/config", a.updateConfig)
 		adminGroup.GET("/visitas", a.analytics_page)
+		adminGroup.GET("/visitas/export", a.exportAnalytics)
+		adminGroup.GET("/visitas/agora", a.liveVisitors)
+		adminGroup.GET("/midia", a.listMedia)
+		adminGroup.POST("/midia", a.uploadMedia)
+		adminGroup.DELETE("/midia/:id", a.deleteMedia)
 	}
 
 	router.GET("/admin/dashboard", a.requireAuth, a.dashboard)
@@ -457,6 +479,7 @@ func (a *AdminModule) saveTheme(c *gin.Context) {
 		})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/tema")
 }
@@ -489,6 +512,7 @@ func (a *AdminModule) applyTheme(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar tema"})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tema aplicado com sucesso"})
 }
@@ -536,6 +560,7 @@ func (a *AdminModule) updateMenu(c *gin.Context) {
 		})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/menu")
 }
@@ -574,6 +599,13 @@ func (a *AdminModule) updateConfig(c *gin.Context) {
 	password := c.PostForm("password")
 	isAdult := c.PostForm("isAdult") == "1"
 	isListReader := c.PostForm("IsListReader") == "1"
+	markdownFootnotes := c.PostForm("markdownFootnotes") == "1"
+	markdownHeadingAnchors := c.PostForm("markdownHeadingAnchors") == "1"
+	markdownDefinitionLists := c.PostForm("markdownDefinitionLists") == "1"
+	markdownTypographer := c.PostForm("markdownTypographer") == "1"
+	markdownTOC := c.PostForm("markdownTOC") == "1"
+	readingStats := c.PostForm("readingStats") == "1"
+	publicStats := c.PostForm("publicStats") == "1"
 
 	// Validate subdomain change if different
 	if newSubdomain != blog.Subdomain {
@@ -592,6 +624,15 @@ func (a *AdminModule) updateConfig(c *gin.Context) {
 	blog.IsAdult = isAdult
 	blog.IsListReader = isListReader
 
+	blog.MarkdownFootnotes = markdownFootnotes
+	blog.MarkdownHeadingAnchors = markdownHeadingAnchors
+	blog.MarkdownDefinitionLists = markdownDefinitionLists
+	blog.MarkdownTypographer = markdownTypographer
+	blog.MarkdownTOC = markdownTOC
+
+	blog.ReadingStats = readingStats
+	blog.PublicStats = publicStats
+
 	if err := a.db.Save(blog).Error; err != nil {
 		c.HTML(http.StatusInternalServerError, "admin_config.html", gin.H{
 			"error": "Erro ao salvar configurações",
@@ -600,6 +641,10 @@ func (a *AdminModule) updateConfig(c *gin.Context) {
 		return
 	}
 
+	// Menu, Markdown e o script de leitura mudam o HTML de todas as páginas;
+	// com outro subdomínio, as páginas antigas também saem do cache
+	cache.BlogChanged(blog.ID)
+
 	// Update password if provided
 	if password != "" {
 		var user models.User
@@ -672,6 +717,7 @@ func (a *AdminModule) updateBlogSettings(c *gin.Context) {
 		})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/")
 }
@@ -738,7 +784,14 @@ func (a *AdminModule) savePost(c *gin.Context) {
 	action := c.PostForm("action")
 	replyToIDStr := c.PostForm("reply_to_id")
 
-	slug := generateSlug(title)
+	slug, err := a.slugFor(models.SlugKindPost, blog.ID, c.PostForm("slug"), title, 0)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": err.Error(),
+			"blog":  blog,
+		})
+		return
+	}
 	draft := action == "save_draft"
 
 	post := models.Post{
@@ -759,7 +812,13 @@ func (a *AdminModule) savePost(c *gin.Context) {
 		}
 	}
 
-	if err := a.db.Create(&post).Error; err != nil {
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return changeSlug(tx, models.SlugKindPost, blog.ID, post.ID, "", post.Slug, false)
+	})
+	if err != nil {
 		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
 			"error": "Erro ao criar post",
 			"blog":  blog,
@@ -767,14 +826,8 @@ func (a *AdminModule) savePost(c *gin.Context) {
 		return
 	}
 
-	// Se for uma resposta, limpar cache do post pai
-	if replyToIDStr != "" {
-		if replyToID, err := strconv.Atoi(replyToIDStr); err == nil {
-			if err := cache.ClearCacheByPostID(a.db, replyToID); err != nil {
-				log.Printf("Erro ao limpar cache do post %d: %v", replyToID, err)
-			}
-		}
-	}
+	// Atualiza o índice, as tags, o /leia e as respostas do post pai
+	defer cache.PostChanged(&post)
 
 	if tags != "" {
 		if err := a.processPostTags(blog.ID, int(post.ID), tags); err != nil {
@@ -846,9 +899,9 @@ func (a *AdminModule) autoSaveExistingPost(c *gin.Context) {
 		"updated_at": time.Now(),
 	}
 
+	// O slug só muda pelo formulário, onde o autor vê o endereço
 	if request.Title != "" {
 		updates["title"] = request.Title
-		updates["slug"] = generateSlug(request.Title)
 	}
 
 	if err := a.db.Model(&post).Updates(updates).Error; err != nil {
@@ -904,13 +957,14 @@ func (a *AdminModule) editPost(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "admin_edit_post.html", gin.H{
-		"subdomain":   subdomain,
-		"post":        post,
-		"blog":        blog,
-		"tags":        tags,
-		"visitCount":  visitCount,
-		"replyTo":     replyToPost,
-		"replyToBlog": replyToBlog,
+		"subdomain":     subdomain,
+		"post":          post,
+		"blog":          blog,
+		"tags":          tags,
+		"visitCount":    visitCount,
+		"replyTo":       replyToPost,
+		"replyToBlog":   replyToBlog,
+		"retentionDays": trashRetentionDays,
 	})
 }
 
@@ -934,6 +988,20 @@ func (a *AdminModule) updatePost(c *gin.Context) {
 	tags := c.PostForm("tags")
 	action := c.PostForm("action")
 
+	// Sem o campo slug no formulário, o endereço fica como está
+	oldSlug, wasPublished := post.Slug, !post.Draft
+	if requested, ok := c.GetPostForm("slug"); ok {
+		slug, err := a.slugFor(models.SlugKindPost, blog.ID, requested, title, post.ID)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+				"error": err.Error(),
+				"blog":  blog,
+			})
+			return
+		}
+		post.Slug = slug
+	}
+
 	post.Title = title
 	post.Content = content
 	post.UpdatedAt = time.Now()
@@ -946,7 +1014,13 @@ func (a *AdminModule) updatePost(c *gin.Context) {
 	case "save", "update":
 	}
 
-	if err := a.db.Save(&post).Error; err != nil {
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&post).Error; err != nil {
+			return err
+		}
+		return changeSlug(tx, models.SlugKindPost, blog.ID, post.ID, oldSlug, post.Slug, wasPublished)
+	})
+	if err != nil {
 		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
 			"error": "Erro ao atualizar post",
 			"blog":  blog,
@@ -954,17 +1028,8 @@ func (a *AdminModule) updatePost(c *gin.Context) {
 		return
 	}
 
-	// Limpar cache do próprio post
-	if err := cache.ClearCache(blog.Subdomain, post.Slug); err != nil {
-		log.Printf("Erro ao limpar cache do post %d: %v", post.ID, err)
-	}
-
-	// Se for uma resposta, limpar cache do post pai também
-	if post.ReplyPostID != nil {
-		if err := cache.ClearCacheByPostID(a.db, *post.ReplyPostID); err != nil {
-			log.Printf("Erro ao limpar cache do post pai %d: %v", *post.ReplyPostID, err)
-		}
-	}
+	// Atualiza o post, o índice, as tags, o /leia e as respostas do post pai
+	defer cache.PostChanged(&post)
 
 	if tags != "" {
 		if err := a.processPostTags(blog.ID, int(post.ID), tags); err != nil {
@@ -997,6 +1062,7 @@ func (a *AdminModule) deletePost(c *gin.Context) {
 		return
 	}
 
+	// Vai para a lixeira; tags e redirecionamentos ficam para a restauração
 	result := a.db.Where("id = ? AND blog_id = ?", postIDInt, blog.ID).Delete(&models.Post{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao deletar post"})
@@ -1007,8 +1073,9 @@ func (a *AdminModule) deletePost(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post não encontrado"})
 		return
 	}
+	cache.PostChanged(&post)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Post deletado com sucesso"})
+	c.JSON(http.StatusOK, gin.H{"message": "Post movido para a lixeira"})
 }
 
 func (a *AdminModule) listPages(c *gin.Context) {
@@ -1051,7 +1118,14 @@ func (a *AdminModule) savePage(c *gin.Context) {
 	content := c.PostForm("content")
 	action := c.PostForm("action")
 
-	slug := generateSlug(title)
+	slug, err := a.slugFor(models.SlugKindPage, blog.ID, c.PostForm("slug"), title, 0)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": err.Error(),
+			"blog":  blog,
+		})
+		return
+	}
 	draft := action == "save_draft"
 
 	page := models.Page{
@@ -1064,13 +1138,20 @@ func (a *AdminModule) savePage(c *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	if err := a.db.Create(&page).Error; err != nil {
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&page).Error; err != nil {
+			return err
+		}
+		return changeSlug(tx, models.SlugKindPage, blog.ID, page.ID, "", page.Slug, false)
+	})
+	if err != nil {
 		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
 			"error": "Erro ao criar página",
 			"blog":  blog,
 		})
 		return
 	}
+	cache.PageChanged(&page)
 
 	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/pages")
 }
@@ -1129,9 +1210,9 @@ func (a *AdminModule) autoSaveExistingPage(c *gin.Context) {
 		"updated_at": time.Now(),
 	}
 
+	// O slug só muda pelo formulário, onde o autor vê o endereço
 	if request.Title != "" {
 		updates["title"] = request.Title
-		updates["slug"] = generateSlug(request.Title)
 	}
 
 	if err := a.db.Model(&page).Updates(updates).Error; err != nil {
@@ -1162,9 +1243,10 @@ func (a *AdminModule) editPage(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "admin_edit_page.html", gin.H{
-		"subdomain": subdomain,
-		"page":      page,
-		"blog":      blog,
+		"subdomain":     subdomain,
+		"page":          page,
+		"blog":          blog,
+		"retentionDays": trashRetentionDays,
 	})
 }
 
@@ -1187,6 +1269,20 @@ func (a *AdminModule) updatePage(c *gin.Context) {
 	content := c.PostForm("content")
 	action := c.PostForm("action")
 
+	// Sem o campo slug no formulário, o endereço fica como está
+	oldSlug, wasPublished := page.Slug, !page.Draft
+	if requested, ok := c.GetPostForm("slug"); ok {
+		slug, err := a.slugFor(models.SlugKindPage, blog.ID, requested, title, page.ID)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+				"error": err.Error(),
+				"blog":  blog,
+			})
+			return
+		}
+		page.Slug = slug
+	}
+
 	page.Title = title
 	page.Content = content
 	page.UpdatedAt = time.Now()
@@ -1199,13 +1295,20 @@ func (a *AdminModule) updatePage(c *gin.Context) {
 	case "save", "update":
 	}
 
-	if err := a.db.Save(&page).Error; err != nil {
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&page).Error; err != nil {
+			return err
+		}
+		return changeSlug(tx, models.SlugKindPage, blog.ID, page.ID, oldSlug, page.Slug, wasPublished)
+	})
+	if err != nil {
 		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
 			"error": "Erro ao atualizar página",
 			"blog":  blog,
 		})
 		return
 	}
+	cache.PageChanged(&page)
 
 	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/pages")
 }
@@ -1228,6 +1331,7 @@ func (a *AdminModule) deletePage(c *gin.Context) {
 		return
 	}
 
+	// Vai para a lixeira; os redirecionamentos ficam para a restauração
 	result := a.db.Where("id = ? AND blog_id = ?", pageIDInt, blog.ID).Delete(&models.Page{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao deletar página"})
@@ -1238,8 +1342,9 @@ func (a *AdminModule) deletePage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Página não encontrada"})
 		return
 	}
+	cache.PageChanged(&page)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Página deletada com sucesso"})
+	c.JSON(http.StatusOK, gin.H{"message": "Página movida para a lixeira"})
 }
 
 func (a *AdminModule) getPostTags(postID int) string {
@@ -1282,37 +1387,7 @@ func (a *AdminModule) processPostTags(blogID int, postID int, tagsString string)
 
 	tagNames := strings.Split(tagsString, ",")
 	for _, tagName := range tagNames {
-		tagName = strings.TrimSpace(tagName)
-		if tagName == "" {
-			continue
-		}
-		strings.ToLower(tagName)
-		var tag models.Tag
-		err := a.db.Where("title = ?", tagName).First(&tag).Error
-
-		if err == gorm.ErrRecordNotFound {
-			tag = models.Tag{
-				Title: tagName,
-			}
-			if err := a.db.Create(&tag).Error; err != nil {
-				return err
-			}
-		} else if err != nil {
-			return err
-		}
-
-		var existingPostTag models.PostTag
-		err = a.db.Where("post_id = ? AND tag_id = ?", postID, tag.ID).First(&existingPostTag).Error
-
-		if err == gorm.ErrRecordNotFound {
-			postTag := models.PostTag{
-				PostID: postID,
-				TagID:  int(tag.ID),
-			}
-			if err := a.db.Create(&postTag).Error; err != nil {
-				return err
-			}
-		} else if err != nil {
+		if err := a.createOrAssignTag(blogID, postID, tagName); err != nil {
 			return err
 		}
 	}
@@ -1320,17 +1395,28 @@ func (a *AdminModule) processPostTags(blogID int, postID int, tagsString string)
 	return nil
 }
 
+// createOrAssignTag liga o post à tag do blog com esse nome, sem diferenciar
+// maiúsculas, criando a tag se ainda não existir
 func (a *AdminModule) createOrAssignTag(blogID int, postID int, tagTitle string) error {
+	tagTitle = strings.Join(strings.Fields(tagTitle), " ")
+	if tagTitle == "" {
+		return nil
+	}
+
 	var tag models.Tag
-	err := a.db.Where("title = ?", tagTitle).First(&tag).Error
+	err := a.db.Where("blog_id = ? AND name = ?", blogID, models.NormalizeTagName(tagTitle)).First(&tag).Error
 
 	if err == gorm.ErrRecordNotFound {
 		tag = models.Tag{
-			Title: tagTitle,
+			BlogID: blogID,
+			Title:  tagTitle,
+			Name:   models.NormalizeTagName(tagTitle),
 		}
 		if err := a.db.Create(&tag).Error; err != nil {
 			return err
 		}
+	} else if err != nil {
+		return err
 	}
 
 	var existingPostTag models.PostTag
@@ -1344,6 +1430,8 @@ func (a *AdminModule) createOrAssignTag(blogID int, postID int, tagTitle string)
 		if err := a.db.Create(&postTag).Error; err != nil {
 			return err
 		}
+	} else if err != nil {
+		return err
 	}
 
 	return nil
@@ -1435,9 +1523,12 @@ func checkPasswordHash(password, hash string) bool {
 
 // Structs para dados do analytics com porcentagens calculadas
 type DayVisitChart struct {
-	Date       string
-	Count      int64
-	Percentage float64
+	Date               string // primeiro dia do período (dia, semana ou mês)
+	Label              string
+	Count              int64
+	Visitors           int64
+	Percentage         float64
+	VisitorsPercentage float64
 }
 
 type PostVisitChart struct {
@@ -1445,6 +1536,157 @@ type PostVisitChart struct {
 	PostTitle  string
 	Count      int64
 	Percentage float64
+	Change     VisitChange
+}
+
+// VisitChange compara um número com o do período anterior
+type VisitChange struct {
+	Current  int64
+	Previous int64
+	Percent  float64 // variação em %; sem valor anterior fica 0
+	HasBase  bool    // false quando o período anterior não teve visitas
+	Up       bool
+	Down     bool
+}
+
+func compareVisits(current, previous int64) VisitChange {
+	change := VisitChange{
+		Current:  current,
+		Previous: previous,
+		HasBase:  previous > 0,
+		Up:       current > previous,
+		Down:     current < previous,
+	}
+	if previous > 0 {
+		change.Percent = float64(current-previous) / float64(previous) * 100
+	}
+	return change
+}
+
+// analyticsRangeOptions são os períodos prontos do seletor, em dias
+var analyticsRangeOptions = []struct {
+	Key   string
+	Label string
+}{
+	{"7", "Últimos 7 dias"},
+	{"30", "Últimos 30 dias"},
+	{"90", "Últimos 90 dias"},
+	{"365", "Últimos 12 meses"},
+	{"custom", "Personalizado"},
+}
+
+// maxAnalyticsRangeDays limita períodos personalizados
+const maxAnalyticsRangeDays = 3 * 366
+
+var bucketLabels = map[string]string{
+	analytics.BucketDay:   "dia",
+	analytics.BucketWeek:  "semana",
+	analytics.BucketMonth: "mês",
+}
+
+// analyticsRange lê o período do painel e da exportação: range=7|30|90|365
+// ou range=custom com from e to (AAAA-MM-DD). Só from/to, sem range,
+// também conta como personalizado.
+func analyticsRange(c *gin.Context, now time.Time) (analytics.TimeRange, string, error) {
+	key := c.Query("range")
+	if key == "" {
+		key = "30"
+		if c.Query("from") != "" || c.Query("to") != "" {
+			key = "custom"
+		}
+	}
+
+	if key != "custom" {
+		days, err := strconv.Atoi(key)
+		if err != nil || (days != 7 && days != 30 && days != 90 && days != 365) {
+			return analytics.TimeRange{}, "", fmt.Errorf("escolha 7, 30, 90 ou 365 dias")
+		}
+		return analytics.LastDays(days, now), key, nil
+	}
+
+	today := now.Format("2006-01-02")
+	from := c.DefaultQuery("from", analytics.LastDays(30, now).FromKey())
+	to := c.DefaultQuery("to", today)
+	period, err := analytics.NewTimeRange(from, to)
+	if err != nil {
+		return analytics.TimeRange{}, "", err
+	}
+	if period.Days() > maxAnalyticsRangeDays {
+		return analytics.TimeRange{}, "", fmt.Errorf("o período máximo é de 3 anos")
+	}
+	return period, key, nil
+}
+
+type DimensionVisitChart struct {
+	Label      string
+	Count      int64
+	Percentage float64
+}
+
+// dimensionCharts converte visitas por navegador, idioma etc. em barras
+// proporcionais ao valor mais visitado
+func dimensionCharts(items []analytics.DimensionVisits, emptyLabel string) []DimensionVisitChart {
+	maxCount := int64(1)
+	for _, item := range items {
+		if item.Count > maxCount {
+			maxCount = item.Count
+		}
+	}
+
+	charts := make([]DimensionVisitChart, len(items))
+	for i, item := range items {
+		label := item.Value
+		if label == "" {
+			label = emptyLabel
+		}
+		charts[i] = DimensionVisitChart{
+			Label:      label,
+			Count:      item.Count,
+			Percentage: (float64(item.Count) / float64(maxCount)) * 100,
+		}
+	}
+	return charts
+}
+
+// referrerTypeLabels traduz os tipos de origem para o painel
+var referrerTypeLabels = map[string]string{
+	analytics.ReferrerSearch:   "Buscadores",
+	analytics.ReferrerSocial:   "Redes sociais",
+	analytics.ReferrerDirect:   "Acesso direto",
+	analytics.ReferrerInternal: "Harmonista",
+	analytics.ReferrerOther:    "Outros sites",
+}
+
+// PostReadingRow é uma linha da tabela de leitura dos posts
+type PostReadingRow struct {
+	PostTitle      string
+	Reads          int64
+	CompletionRate float64
+	MedianTime     string
+}
+
+// formatReadTime formata segundos como "45s" ou "3min 20s"
+func formatReadTime(seconds int) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	if seconds%60 == 0 {
+		return fmt.Sprintf("%dmin", seconds/60)
+	}
+	return fmt.Sprintf("%dmin %ds", seconds/60, seconds%60)
+}
+
+// countryNames troca os códigos ISO do GeoIP pelo nome do país em português
+func countryNames(charts []DimensionVisitChart) []DimensionVisitChart {
+	namer := display.Regions(language.BrazilianPortuguese)
+	for i := range charts {
+		if region, err := language.ParseRegion(charts[i].Label); err == nil {
+			if name := namer.Name(region); name != "" {
+				charts[i].Label = name
+			}
+		}
+	}
+	return charts
 }
 
 func (a *AdminModule) analytics_page(c *gin.Context) {
@@ -1468,11 +1710,29 @@ func (a *AdminModule) analytics_page(c *gin.Context) {
 		return
 	}
 
-	// Buscar visitas por dia dos últimos 30 dias
-	visitsByDay := a.analytics.GetVisitsByDay(blog.ID, 15)
+	// Período escolhido (padrão: últimos 30 dias) e o anterior, para comparar
+	period, rangeKey, err := analyticsRange(c, time.Now())
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": "Período inválido: " + err.Error(),
+		})
+		return
+	}
+	previous := period.Previous()
+	bucket := analytics.BucketFor(period)
+
+	totals := a.analytics.GetTotals(blog.ID, period)
+	previousTotals := a.analytics.GetTotals(blog.ID, previous)
 
-	// Buscar top 10 posts dos últimos 30 dias
-	topPosts := a.analytics.GetTopPosts(blog.ID, 30, 10)
+	// Visitas por dia, semana ou mês, conforme o tamanho do período
+	visitsByPeriod := a.analytics.GetVisitSeries(blog.ID, period, bucket)
+
+	// Top 10 posts do período, com a variação em relação ao período anterior
+	topPosts := a.analytics.GetTopPosts(blog.ID, period, 10)
+	previousPosts := map[int]int64{}
+	for _, post := range a.analytics.GetTopPosts(blog.ID, previous, 0) {
+		previousPosts[post.PostID] = post.Count
+	}
 
 	// Buscar títulos dos posts
 	for i := range topPosts {
@@ -1486,7 +1746,7 @@ func (a *AdminModule) analytics_page(c *gin.Context) {
 
 	// Calcular valor máximo para normalização dos gráficos
 	maxVisitsPerDay := int64(1)
-	for _, day := range visitsByDay {
+	for _, day := range visitsByPeriod {
 		if day.Count > maxVisitsPerDay {
 			maxVisitsPerDay = day.Count
 		}
@@ -1500,16 +1760,15 @@ func (a *AdminModule) analytics_page(c *gin.Context) {
 	}
 
 	// Converter para structs com porcentagens calculadas
-	dayCharts := make([]DayVisitChart, len(visitsByDay))
-	for i, day := range visitsByDay {
-		percentage := 0.0
-		if maxVisitsPerDay > 0 {
-			percentage = (float64(day.Count) / float64(maxVisitsPerDay)) * 100
-		}
+	dayCharts := make([]DayVisitChart, len(visitsByPeriod))
+	for i, day := range visitsByPeriod {
 		dayCharts[i] = DayVisitChart{
-			Date:       day.Date,
-			Count:      day.Count,
-			Percentage: percentage,
+			Date:               day.Date,
+			Label:              day.Label,
+			Count:              day.Count,
+			Visitors:           day.Visitors,
+			Percentage:         (float64(day.Count) / float64(maxVisitsPerDay)) * 100,
+			VisitorsPercentage: (float64(day.Visitors) / float64(maxVisitsPerDay)) * 100,
 		}
 	}
 
@@ -1524,6 +1783,30 @@ func (a *AdminModule) analytics_page(c *gin.Context) {
 			PostTitle:  post.PostTitle,
 			Count:      post.Count,
 			Percentage: percentage,
+			Change:     compareVisits(post.Count, previousPosts[post.PostID]),
+		}
+	}
+
+	// Leitura medida pelo beacon (só para blogs com a opção ligada)
+	var readingRows []PostReadingRow
+	for _, reading := range a.analytics.GetReadingStats(blog.ID, period, 10) {
+		title := "Post não encontrado"
+		var post models.Post
+		if err := a.db.Select("title").First(&post, reading.PostID).Error; err == nil {
+			title = post.Title
+		}
+		readingRows = append(readingRows, PostReadingRow{
+			PostTitle:      title,
+			Reads:          reading.Reads,
+			CompletionRate: reading.CompletionRate,
+			MedianTime:     formatReadTime(reading.MedianSeconds),
+		})
+	}
+
+	referrerTypeCharts := dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionReferrerType, period, 10), "Desconhecido")
+	for i := range referrerTypeCharts {
+		if label, ok := referrerTypeLabels[referrerTypeCharts[i].Label]; ok {
+			referrerTypeCharts[i].Label = label
 		}
 	}
 
@@ -1531,7 +1814,23 @@ func (a *AdminModule) analytics_page(c *gin.Context) {
 		"subdomain":        subdomain,
 		"blog":             blog,
 		"analyticsEnabled": true,
+		"rangeKey":         rangeKey,
+		"rangeOptions":     analyticsRangeOptions,
+		"from":             period.FromKey(),
+		"to":               period.ToKey(),
+		"bucketLabel":      bucketLabels[bucket],
+		"visits":           compareVisits(totals.Visits, previousTotals.Visits),
+		"visitors":         compareVisits(totals.Visitors, previousTotals.Visitors),
+		"previousFrom":     previous.From,
+		"previousTo":       previous.To,
 		"visitsByDay":      dayCharts,
 		"topPosts":         postCharts,
+		"topBrowsers":      dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionBrowser, period, 10), "Desconhecido"),
+		"topLanguages":     dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionLanguage, period, 10), "Desconhecido"),
+		"topCountries":     countryNames(dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionCountry, period, 10), "Desconhecido")),
+		"referrerTypes":    referrerTypeCharts,
+		"topReferrers":     dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionReferrer, period, 10), "Desconhecido"),
+		"topCampaigns":     dimensionCharts(a.analytics.GetTopValues(blog.ID, analytics.DimensionCampaign, period, 10), "Desconhecido"),
+		"reading":          readingRows,
 	})
 }
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,19 +11,18 @@ import (
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"harmonista/database"
+	"harmonista/database/dbtest"
 	"harmonista/models"
 )
 
-func setupTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := dbtest.Open(t)
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatal(err)
 	}
-
-	db.AutoMigrate(&models.User{}, &models.Blog{}, &models.Post{}, &models.Tag{}, &models.PostTag{})
 	return db
 }
 
@@ -56,10 +56,18 @@ func createTestBlog(db *gorm.DB, userID int) *models.Blog {
 }
 
 func createTestPost(db *gorm.DB, blogID int) *models.Post {
+	// Slugs são únicos por blog: os posts seguintes ganham -2, -3...
+	slug := "test-post"
+	var count int64
+	db.Model(&models.Post{}).Where("blog_id = ?", blogID).Count(&count)
+	if count > 0 {
+		slug = fmt.Sprintf("test-post-%d", count+1)
+	}
+
 	post := &models.Post{
 		BlogID:    blogID,
 		Title:     "Test Post",
-		Slug:      "test-post",
+		Slug:      slug,
 		Content:   "Test content",
 		Draft:     true,
 		CreatedAt: time.Now(),
@@ -105,8 +113,8 @@ func TestGenerateSlug(t *testing.T) {
 }
 
 func TestRequireAuth_Unauthorized(t *testing.T) {
-	db := setupTestDB()
-	adminModule := NewAdminModule(db)
+	db := setupTestDB(t)
+	adminModule := NewAdminModule(db, nil, nil)
 	router := setupTestRouter(adminModule)
 
 	req, _ := http.NewRequest("GET", "/admin/testblog/", nil)
@@ -119,8 +127,8 @@ func TestRequireAuth_Unauthorized(t *testing.T) {
 }
 
 func TestIndex_BlogNotFound(t *testing.T) {
-	db := setupTestDB()
-	adminModule := NewAdminModule(db)
+	db := setupTestDB(t)
+	adminModule := NewAdminModule(db, nil, nil)
 	router := setupTestRouter(adminModule)
 
 	createTestUser(db)
@@ -134,7 +142,7 @@ func TestIndex_BlogNotFound(t *testing.T) {
 }
 
 func TestUpdateBlogSettings(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -152,7 +160,7 @@ func TestUpdateBlogSettings(t *testing.T) {
 }
 
 func TestListPosts(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -166,7 +174,7 @@ func TestListPosts(t *testing.T) {
 }
 
 func TestSavePost(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -190,7 +198,7 @@ func TestSavePost(t *testing.T) {
 }
 
 func TestUpdatePost(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -208,7 +216,7 @@ func TestUpdatePost(t *testing.T) {
 }
 
 func TestDeletePost(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -222,8 +230,8 @@ func TestDeletePost(t *testing.T) {
 }
 
 func TestCreateOrAssignTag(t *testing.T) {
-	db := setupTestDB()
-	adminModule := NewAdminModule(db)
+	db := setupTestDB(t)
+	adminModule := NewAdminModule(db, nil, nil)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -272,8 +280,8 @@ func TestGenerateToken(t *testing.T) {
 }
 
 func TestProcessPostTags(t *testing.T) {
-	db := setupTestDB()
-	adminModule := NewAdminModule(db)
+	db := setupTestDB(t)
+	adminModule := NewAdminModule(db, nil, nil)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
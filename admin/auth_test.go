@@ -14,8 +14,8 @@ import (
 )
 
 func TestAdminRoot_NotLoggedIn(t *testing.T) {
-	db := setupTestDB()
-	adminModule := NewAdminModule(db)
+	db := setupTestDB(t)
+	adminModule := NewAdminModule(db, nil, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -32,7 +32,7 @@ func TestAdminRoot_NotLoggedIn(t *testing.T) {
 }
 
 func TestUserCreation(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 	user := createTestUser(db)
 
 	assert.NotNil(t, user)
@@ -40,7 +40,7 @@ func TestUserCreation(t *testing.T) {
 }
 
 func TestCadastroValidation(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := &models.User{
 		Email:        "test@test.com",
@@ -56,7 +56,7 @@ func TestCadastroValidation(t *testing.T) {
 }
 
 func TestCadastroPost_Success(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	passwordHash, _ := hashPassword("password123")
 	user := models.User{
@@ -84,7 +84,7 @@ func TestCadastroPost_Success(t *testing.T) {
 }
 
 func TestCadastroPost_DuplicateEmail(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 
@@ -96,7 +96,7 @@ func TestCadastroPost_DuplicateEmail(t *testing.T) {
 }
 
 func TestCadastroPost_DuplicateSubdomain(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -122,7 +122,7 @@ func TestPasswordHashing(t *testing.T) {
 }
 
 func TestDashboard(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 
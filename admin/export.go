@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/analytics"
+	"harmonista/models"
+)
+
+// exportDimensions são as dimensões incluídas na exportação de visitas
+var exportDimensions = []string{
+	analytics.DimensionTotal,
+	analytics.DimensionPost,
+	analytics.DimensionBrowser,
+	analytics.DimensionLanguage,
+}
+
+// exportRecord é o formato de cada linha do JSON exportado
+type exportRecord struct {
+	Day       string `json:"day"`
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+	Title     string `json:"title,omitempty"` // título do post, na dimensão "post"
+	Visits    int64  `json:"visits"`
+	Visitors  int64  `json:"visitors"`
+}
+
+// exportAnalytics envia as visitas diárias, por post, navegador e idioma
+// como CSV ou JSON. As linhas são escritas conforme são lidas do banco.
+func (a *AdminModule) exportAnalytics(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	if a.analytics == nil {
+		c.HTML(http.StatusNotFound, "admin_error.html", gin.H{
+			"error": "Analytics não está configurado",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": "Formato inválido, use csv ou json",
+		})
+		return
+	}
+
+	period, _, err := analyticsRange(c, time.Now())
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": "Período inválido: " + err.Error(),
+		})
+		return
+	}
+
+	// Títulos dos posts para a dimensão "post"
+	var posts []models.Post
+	a.db.Select("id, title").Where("blog_id = ?", blog.ID).Find(&posts)
+	titles := make(map[string]string, len(posts))
+	for _, post := range posts {
+		titles[strconv.Itoa(int(post.ID))] = post.Title
+	}
+	record := func(row analytics.ExportRow) exportRecord {
+		rec := exportRecord{
+			Day:       row.Day,
+			Dimension: row.Dimension,
+			Value:     row.Value,
+			Visits:    row.Visits,
+			Visitors:  row.Visitors,
+		}
+		if row.Dimension == analytics.DimensionPost {
+			rec.Title = titles[row.Value]
+		}
+		return rec
+	}
+
+	filename := fmt.Sprintf("harmonista-%s-%s-%s.%s", blog.Subdomain, period.FromKey(), period.ToKey(), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"day", "dimension", "value", "title", "visits", "visitors"})
+		err = a.analytics.ExportDaily(blog.ID, period, exportDimensions, func(row analytics.ExportRow) error {
+			rec := record(row)
+			return w.Write([]string{
+				rec.Day, rec.Dimension, rec.Value, rec.Title,
+				strconv.FormatInt(rec.Visits, 10), strconv.FormatInt(rec.Visitors, 10),
+			})
+		})
+		w.Flush()
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		encoder := json.NewEncoder(c.Writer)
+		first := true
+		c.Writer.WriteString("[\n")
+		err = a.analytics.ExportDaily(blog.ID, period, exportDimensions, func(row analytics.ExportRow) error {
+			if !first {
+				c.Writer.WriteString(",")
+			}
+			first = false
+			return encoder.Encode(record(row))
+		})
+		c.Writer.WriteString("]\n")
+	}
+
+	// Os cabeçalhos já foram enviados; só resta registrar o erro
+	if err != nil {
+		log.Printf("Erro ao exportar visitas do blog %s: %v", blog.Subdomain, err)
+	}
+}
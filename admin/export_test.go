@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/analytics"
+	"harmonista/database/dbtest"
+)
+
+func TestExportAnalytics(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID)
+
+	analyticsDB := dbtest.Open(t)
+	analyticsModule := analytics.NewAnalyticsModule(analyticsDB)
+	defer analyticsModule.Close()
+
+	postID := strconv.Itoa(int(post.ID))
+	analyticsDB.Create(&[]analytics.DailyRollup{
+		{BlogID: blog.ID, Day: "2025-03-01", Dimension: analytics.DimensionTotal, Visits: 7, Visitors: 5},
+		{BlogID: blog.ID, Day: "2025-03-01", Dimension: analytics.DimensionPost, Value: postID, Visits: 4, Visitors: 3},
+		{BlogID: blog.ID, Day: "2025-03-02", Dimension: analytics.DimensionBrowser, Value: "Firefox", Visits: 2, Visitors: 2},
+		{BlogID: blog.ID, Day: "2025-03-05", Dimension: analytics.DimensionTotal, Visits: 1, Visitors: 1}, // fora do período
+		{BlogID: blog.ID + 1, Day: "2025-03-01", Dimension: analytics.DimensionTotal, Visits: 9, Visitors: 9},
+	})
+
+	a := &AdminModule{db: db, analytics: analyticsModule}
+	export := func(query string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/admin/testblog/visitas/export?"+query, nil)
+		c.Set("blog", blog)
+		a.exportAnalytics(c)
+		return w
+	}
+
+	w := export("format=csv&from=2025-03-01&to=2025-03-02")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "harmonista-testblog-2025-03-01-2025-03-02.csv")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, []string{
+		"day,dimension,value,title,visits,visitors",
+		"2025-03-01,post," + postID + ",Test Post,4,3",
+		"2025-03-01,total,,,7,5",
+		"2025-03-02,browser,Firefox,,2,2",
+	}, lines)
+
+	w = export("format=json&from=2025-03-01&to=2025-03-01")
+	var rows []map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "Test Post", rows[0]["title"])
+	assert.Equal(t, float64(7), rows[1]["visits"])
+
+	w = export("format=json&from=2025-03-09&to=2025-03-09")
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func TestAnalyticsRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2025, 3, 15, 10, 0, 0, 0, time.Local)
+	rangeFor := func(query string) (analytics.TimeRange, string, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+		return analyticsRange(c, now)
+	}
+
+	period, key, err := rangeFor("")
+	assert.NoError(t, err)
+	assert.Equal(t, "30", key)
+	assert.Equal(t, "2025-02-14", period.FromKey())
+	assert.Equal(t, "2025-03-15", period.ToKey())
+
+	period, key, err = rangeFor("range=7")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", key)
+	assert.Equal(t, 7, period.Days())
+
+	period, key, err = rangeFor("from=2025-01-01&to=2025-01-31")
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", key)
+	assert.Equal(t, "2025-01-01", period.FromKey())
+	assert.Equal(t, "2025-01-31", period.ToKey())
+
+	_, _, err = rangeFor("range=12")
+	assert.Error(t, err)
+	_, _, err = rangeFor("from=01/01/2025")
+	assert.Error(t, err)
+	_, _, err = rangeFor("range=custom&from=2025-02-01&to=2025-01-01")
+	assert.Error(t, err)
+	_, _, err = rangeFor("range=custom&from=2015-01-01&to=2025-01-01")
+	assert.Error(t, err)
+}
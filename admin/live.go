@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/analytics"
+	"harmonista/models"
+)
+
+// liveRefresh é o intervalo em que o stream reenvia a contagem mesmo sem
+// visitas novas, para tirar leitores inativos e manter a conexão aberta
+const liveRefresh = 30 * time.Second
+
+// livePost é cada linha do painel "agora"
+type livePost struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Readers int    `json:"readers"`
+}
+
+// liveEvent é o payload de cada evento "visitors" do stream
+type liveEvent struct {
+	Active int        `json:"active"`
+	Posts  []livePost `json:"posts"`
+	At     string     `json:"at"`
+}
+
+// liveVisitors transmite por SSE os leitores ativos do blog. O blog vem de
+// loadBlog, então só o dono recebe os eventos.
+func (a *AdminModule) liveVisitors(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	if a.analytics == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analytics não está configurado"})
+		return
+	}
+
+	// O stream fica aberto bem mais que o WriteTimeout do servidor
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	updates, cancel := a.analytics.SubscribeLive(blog.ID)
+	defer cancel()
+
+	ticker := time.NewTicker(liveRefresh)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no") // nginx não deve segurar os eventos
+
+	titles := map[int]string{}
+	c.Stream(func(w io.Writer) bool {
+		var snapshot analytics.LiveSnapshot
+		select {
+		case s, ok := <-updates:
+			if !ok {
+				return false
+			}
+			snapshot = s
+		case <-ticker.C:
+			snapshot = a.analytics.LiveVisitors(blog.ID)
+		case <-c.Request.Context().Done():
+			return false
+		}
+
+		c.SSEvent("visitors", a.liveEvent(blog.ID, snapshot, titles))
+		return true
+	})
+}
+
+// liveEvent monta o payload com os títulos dos posts. titles guarda os já
+// buscados durante a conexão.
+func (a *AdminModule) liveEvent(blogID int, snapshot analytics.LiveSnapshot, titles map[int]string) liveEvent {
+	var missing []int
+	for _, post := range snapshot.Posts {
+		if _, ok := titles[post.PostID]; !ok && post.PostID != 0 {
+			missing = append(missing, post.PostID)
+		}
+	}
+	if len(missing) > 0 {
+		for _, id := range missing {
+			titles[id] = "" // posts removidos não são buscados de novo
+		}
+		var posts []models.Post
+		a.db.Select("id, title").Where("blog_id = ? AND id IN ?", blogID, missing).Find(&posts)
+		for _, post := range posts {
+			titles[int(post.ID)] = post.Title
+		}
+	}
+
+	event := liveEvent{
+		Active: snapshot.Active,
+		Posts:  make([]livePost, 0, len(snapshot.Posts)),
+		At:     snapshot.At.Format("15:04:05"),
+	}
+	for _, post := range snapshot.Posts {
+		title := titles[post.PostID]
+		if post.PostID == 0 {
+			title = "Página inicial e outras páginas"
+		} else if title == "" {
+			title = "Post removido"
+		}
+		event.Posts = append(event.Posts, livePost{ID: post.PostID, Title: title, Readers: post.Readers})
+	}
+	return event
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/analytics"
+)
+
+func TestLiveEvent_ResolvesTitles(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID)
+
+	a := &AdminModule{db: db}
+	titles := map[int]string{}
+	event := a.liveEvent(blog.ID, analytics.LiveSnapshot{
+		Active: 4,
+		Posts: []analytics.LivePost{
+			{PostID: int(post.ID), Readers: 2},
+			{PostID: 0, Readers: 1},
+			{PostID: 9999, Readers: 1},
+		},
+		At: time.Date(2025, 3, 1, 14, 5, 0, 0, time.Local),
+	}, titles)
+
+	assert.Equal(t, 4, event.Active)
+	assert.Equal(t, "14:05:00", event.At)
+	assert.Equal(t, []livePost{
+		{ID: int(post.ID), Title: "Test Post", Readers: 2},
+		{ID: 0, Title: "Página inicial e outras páginas", Readers: 1},
+		{ID: 9999, Title: "Post removido", Readers: 1},
+	}, event.Posts)
+
+	// Os títulos ficam guardados para os próximos eventos da conexão
+	assert.Equal(t, map[int]string{int(post.ID): "Test Post", 9999: ""}, titles)
+}
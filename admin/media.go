@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"harmonista/media"
+	"harmonista/models"
+)
+
+func (a *AdminModule) listMedia(c *gin.Context) {
+	subdomain := c.Param("subdomain")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	var items []models.Media
+	if err := a.db.Where("blog_id = ?", blog.ID).Order("created_at DESC").Find(&items).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
+			"error": "Erro ao carregar mídias",
+			"blog":  blog,
+		})
+		return
+	}
+
+	used, _ := mediaUsage(a.db, blog.ID)
+	quota := media.QuotaFor(blog)
+
+	c.HTML(http.StatusOK, "admin_media.html", gin.H{
+		"subdomain":     subdomain,
+		"blog":          blog,
+		"media":         items,
+		"usedMB":        float64(used) / (1 << 20),
+		"quotaMB":       float64(quota) / (1 << 20),
+		"uploadEnabled": a.storage != nil,
+	})
+}
+
+// uploadMedia recebe uma imagem (campo "file"), processa e devolve o
+// Markdown pronto para ser inserido no editor
+func (a *AdminModule) uploadMedia(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	if a.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Upload de mídia desabilitado"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, media.MaxUploadSize()+(1<<20))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não enviado ou grande demais"})
+		return
+	}
+	if fileHeader.Size > media.MaxUploadSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Arquivo grande demais"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+
+	result, err := media.Process(data)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Erro ao processar imagem"
+		if errors.Is(err, media.ErrUnsupportedFormat) {
+			status, message = http.StatusUnsupportedMediaType, "Formato não suportado (use JPEG, PNG, GIF ou WebP)"
+		} else if errors.Is(err, media.ErrImageTooLarge) {
+			status, message = http.StatusRequestEntityTooLarge, "Imagem com resolução grande demais"
+		}
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	// Verificar cota do blog antes de gravar qualquer coisa
+	size := int64(len(result.Original.Data))
+	for _, v := range result.Variants {
+		size += int64(len(v.Data))
+	}
+	used, err := mediaUsage(a.db, blog.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar imagem"})
+		return
+	}
+	if used+size > media.QuotaFor(blog) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Cota de mídia do blog esgotada"})
+		return
+	}
+
+	item, err := media.Save(a.storage, blog.ID, filepath.Base(fileHeader.Filename), result)
+	if err != nil {
+		log.Printf("Erro ao gravar mídia do blog %d: %v", blog.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar imagem"})
+		return
+	}
+
+	if err := a.createMedia(blog, item); err != nil {
+		media.Remove(a.storage, item)
+		if errors.Is(err, errMediaQuota) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Cota de mídia do blog esgotada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar imagem"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       item.ID,
+		"url":      item.URL,
+		"width":    item.Width,
+		"height":   item.Height,
+		"markdown": mediaMarkdown(item),
+	})
+}
+
+func (a *AdminModule) deleteMedia(c *gin.Context) {
+	mediaID := c.Param("id")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	var item models.Media
+	if err := a.db.Where("id = ? AND blog_id = ?", mediaID, blog.ID).First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mídia não encontrada"})
+		return
+	}
+
+	// O registro sai primeiro: se falhar, os arquivos continuam lá. Arquivos
+	// que sobrarem sem registro só ocupam disco, não quebram o blog.
+	if err := a.db.Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao deletar mídia"})
+		return
+	}
+
+	if a.storage != nil {
+		if err := media.Remove(a.storage, &item); err != nil {
+			log.Printf("Erro ao remover arquivos da mídia %d: %v", item.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mídia deletada com sucesso"})
+}
+
+var errMediaQuota = errors.New("cota de mídia esgotada")
+
+// createMedia grava o registro e confere a cota de novo, já contando com
+// ele, na mesma transação. Dois uploads simultâneos não passam juntos: no
+// SQLite o insert espera o outro terminar e no Postgres a linha do blog
+// fica travada até o commit.
+func (a *AdminModule) createMedia(blog *models.Blog, item *models.Media) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.Blog{}, blog.ID).Error; err != nil {
+			return err
+		}
+		used, err := mediaUsage(tx, blog.ID)
+		if err != nil {
+			return err
+		}
+		if used > media.QuotaFor(blog) {
+			return errMediaQuota
+		}
+		return nil
+	})
+}
+
+// mediaUsage soma os bytes já usados pelo blog
+func mediaUsage(db *gorm.DB, blogID int) (int64, error) {
+	var used int64
+	err := db.Model(&models.Media{}).Where("blog_id = ?", blogID).Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// mediaMarkdown monta o link de imagem usando o nome do arquivo como texto alternativo
+func mediaMarkdown(item *models.Media) string {
+	alt := strings.TrimSuffix(item.Filename, filepath.Ext(item.Filename))
+	alt = strings.NewReplacer("[", "", "]", "", "\n", " ").Replace(alt)
+	return "![" + alt + "](" + item.URL + ")"
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"harmonista/media"
+	"harmonista/models"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload envia o arquivo como o editor, no campo "file"
+func upload(a *AdminModule, blog *models.Blog, filename string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(data)
+	form.Close()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("blog", blog)
+	a.uploadMedia(c)
+	return w
+}
+
+func countFiles(t *testing.T, dir string) int {
+	count := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func TestMedia_UploadListDelete(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	a := NewAdminModule(db, nil, media.NewLocalStorage(dir, "/uploads"))
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+
+	w := upload(a, blog, "Minha [foto].png", testPNG(t, 600, 300))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		ID       uint
+		URL      string
+		Markdown string
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "![Minha foto]("+response.URL+")", response.Markdown)
+
+	var item models.Media
+	assert.NoError(t, db.First(&item, response.ID).Error)
+	assert.Equal(t, blog.ID, item.BlogID)
+	assert.Equal(t, 600, item.Width)
+	files := countFiles(t, dir)
+	assert.Equal(t, 1+len(media.ParseVariants(&item)), files)
+
+	w = upload(a, blog, "texto.png", []byte("não é imagem"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// Listagem
+	gin.SetMode(gin.TestMode)
+	w = httptest.NewRecorder()
+	c, router := gin.CreateTestContext(w)
+	router.SetHTMLTemplate(template.Must(template.New("admin_media.html").Parse(`{{range .media}}{{.URL}} {{end}}{{printf "%.0f" .quotaMB}}`)))
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Set("blog", blog)
+	a.listMedia(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, item.URL+" 100", w.Body.String())
+
+	// Outro blog não apaga
+	assert.Equal(t, http.StatusNotFound, callByID(a.deleteMedia, other, "DELETE", item.ID))
+	assert.Equal(t, files, countFiles(t, dir))
+
+	assert.Equal(t, http.StatusOK, callByID(a.deleteMedia, blog, "DELETE", item.ID))
+	assert.ErrorIs(t, db.First(&models.Media{}, item.ID).Error, gorm.ErrRecordNotFound)
+	assert.Zero(t, countFiles(t, dir))
+}
+
+func TestMedia_Quota(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	a := NewAdminModule(db, nil, media.NewLocalStorage(dir, "/uploads"))
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	data := testPNG(t, 100, 100)
+
+	result, err := media.Process(data)
+	assert.NoError(t, err)
+	blog.MediaQuota = int64(len(result.Original.Data))
+	db.Save(blog)
+
+	assert.Equal(t, http.StatusOK, upload(a, blog, "a.png", data).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(a, blog, "b.png", data).Code)
+
+	// Outro upload gravou entre a verificação inicial e o insert: a cota é
+	// conferida de novo e nada fica no banco
+	item := &models.Media{BlogID: blog.ID, Key: "1/x/original.png", URL: "/uploads/1/x/original.png", Size: 1}
+	assert.ErrorIs(t, a.createMedia(blog, item), errMediaQuota)
+	var count int64
+	db.Model(&models.Media{}).Where("blog_id = ?", blog.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, 1, countFiles(t, dir))
+}
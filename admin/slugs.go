@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"harmonista/models"
+)
+
+// Slugs de posts e páginas são únicos por blog. Os gerados a partir do
+// título ganham -2, -3... nas colisões; os digitados pelo autor são
+// validados e recusados se já estiverem em uso.
+
+const maxSlugLength = 100
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// reservedPostSlugs são caminhos do blog que um post não pode ocupar
+// (veja blog.RegisterRoutes)
+var reservedPostSlugs = map[string]bool{
+	"stats": true,
+}
+
+func slugTable(kind string) string {
+	if kind == models.SlugKindPage {
+		return "pages"
+	}
+	return "posts"
+}
+
+// validateSlug confere um slug digitado pelo autor
+func validateSlug(kind, slug string) error {
+	switch {
+	case slug == "":
+		return errors.New("O endereço não pode ficar vazio")
+	case len(slug) > maxSlugLength:
+		return fmt.Errorf("O endereço pode ter no máximo %d caracteres", maxSlugLength)
+	case !slugPattern.MatchString(slug):
+		return errors.New("O endereço só pode ter letras minúsculas sem acento, números e hífens entre as palavras")
+	case kind == models.SlugKindPost && reservedPostSlugs[slug]:
+		return fmt.Errorf("O endereço %q é reservado", slug)
+	}
+	return nil
+}
+
+// uniqueSlug devolve base ou, se já estiver em uso no blog, o primeiro
+// livre entre base-2, base-3... excludeID é o próprio conteúdo, na edição.
+// Itens da lixeira mantêm o slug, para poderem ser restaurados.
+func (a *AdminModule) uniqueSlug(kind string, blogID int, base string, excludeID uint) (string, error) {
+	if len(base) > maxSlugLength {
+		base = strings.Trim(base[:maxSlugLength], "-")
+	}
+	if base == "" {
+		base = "sem-titulo"
+	}
+
+	// Slugs só têm letras, números e hífens, então base não traz curingas
+	var taken []string
+	if err := a.db.Table(slugTable(kind)).
+		Where("blog_id = ? AND id <> ? AND (slug = ? OR slug LIKE ?)", blogID, excludeID, base, base+"-%").
+		Pluck("slug", &taken).Error; err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(taken))
+	for _, slug := range taken {
+		used[slug] = true
+	}
+
+	slug := base
+	for n := 2; used[slug] || (kind == models.SlugKindPost && reservedPostSlugs[slug]); n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// slugFor escolhe o slug ao salvar: o digitado pelo autor, validado, ou,
+// se vier vazio, um gerado a partir do título
+func (a *AdminModule) slugFor(kind string, blogID int, requested, title string, excludeID uint) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		slug, err := a.uniqueSlug(kind, blogID, generateSlug(title), excludeID)
+		if err != nil {
+			return "", errors.New("Erro ao gerar o endereço")
+		}
+		return slug, nil
+	}
+
+	if err := validateSlug(kind, requested); err != nil {
+		return "", err
+	}
+	var count int64
+	if err := a.db.Table(slugTable(kind)).
+		Where("blog_id = ? AND slug = ? AND id <> ?", blogID, requested, excludeID).
+		Count(&count).Error; err != nil {
+		return "", errors.New("Erro ao verificar o endereço")
+	}
+	if count > 0 {
+		return "", fmt.Errorf("O endereço %q já está em uso neste blog (confira também a lixeira)", requested)
+	}
+	return requested, nil
+}
+
+// changeSlug registra a troca de slug de um conteúdo: o slug novo deixa de
+// ser redirecionamento e, se o conteúdo estava publicado, o antigo passa a
+// redirecionar para ele
+func changeSlug(tx *gorm.DB, kind string, blogID int, targetID uint, oldSlug, newSlug string, published bool) error {
+	if oldSlug == newSlug {
+		return nil
+	}
+	if err := tx.Where("blog_id = ? AND kind = ? AND slug IN ?", blogID, kind, []string{oldSlug, newSlug}).
+		Delete(&models.SlugRedirect{}).Error; err != nil {
+		return err
+	}
+	if !published || oldSlug == "" {
+		return nil
+	}
+	return tx.Create(&models.SlugRedirect{
+		BlogID:   blogID,
+		Kind:     kind,
+		Slug:     oldSlug,
+		TargetID: targetID,
+	}).Error
+}
+
+// deleteSlugRedirects apaga os redirecionamentos de um conteúdo apagado de vez
+func deleteSlugRedirects(tx *gorm.DB, kind string, targetID uint) error {
+	return tx.Where("kind = ? AND target_id = ?", kind, targetID).Delete(&models.SlugRedirect{}).Error
+}
@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/models"
+)
+
+// postForm chama o handler com um formulário, como o editor envia
+func postForm(a *AdminModule, handler gin.HandlerFunc, blog *models.Blog, id uint, form url.Values) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(w)
+	router.SetHTMLTemplate(template.Must(template.New("admin_error.html").Parse("{{.error}}")))
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.Params = gin.Params{{Key: "subdomain", Value: blog.Subdomain}, {Key: "id", Value: strconv.Itoa(int(id))}}
+	c.Set("blog", blog)
+	handler(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func TestSavePost_UniqueSlugs(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+
+	for i := 0; i < 3; i++ {
+		w := postForm(a, a.savePost, blog, 0, url.Values{"title": {"Olá, Mundo"}, "content": {"x"}, "action": {"publish"}})
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	w := postForm(a, a.savePost, blog, 0, url.Values{"title": {"Stats"}, "content": {"x"}, "action": {"publish"}})
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	var slugs []string
+	db.Model(&models.Post{}).Where("blog_id = ?", blog.ID).Order("id").Pluck("slug", &slugs)
+	assert.Equal(t, []string{"ola-mundo", "ola-mundo-2", "ola-mundo-3", "stats-2"}, slugs)
+
+	// Endereço digitado: validado e sem sufixo automático
+	w = postForm(a, a.savePost, blog, 0, url.Values{"title": {"Outro"}, "slug": {"ola-mundo"}, "action": {"publish"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "já está em uso")
+	w = postForm(a, a.savePost, blog, 0, url.Values{"title": {"Outro"}, "slug": {"Com Espaço"}, "action": {"publish"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postForm(a, a.savePost, blog, 0, url.Values{"title": {"Outro"}, "slug": {"meu-endereco"}, "action": {"publish"}})
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// Em outro blog o mesmo slug está livre
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+	postForm(a, a.savePost, other, 0, url.Values{"title": {"Olá, Mundo"}, "action": {"publish"}})
+	var post models.Post
+	db.Where("blog_id = ?", other.ID).First(&post)
+	assert.Equal(t, "ola-mundo", post.Slug)
+}
+
+func TestUpdatePost_SlugRedirects(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID) // rascunho "test-post"
+	other := createTestPost(db, blog.ID)
+
+	update := func(form url.Values) *httptest.ResponseRecorder {
+		form.Set("content", "x")
+		return postForm(a, a.updatePost, blog, post.ID, form)
+	}
+	redirects := func() map[string]uint {
+		var rows []models.SlugRedirect
+		db.Where("blog_id = ? AND kind = ?", blog.ID, models.SlugKindPost).Find(&rows)
+		found := make(map[string]uint)
+		for _, row := range rows {
+			found[row.Slug] = row.TargetID
+		}
+		return found
+	}
+
+	// Rascunho: o endereço antigo nunca foi público, não há redirecionamento
+	assert.Equal(t, http.StatusFound, update(url.Values{"title": {"Primeiro"}, "slug": {"primeiro"}, "action": {"publish"}}).Code)
+	assert.Empty(t, redirects())
+
+	// Sem o campo slug, o título muda e o endereço fica
+	update(url.Values{"title": {"Novo título"}, "action": {"update"}})
+	db.First(post, post.ID)
+	assert.Equal(t, "primeiro", post.Slug)
+
+	// Vazio gera a partir do título; o antigo redireciona
+	update(url.Values{"title": {"Novo título"}, "slug": {""}, "action": {"update"}})
+	update(url.Values{"title": {"Novo título"}, "slug": {"final"}, "action": {"update"}})
+	db.First(post, post.ID)
+	assert.Equal(t, "final", post.Slug)
+	assert.Equal(t, map[string]uint{"primeiro": post.ID, "novo-titulo": post.ID}, redirects())
+
+	// Voltar a um slug antigo desfaz o redirecionamento dele
+	update(url.Values{"title": {"Novo título"}, "slug": {"primeiro"}, "action": {"update"}})
+	assert.Equal(t, map[string]uint{"novo-titulo": post.ID, "final": post.ID}, redirects())
+
+	w := update(url.Values{"title": {"Novo título"}, "slug": {other.Slug}, "action": {"update"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = update(url.Values{"title": {"Novo título"}, "slug": {"stats"}, "action": {"update"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reservado")
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("DELETE", "/", nil)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(post.ID))}}
+	c.Set("blog", blog)
+	a.deletePost(c)
+	assert.Len(t, redirects(), 2, "na lixeira os redirecionamentos ficam")
+}
+
+func TestAutoSaveKeepsSlug(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(`{"title":"Outro título","content":"novo"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(post.ID))}}
+	c.Set("blog", blog)
+	a.autoSaveExistingPost(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	db.First(post, post.ID)
+	assert.Equal(t, "Outro título", post.Title)
+	assert.Equal(t, "test-post", post.Slug)
+}
+
+func TestValidateSlug(t *testing.T) {
+	assert.NoError(t, validateSlug(models.SlugKindPost, "meu-post-2"))
+	assert.NoError(t, validateSlug(models.SlugKindPage, "stats"))
+	for _, slug := range []string{"", "Maiusculo", "com espaco", "-borda", "hifen--duplo", "acentuação", strings.Repeat("a", maxSlugLength+1)} {
+		assert.Error(t, validateSlug(models.SlugKindPost, slug), slug)
+	}
+	assert.Error(t, validateSlug(models.SlugKindPost, "stats"))
+}
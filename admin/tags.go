@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"harmonista/cache"
+	"harmonista/models"
+)
+
+// tagSummary é uma tag do blog com quantos posts (fora da lixeira) a usam
+type tagSummary struct {
+	models.Tag
+	PostCount int64
+}
+
+// blogTag busca uma tag do blog pelo id da URL
+func (a *AdminModule) blogTag(blogID int, id string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := a.db.Where("id = ? AND blog_id = ?", id, blogID).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (a *AdminModule) listTags(c *gin.Context) {
+	subdomain := c.Param("subdomain")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	var tags []tagSummary
+	if err := a.db.Model(&models.Tag{}).
+		Select("tags.*, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL").
+		Where("tags.blog_id = ?", blog.ID).
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&tags).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
+			"error": "Erro ao carregar tags",
+			"blog":  blog,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "admin_tags.html", gin.H{
+		"subdomain": subdomain,
+		"blog":      blog,
+		"tags":      tags,
+	})
+}
+
+// updateTag renomeia a tag e altera sua descrição
+func (a *AdminModule) updateTag(c *gin.Context) {
+	subdomain := c.Param("subdomain")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	tag, err := a.blogTag(blog.ID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "admin_error.html", gin.H{
+			"error": "Tag não encontrada",
+			"blog":  blog,
+		})
+		return
+	}
+
+	title := strings.Join(strings.Fields(c.PostForm("title")), " ")
+	if title == "" {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": "O nome da tag não pode ficar vazio",
+			"blog":  blog,
+		})
+		return
+	}
+	name := models.NormalizeTagName(title)
+
+	var count int64
+	a.db.Model(&models.Tag{}).Where("blog_id = ? AND name = ? AND id <> ?", blog.ID, name, tag.ID).Count(&count)
+	if count > 0 {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": fmt.Sprintf("Já existe a tag %q neste blog; para unir as duas, use Juntar", title),
+			"blog":  blog,
+		})
+		return
+	}
+
+	if err := a.db.Model(tag).Updates(map[string]interface{}{
+		"title":       title,
+		"name":        name,
+		"description": c.PostForm("description"),
+	}).Error; err != nil {
+		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
+			"error": "Erro ao salvar tag",
+			"blog":  blog,
+		})
+		return
+	}
+	cache.TagChanged(tag)
+
+	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/tags")
+}
+
+// mergeTag passa os posts da tag para outra do blog e apaga a primeira
+func (a *AdminModule) mergeTag(c *gin.Context) {
+	subdomain := c.Param("subdomain")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	source, err := a.blogTag(blog.ID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "admin_error.html", gin.H{
+			"error": "Tag não encontrada",
+			"blog":  blog,
+		})
+		return
+	}
+	target, err := a.blogTag(blog.ID, c.PostForm("into"))
+	if err != nil || target.ID == source.ID {
+		c.HTML(http.StatusBadRequest, "admin_error.html", gin.H{
+			"error": "Escolha outra tag deste blog para juntar",
+			"blog":  blog,
+		})
+		return
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		// Posts que já têm as duas ficam só com a ligação da tag destino
+		if err := tx.Where("tag_id = ? AND post_id IN (?)", source.ID,
+			tx.Model(&models.PostTag{}).Select("post_id").Where("tag_id = ?", target.ID)).
+			Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PostTag{}).Where("tag_id = ?", source.ID).
+			Update("tag_id", target.ID).Error; err != nil {
+			return err
+		}
+		if target.Description == "" && source.Description != "" {
+			if err := tx.Model(target).Update("description", source.Description).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(source).Error
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
+			"error": "Erro ao juntar tags",
+			"blog":  blog,
+		})
+		return
+	}
+	cache.TagChanged(source)
+	cache.TagChanged(target)
+
+	c.Redirect(http.StatusFound, "/admin/"+subdomain+"/tags")
+}
+
+// deleteTag tira a tag de todos os posts e a apaga
+func (a *AdminModule) deleteTag(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	tag, err := a.blogTag(blog.ID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag não encontrada"})
+		return
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao deletar tag"})
+		return
+	}
+	cache.TagChanged(tag)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deletada"})
+}
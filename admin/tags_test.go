@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/models"
+)
+
+func TestProcessPostTags_ScopedAndNormalized(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+	post := createTestPost(db, blog.ID)
+	otherPost := createTestPost(db, other.ID)
+
+	assert.NoError(t, a.processPostTags(blog.ID, int(post.ID), "Go,  go , Banco  de Dados"))
+	assert.NoError(t, a.processPostTags(other.ID, int(otherPost.ID), "GO"))
+
+	var tags []models.Tag
+	db.Order("id").Find(&tags)
+	assert.Len(t, tags, 3)
+	assert.Equal(t, models.Tag{ID: tags[0].ID, BlogID: blog.ID, Title: "Go", Name: "go"}, tags[0])
+	assert.Equal(t, "banco de dados", tags[1].Name)
+	assert.Equal(t, "Banco de Dados", tags[1].Title)
+	assert.Equal(t, other.ID, tags[2].BlogID)
+	assert.Equal(t, "Go, Banco de Dados", a.getPostTags(int(post.ID)))
+}
+
+func TestManageTags(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	first := createTestPost(db, blog.ID)
+	second := createTestPost(db, blog.ID)
+	a.processPostTags(blog.ID, int(first.ID), "golang, go")
+	a.processPostTags(blog.ID, int(second.ID), "golang, web")
+
+	tagID := func(name string) uint {
+		var tag models.Tag
+		db.Where("blog_id = ? AND name = ?", blog.ID, name).First(&tag)
+		return tag.ID
+	}
+	golang, goTag, web := tagID("golang"), tagID("go"), tagID("web")
+
+	// Renomear para um nome que já existe pede para juntar
+	w := postForm(a, a.updateTag, blog, golang, url.Values{"title": {"GO"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Juntar")
+
+	w = postForm(a, a.updateTag, blog, web, url.Values{"title": {" Web  Dev "}, "description": {"Sobre *web*"}})
+	assert.Equal(t, http.StatusFound, w.Code)
+	var renamed models.Tag
+	db.First(&renamed, web)
+	assert.Equal(t, models.Tag{ID: web, BlogID: blog.ID, Title: "Web Dev", Name: "web dev", Description: "Sobre *web*"}, renamed)
+
+	// Juntar golang em go: o primeiro post, que tinha as duas, fica com uma
+	w = postForm(a, a.mergeTag, blog, golang, url.Values{"into": {strconv.Itoa(int(goTag))}})
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Error(t, db.First(&models.Tag{}, golang).Error)
+	assert.Equal(t, "go", a.getPostTags(int(first.ID)))
+	var links int64
+	db.Model(&models.PostTag{}).Where("tag_id = ?", goTag).Count(&links)
+	assert.Equal(t, int64(2), links)
+
+	w = postForm(a, a.mergeTag, blog, goTag, url.Values{"into": {strconv.Itoa(int(goTag))}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Tags de outro blog não são alcançáveis
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+	assert.Equal(t, http.StatusNotFound, callByID(a.deleteTag, other, "DELETE", goTag))
+
+	assert.Equal(t, http.StatusOK, callByID(a.deleteTag, blog, "DELETE", goTag))
+	assert.Error(t, db.First(&models.Tag{}, goTag).Error)
+	db.Model(&models.PostTag{}).Where("tag_id = ?", goTag).Count(&links)
+	assert.Zero(t, links)
+	assert.Equal(t, "Web Dev", a.getPostTags(int(second.ID)))
+}
+
+func TestListTags_PostCounts(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	first := createTestPost(db, blog.ID)
+	trashed := createTestPost(db, blog.ID)
+	a.processPostTags(blog.ID, int(first.ID), "web, go")
+	a.processPostTags(blog.ID, int(trashed.ID), "go, vazia")
+	db.Delete(trashed)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(w)
+	router.SetHTMLTemplate(template.Must(template.New("admin_tags.html").Parse("{{range .tags}}{{.Name}}:{{.PostCount}};{{end}}")))
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Set("blog", blog)
+	a.listTags(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "go:1;vazia:0;web:1;", w.Body.String())
+}
@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"harmonista/cache"
+	"harmonista/models"
+)
+
+const (
+	// trashRetentionDays é quanto tempo posts e páginas ficam na lixeira
+	// antes de serem apagados de vez
+	trashRetentionDays = 30
+	trashRetention     = trashRetentionDays * 24 * time.Hour
+	// trashPurgeInterval é de quanto em quanto tempo a lixeira é esvaziada
+	trashPurgeInterval = time.Hour
+)
+
+// trashEntry é um post ou página na lixeira
+type trashEntry struct {
+	ID        uint
+	Title     string
+	Slug      string
+	DeletedAt time.Time
+	PurgeAt   time.Time
+}
+
+func newTrashEntry(id uint, title, slug string, deletedAt gorm.DeletedAt) trashEntry {
+	return trashEntry{
+		ID:        id,
+		Title:     title,
+		Slug:      slug,
+		DeletedAt: deletedAt.Time,
+		PurgeAt:   deletedAt.Time.Add(trashRetention),
+	}
+}
+
+func (a *AdminModule) trash(c *gin.Context) {
+	subdomain := c.Param("subdomain")
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	var posts []models.Post
+	var pages []models.Page
+	err := a.db.Unscoped().Where("blog_id = ? AND deleted_at IS NOT NULL", blog.ID).
+		Order("deleted_at DESC").Find(&posts).Error
+	if err == nil {
+		err = a.db.Unscoped().Where("blog_id = ? AND deleted_at IS NOT NULL", blog.ID).
+			Order("deleted_at DESC").Find(&pages).Error
+	}
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "admin_error.html", gin.H{
+			"error": "Erro ao carregar a lixeira",
+			"blog":  blog,
+		})
+		return
+	}
+
+	trashedPosts := make([]trashEntry, len(posts))
+	for i, post := range posts {
+		trashedPosts[i] = newTrashEntry(post.ID, post.Title, post.Slug, post.DeletedAt)
+	}
+	trashedPages := make([]trashEntry, len(pages))
+	for i, page := range pages {
+		trashedPages[i] = newTrashEntry(page.ID, page.Title, page.Slug, page.DeletedAt)
+	}
+
+	c.HTML(http.StatusOK, "admin_trash.html", gin.H{
+		"subdomain":     subdomain,
+		"blog":          blog,
+		"posts":         trashedPosts,
+		"pages":         trashedPages,
+		"retentionDays": trashRetentionDays,
+	})
+}
+
+// trashedPost busca um post do blog que esteja na lixeira
+func (a *AdminModule) trashedPost(c *gin.Context, blog *models.Blog) (*models.Post, bool) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil, false
+	}
+
+	var post models.Post
+	if err := a.db.Unscoped().Where("id = ? AND blog_id = ? AND deleted_at IS NOT NULL", postID, blog.ID).
+		First(&post).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post não encontrado na lixeira"})
+		return nil, false
+	}
+	return &post, true
+}
+
+// trashedPage busca uma página do blog que esteja na lixeira
+func (a *AdminModule) trashedPage(c *gin.Context, blog *models.Blog) (*models.Page, bool) {
+	pageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil, false
+	}
+
+	var page models.Page
+	if err := a.db.Unscoped().Where("id = ? AND blog_id = ? AND deleted_at IS NOT NULL", pageID, blog.ID).
+		First(&page).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Página não encontrada na lixeira"})
+		return nil, false
+	}
+	return &page, true
+}
+
+func (a *AdminModule) restorePost(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	post, ok := a.trashedPost(c, blog)
+	if !ok {
+		return
+	}
+	if err := a.db.Unscoped().Model(post).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao restaurar post"})
+		return
+	}
+	cache.PostChanged(post)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post restaurado"})
+}
+
+func (a *AdminModule) purgeTrashedPost(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	post, ok := a.trashedPost(c, blog)
+	if !ok {
+		return
+	}
+	if err := a.db.Transaction(func(tx *gorm.DB) error { return purgePost(tx, post) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao apagar post"})
+		return
+	}
+	cache.PostChanged(post)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post apagado de vez"})
+}
+
+func (a *AdminModule) restorePage(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	page, ok := a.trashedPage(c, blog)
+	if !ok {
+		return
+	}
+	if err := a.db.Unscoped().Model(page).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao restaurar página"})
+		return
+	}
+	cache.PageChanged(page)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Página restaurada"})
+}
+
+func (a *AdminModule) purgeTrashedPage(c *gin.Context) {
+	blogData, _ := c.Get("blog")
+	blog := blogData.(*models.Blog)
+
+	page, ok := a.trashedPage(c, blog)
+	if !ok {
+		return
+	}
+	if err := a.db.Transaction(func(tx *gorm.DB) error { return purgePage(tx, page) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao apagar página"})
+		return
+	}
+	cache.PageChanged(page)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Página apagada de vez"})
+}
+
+// purgePost apaga de vez um post, com suas tags e redirecionamentos
+func purgePost(tx *gorm.DB, post *models.Post) error {
+	if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostTag{}).Error; err != nil {
+		return err
+	}
+	if err := deleteSlugRedirects(tx, models.SlugKindPost, post.ID); err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(post).Error
+}
+
+// purgePage apaga de vez uma página e seus redirecionamentos
+func purgePage(tx *gorm.DB, page *models.Page) error {
+	if err := deleteSlugRedirects(tx, models.SlugKindPage, page.ID); err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(page).Error
+}
+
+// PurgeTrash apaga de vez os posts e páginas que foram para a lixeira
+// antes de before e devolve quantos foram apagados
+func (a *AdminModule) PurgeTrash(before time.Time) (int, error) {
+	var posts []models.Post
+	if err := a.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Find(&posts).Error; err != nil {
+		return 0, err
+	}
+	var pages []models.Page
+	if err := a.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Find(&pages).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for i := range posts {
+		if err := a.db.Transaction(func(tx *gorm.DB) error { return purgePost(tx, &posts[i]) }); err != nil {
+			return purged, err
+		}
+		cache.PostChanged(&posts[i])
+		purged++
+	}
+	for i := range pages {
+		if err := a.db.Transaction(func(tx *gorm.DB) error { return purgePage(tx, &pages[i]) }); err != nil {
+			return purged, err
+		}
+		cache.PageChanged(&pages[i])
+		purged++
+	}
+	return purged, nil
+}
+
+// StartTrashPurger esvazia agora e depois a cada trashPurgeInterval o que
+// está na lixeira há mais de trashRetention, até Close
+func (a *AdminModule) StartTrashPurger() {
+	a.stopPurger = make(chan struct{})
+	a.purgerDone = make(chan struct{})
+
+	go func() {
+		defer close(a.purgerDone)
+
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if purged, err := a.PurgeTrash(time.Now().Add(-trashRetention)); err != nil {
+				log.Printf("Error purging trash: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d items from the trash", purged)
+			}
+			select {
+			case <-a.stopPurger:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close para a limpeza da lixeira, esperando a rodada em andamento
+func (a *AdminModule) Close() {
+	if a.stopPurger == nil {
+		return
+	}
+	close(a.stopPurger)
+	<-a.purgerDone
+}
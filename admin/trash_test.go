@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/models"
+)
+
+// callByID chama um handler da lixeira para o post ou página id
+func callByID(handler gin.HandlerFunc, blog *models.Blog, method string, id uint) int {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", nil)
+	c.Params = gin.Params{{Key: "subdomain", Value: blog.Subdomain}, {Key: "id", Value: strconv.Itoa(int(id))}}
+	c.Set("blog", blog)
+	handler(c)
+	return w.Code
+}
+
+func TestTrash_DeleteRestorePurge(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID)
+	assert.NoError(t, a.processPostTags(blog.ID, int(post.ID), "go, sqlite"))
+	db.Create(&models.SlugRedirect{BlogID: blog.ID, Kind: models.SlugKindPost, Slug: "antigo", TargetID: post.ID})
+
+	countTags := func() int64 {
+		var count int64
+		db.Model(&models.PostTag{}).Where("post_id = ?", post.ID).Count(&count)
+		return count
+	}
+
+	// Deletar manda para a lixeira sem mexer em tags e redirecionamentos
+	assert.Equal(t, http.StatusOK, callByID(a.deletePost, blog, "DELETE", post.ID))
+	assert.Error(t, db.First(&models.Post{}, post.ID).Error)
+	assert.NoError(t, db.Unscoped().First(&models.Post{}, post.ID).Error)
+	assert.Equal(t, int64(2), countTags())
+
+	// Só itens da lixeira podem ser restaurados ou apagados de vez
+	other := createTestPost(db, blog.ID)
+	assert.Equal(t, http.StatusNotFound, callByID(a.restorePost, blog, "POST", other.ID))
+	assert.Equal(t, http.StatusNotFound, callByID(a.purgeTrashedPost, blog, "DELETE", other.ID))
+
+	assert.Equal(t, http.StatusOK, callByID(a.restorePost, blog, "POST", post.ID))
+	assert.NoError(t, db.First(&models.Post{}, post.ID).Error)
+
+	callByID(a.deletePost, blog, "DELETE", post.ID)
+	assert.Equal(t, http.StatusOK, callByID(a.purgeTrashedPost, blog, "DELETE", post.ID))
+	assert.Error(t, db.Unscoped().First(&models.Post{}, post.ID).Error)
+	assert.Zero(t, countTags())
+	var redirects int64
+	db.Model(&models.SlugRedirect{}).Count(&redirects)
+	assert.Zero(t, redirects)
+
+	page := &models.Page{BlogID: blog.ID, Title: "Sobre", Slug: "sobre"}
+	db.Create(page)
+	assert.Equal(t, http.StatusOK, callByID(a.deletePage, blog, "DELETE", page.ID))
+	assert.Equal(t, http.StatusOK, callByID(a.restorePage, blog, "POST", page.ID))
+	callByID(a.deletePage, blog, "DELETE", page.ID)
+	assert.Equal(t, http.StatusOK, callByID(a.purgeTrashedPage, blog, "DELETE", page.ID))
+	assert.Error(t, db.Unscoped().First(&models.Page{}, page.ID).Error)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	old := createTestPost(db, blog.ID)
+	recent := createTestPost(db, blog.ID)
+	live := createTestPost(db, blog.ID)
+	page := &models.Page{BlogID: blog.ID, Title: "Sobre", Slug: "sobre"}
+	db.Create(page)
+
+	now := time.Now()
+	db.Model(&models.Post{}).Where("id = ?", old.ID).Update("deleted_at", now.Add(-31*24*time.Hour))
+	db.Model(&models.Post{}).Where("id = ?", recent.ID).Update("deleted_at", now.Add(-29*24*time.Hour))
+	db.Model(&models.Page{}).Where("id = ?", page.ID).Update("deleted_at", now.Add(-40*24*time.Hour))
+
+	purged, err := a.PurgeTrash(now.Add(-trashRetention))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	var ids []uint
+	db.Unscoped().Model(&models.Post{}).Order("id").Pluck("id", &ids)
+	assert.Equal(t, []uint{recent.ID, live.ID}, ids)
+	assert.Error(t, db.Unscoped().First(&models.Page{}, page.ID).Error)
+}
+
+func TestSlugOfTrashedPostStaysTaken(t *testing.T) {
+	db := setupTestDB(t)
+	a := NewAdminModule(db, nil, nil)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID)
+	db.Delete(post)
+
+	slug, err := a.uniqueSlug(models.SlugKindPost, blog.ID, post.Slug, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, post.Slug+"-2", slug)
+	_, err = a.slugFor(models.SlugKindPost, blog.ID, post.Slug, "", 0)
+	assert.ErrorContains(t, err, "lixeira")
+}
@@ -4,7 +4,11 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"log"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,21 +17,51 @@ import (
 
 // BlogEvent representa um evento de visita no blog
 type BlogEvent struct {
-	ID        uint      `gorm:"primary_key;autoIncrement"`
-	BlogID    int       `gorm:"not null;index"`
-	PostID    *int      `gorm:"index"` // nullable - para quando for visita a um post específico
-	CookieID  string    `gorm:"not null;index"`
-	Event     string    `gorm:"not null;default:'visit'"` // default "visit"
-	IP        string    `gorm:"not null"`
-	Pais      *string   // nullable
-	Lingua    *string   // nullable
-	Navegador *string   // nullable
-	CreatedAt time.Time `gorm:"index"`
+	ID        uint    `gorm:"primary_key;autoIncrement"`
+	BlogID    int     `gorm:"not null;index"`
+	PostID    *int    `gorm:"index"`                    // nullable - para quando for visita a um post específico
+	CookieID  string  `gorm:"not null;index"`           // cookie do visitante ou hash diário (modo sem cookies)
+	Event     string  `gorm:"not null;default:'visit'"` // default "visit"
+	Pais      *string // nullable
+	Lingua    *string // nullable
+	Navegador *string // nullable
+	// Origem guarda só o host de quem indicou a visita (ou a seção do
+	// Harmonista, como /leia); TipoOrigem é search/social/direct/internal/other
+	Origem      *string `gorm:"size:255"`
+	TipoOrigem  *string `gorm:"size:16"`
+	UtmSource   *string `gorm:"size:100"`
+	UtmMedium   *string `gorm:"size:100"`
+	UtmCampaign *string `gorm:"size:100"`
+	MotivoBot   *string `gorm:"size:16"` // preenchido quando Event = "bot" (ANALYTICS_BOTS=tag)
+	// Eventos "read" do beacon de leitura: % do post lido e segundos na página
+	Profundidade *int
+	TempoLeitura *int
+	CreatedAt    time.Time `gorm:"index"`
 }
 
 // AnalyticsModule gerencia o tracking de analytics
 type AnalyticsModule struct {
-	db *gorm.DB
+	db     *gorm.DB
+	mode   string
+	salt   dailySalt
+	ingest *ingester
+	// live acompanha os leitores ativos para o painel "agora"
+	live *liveHub
+
+	// baseHost é o host de DOMAIN, usado para reconhecer visitas internas
+	baseHost string
+	// geo resolve o país pelo IP (GEOIP_DB); nil quando não configurado
+	geo *geoResolver
+	// bots identifica crawlers; botMode diz se são descartados ou marcados
+	bots    *botClassifier
+	botMode string
+
+	retentionDays int
+	stopRollups   chan struct{}
+	rollupsDone   chan struct{}
+	// rolledUp é o dia da última execução do job de rollups; dele em
+	// diante as consultas somam os eventos brutos (pendingRows)
+	rolledUp atomic.Pointer[time.Time]
 }
 
 // NewAnalyticsModule cria uma nova instância do módulo de analytics
@@ -37,50 +71,64 @@ func NewAnalyticsModule(db *gorm.DB) *AnalyticsModule {
 		return nil
 	}
 
-	// Executar migration da tabela blog_events
-	if err := db.AutoMigrate(&BlogEvent{}); err != nil {
-		log.Printf("Error migrating blog_events table: %v", err)
+	if err := RunMigrations(db); err != nil {
+		log.Printf("Error migrating analytics tables: %v", err)
 		return nil
 	}
 
-	log.Println("Analytics module initialized successfully")
-	return &AnalyticsModule{db: db}
+	a := &AnalyticsModule{
+		db:            db,
+		mode:          modeFromEnv(),
+		ingest:        newIngester(db),
+		baseHost:      baseHostFromEnv(),
+		geo:           newGeoResolver(os.Getenv("GEOIP_DB")),
+		bots:          newBotClassifier(os.Getenv("ANALYTICS_BOT_RDNS") == "true"),
+		botMode:       botModeFromEnv(),
+		live:          newLiveHub(),
+		retentionDays: retentionFromEnv(),
+		stopRollups:   make(chan struct{}),
+		rollupsDone:   make(chan struct{}),
+	}
+
+	a.ingest.live = a.live
+
+	// Job de rollups: na primeira execução faz o backfill do histórico
+	go a.runRollups(a.stopRollups, a.rollupsDone)
+
+	log.Printf("Analytics module initialized successfully (mode: %s, retention: %d days, bots: %s)", a.mode, a.retentionDays, a.botMode)
+	return a
 }
 
 // TrackVisit registra uma visita no banco de dados de analytics
 // Implementa throttling para evitar contar múltiplos refreshes:
 // - Só registra se a última visita do mesmo usuário foi há mais de 30 minutos
+// A verificação é feita em memória e a gravação em lotes, fora da requisição.
 func (a *AnalyticsModule) TrackVisit(c *gin.Context, blogID int, postID *int) {
 	if a == nil || a.db == nil {
 		return // Analytics desabilitado
 	}
 
-	// Obter ou criar cookie ID para identificar visitante único
-	cookieID := a.getOrCreateCookieID(c)
-
-	// Verificar se já existe uma visita recente deste usuário neste blog/post
-	// (últimos 30 minutos)
-	thirtyMinutesAgo := time.Now().Add(-30 * time.Minute)
-
-	var recentVisit BlogEvent
-	query := a.db.Where("cookie_id = ? AND blog_id = ? AND created_at > ?",
-		cookieID, blogID, thirtyMinutesAgo)
-
-	// Se for visita a um post específico, verificar também o post_id
-	if postID != nil {
-		query = query.Where("post_id = ?", *postID)
-	} else {
-		// Se for visita à página inicial, verificar visitas onde post_id é NULL
-		query = query.Where("post_id IS NULL")
+	// Respeitar DNT / Global Privacy Control
+	if doNotTrack(c) {
+		return
 	}
 
-	if err := query.First(&recentVisit).Error; err == nil {
-		// Já existe uma visita recente, não registrar novamente
-		return
+	// Robôs são descartados ou gravados à parte, conforme ANALYTICS_BOTS.
+	// O IP é o da conexão: os cabeçalhos de proxy vêm do cliente e
+	// burlariam o limite de taxa e o cache de DNS reverso.
+	clientIP := c.ClientIP()
+	eventType := "visit"
+	var motivoBot *string
+	if reason := a.bots.classify(c, clientIP); reason != "" {
+		if a.botMode != BotsTag {
+			return
+		}
+		eventType = "bot"
+		motivoBot = &reason
 	}
 
-	// Capturar IP
-	ip := a.getClientIP(c)
+	// Identificar o visitante: hash diário (padrão) ou cookie
+	cookieID := a.visitorID(c, blogID)
 
 	// Capturar User-Agent e extrair informações
 	userAgent := c.Request.UserAgent()
@@ -89,27 +137,91 @@ func (a *AnalyticsModule) TrackVisit(c *gin.Context, blogID int, postID *int) {
 	// Capturar Accept-Language para detectar idioma
 	lingua := a.extractLanguage(c)
 
-	// Por enquanto, país fica como nil (pode ser implementado com GeoIP no futuro)
-	var pais *string = nil
+	// País pelo banco GeoIP local, antes do IP ser descartado
+	pais := a.geo.country(clientIP)
+
+	// Origem da visita, reduzida ao host, e parâmetros de campanha
+	origem, tipoOrigem := referrerOrigin(c.Request.Referer(), a.baseHost)
 
 	event := BlogEvent{
-		BlogID:    blogID,
-		PostID:    postID,
-		CookieID:  cookieID,
-		Event:     "visit",
-		IP:        ip,
-		Pais:      pais,
-		Lingua:    lingua,
-		Navegador: navegador,
-		CreatedAt: time.Now(),
-	}
-
-	// Salvar no banco de forma assíncrona para não impactar performance
-	go func() {
-		if err := a.db.Create(&event).Error; err != nil {
-			log.Printf("Error saving analytics event: %v", err)
-		}
-	}()
+		BlogID:      blogID,
+		PostID:      postID,
+		CookieID:    cookieID,
+		Event:       eventType,
+		Pais:        pais,
+		Lingua:      lingua,
+		Navegador:   navegador,
+		Origem:      origem,
+		TipoOrigem:  &tipoOrigem,
+		UtmSource:   utmParam(c, "utm_source"),
+		UtmMedium:   utmParam(c, "utm_medium"),
+		UtmCampaign: utmParam(c, "utm_campaign"),
+		MotivoBot:   motivoBot,
+		CreatedAt:   time.Now(),
+	}
+
+	// Enfileirar para gravação em lote (descarta se a fila estiver cheia)
+	a.ingest.enqueue(event)
+}
+
+// Close grava os eventos pendentes e encerra o worker de ingestão.
+// Deve ser chamado no desligamento do servidor.
+func (a *AnalyticsModule) Close() {
+	if a == nil || a.ingest == nil {
+		return
+	}
+	a.live.close()
+	a.ingest.close()
+
+	close(a.stopRollups)
+	<-a.rollupsDone
+
+	a.geo.close()
+	a.bots.close()
+}
+
+// Stats retorna o estado da fila de gravação de eventos
+func (a *AnalyticsModule) Stats() IngestStats {
+	if a == nil || a.ingest == nil {
+		return IngestStats{}
+	}
+	return a.ingest.stats()
+}
+
+// BotStats retorna quantas requisições foram classificadas como robô
+// desde o início do processo
+func (a *AnalyticsModule) BotStats() BotStats {
+	if a == nil || a.bots == nil {
+		return BotStats{}
+	}
+	return a.bots.stats(a.botMode)
+}
+
+// GetBotEvents retorna os robôs gravados no intervalo, por motivo. Só há
+// dados com ANALYTICS_BOTS=tag, dentro da janela de retenção.
+func (a *AnalyticsModule) GetBotEvents(r TimeRange) []DimensionVisits {
+	if a == nil || a.db == nil {
+		return []DimensionVisits{}
+	}
+
+	var results []DimensionVisits
+	a.db.Model(&BlogEvent{}).
+		Select("COALESCE(motivo_bot, '') AS value, COUNT(*) AS count").
+		Where("event = ? AND created_at >= ? AND created_at < ?", "bot", startOfDay(r.From), startOfDay(r.To).AddDate(0, 0, 1)).
+		Group("motivo_bot").
+		Order("count DESC").
+		Scan(&results)
+
+	return results
+}
+
+// visitorID identifica o visitante conforme o modo configurado. No modo sem
+// cookies o IP só entra no hash e nunca é gravado.
+func (a *AnalyticsModule) visitorID(c *gin.Context, blogID int) string {
+	if a.mode == ModeCookie {
+		return a.getOrCreateCookieID(c)
+	}
+	return a.salt.visitorHash(time.Now(), c.ClientIP(), c.Request.UserAgent(), blogID)
 }
 
 // getOrCreateCookieID obtém ou cria um cookie ID único para o visitante
@@ -140,29 +252,6 @@ func (a *AnalyticsModule) getOrCreateCookieID(c *gin.Context) string {
 	return cookieID
 }
 
-// getClientIP obtém o IP real do cliente, considerando proxies
-func (a *AnalyticsModule) getClientIP(c *gin.Context) string {
-	// Tentar obter de headers comuns de proxy
-	if ip := c.GetHeader("X-Forwarded-For"); ip != "" {
-		// X-Forwarded-For pode ter múltiplos IPs, pegar o primeiro
-		ips := strings.Split(ip, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	if ip := c.GetHeader("X-Real-IP"); ip != "" {
-		return ip
-	}
-
-	if ip := c.GetHeader("CF-Connecting-IP"); ip != "" {
-		return ip
-	}
-
-	// Fallback para IP direto
-	return c.ClientIP()
-}
-
 // extractBrowser extrai o nome do navegador do User-Agent
 func (a *AnalyticsModule) extractBrowser(userAgent string) *string {
 	if userAgent == "" {
@@ -213,10 +302,21 @@ func (a *AnalyticsModule) extractLanguage(c *gin.Context) *string {
 	return nil
 }
 
-// DayVisits representa o número de visitas em um dia específico
-type DayVisits struct {
-	Date  string
-	Count int64
+// PeriodVisits representa as visitas de um dia, semana ou mês. Date é o
+// primeiro dia do período (2006-01-02) e Label o rótulo para o gráfico.
+// Visitors soma os visitantes únicos de cada dia, já que no modo sem
+// cookies o mesmo leitor não pode ser reconhecido em dias diferentes.
+type PeriodVisits struct {
+	Date     string
+	Label    string
+	Count    int64
+	Visitors int64
+}
+
+// Totals resume as visitas de um intervalo
+type Totals struct {
+	Visits   int64
+	Visitors int64 // soma dos visitantes únicos diários
 }
 
 // PostVisits representa o número de visitas de um post específico
@@ -226,76 +326,253 @@ type PostVisits struct {
 	Count     int64
 }
 
+// DimensionVisits representa as visitas de um valor de uma dimensão
+// (um navegador, um idioma...)
+type DimensionVisits struct {
+	Value string
+	Count int64
+}
+
 // GetPostVisitCount retorna o número total de visitas de um post específico
 func (a *AnalyticsModule) GetPostVisitCount(postID int) int64 {
 	if a == nil || a.db == nil {
 		return 0
 	}
 
-	var count int64
-	a.db.Model(&BlogEvent{}).Where("post_id = ?", postID).Count(&count)
-	return count
+	value := strconv.Itoa(postID)
+	rolledUp, ok := a.liveFrom()
+	if !ok {
+		// Nenhum rollup ainda: todas as visitas estão nos eventos
+		var count int64
+		a.db.Model(&BlogEvent{}).
+			Where("event = ? AND post_id = ?", "visit", postID).
+			Count(&count)
+		return count
+	}
+
+	// Meses fechados, os dias consolidados do mês corrente e os eventos
+	// que o job ainda não agregou
+	month := rolledUp.Format(monthLayout)
+	var months, days, pending int64
+	a.db.Model(&MonthlyRollup{}).
+		Select("COALESCE(SUM(visits), 0)").
+		Where("dimension = ? AND value = ? AND month < ?", DimensionPost, value, month).
+		Scan(&months)
+	a.db.Model(&DailyRollup{}).
+		Select("COALESCE(SUM(visits), 0)").
+		Where("dimension = ? AND value = ? AND day >= ? AND day < ?", DimensionPost, value, month+"-01", rolledUp.Format(dayLayout)).
+		Scan(&days)
+	a.db.Model(&BlogEvent{}).
+		Where("event = ? AND post_id = ? AND created_at >= ?", "visit", postID, rolledUp).
+		Count(&pending)
+	return months + days + pending
 }
 
-// GetVisitsByDay retorna o número de visitas por dia dos últimos N dias
-func (a *AnalyticsModule) GetVisitsByDay(blogID int, days int) []DayVisits {
+// GetTotals retorna visitas e visitantes do blog no intervalo
+func (a *AnalyticsModule) GetTotals(blogID int, r TimeRange) Totals {
+	var totals Totals
 	if a == nil || a.db == nil {
-		return []DayVisits{}
+		return totals
 	}
 
-	startDate := time.Now().AddDate(0, 0, -days)
+	pending, from := a.pendingRows(blogID, r, DimensionTotal)
+	consolidated(a.db.Model(&DailyRollup{}), from).
+		Select("COALESCE(SUM(visits), 0) AS visits, COALESCE(SUM(visitors), 0) AS visitors").
+		Where("blog_id = ? AND dimension = ? AND day >= ? AND day <= ?", blogID, DimensionTotal, r.FromKey(), r.ToKey()).
+		Scan(&totals)
+	for _, row := range pending {
+		totals.Visits += row.Visits
+		totals.Visitors += row.Visitors
+	}
+	return totals
+}
 
-	var results []struct {
-		Date  string
-		Count int64
+// GetVisitSeries retorna as visitas do intervalo agrupadas por dia, semana
+// ou mês (BucketDay, BucketWeek, BucketMonth), incluindo períodos sem visitas
+func (a *AnalyticsModule) GetVisitSeries(blogID int, r TimeRange, bucket string) []PeriodVisits {
+	if a == nil || a.db == nil {
+		return []PeriodVisits{}
 	}
 
-	a.db.Model(&BlogEvent{}).
-		Select("DATE(created_at) as date, COUNT(*) as count").
-		Where("blog_id = ? AND created_at >= ?", blogID, startDate).
-		Group("DATE(created_at)").
-		Order("date ASC").
+	type dayVisits struct {
+		Day      string
+		Visits   int64
+		Visitors int64
+	}
+	var results []dayVisits
+	pending, from := a.pendingRows(blogID, r, DimensionTotal)
+	consolidated(a.db.Model(&DailyRollup{}), from).
+		Select("day, visits, visitors").
+		Where("blog_id = ? AND dimension = ? AND day >= ? AND day <= ?", blogID, DimensionTotal, r.FromKey(), r.ToKey()).
 		Scan(&results)
+	for _, row := range pending {
+		results = append(results, dayVisits{row.Day, row.Visits, row.Visitors})
+	}
 
-	// Criar mapa com todos os dias dos últimos N dias
-	dayVisits := make([]DayVisits, days)
-	for i := 0; i < days; i++ {
-		date := time.Now().AddDate(0, 0, -(days - 1 - i))
-		dayVisits[i] = DayVisits{
-			Date:  date.Format("2006-01-02"),
-			Count: 0,
-		}
+	// Todos os períodos do intervalo, mesmo os sem visitas
+	var series []PeriodVisits
+	index := map[string]int{}
+	for start := bucketStart(r.From, bucket); !start.After(r.To); start = nextBucket(start, bucket) {
+		index[start.Format(dayLayout)] = len(series)
+		series = append(series, PeriodVisits{
+			Date:  start.Format(dayLayout),
+			Label: bucketLabel(start, bucket),
+		})
 	}
 
-	// Preencher com os dados reais
 	for _, result := range results {
-		for i := range dayVisits {
-			if dayVisits[i].Date == result.Date {
-				dayVisits[i].Count = result.Count
-				break
-			}
+		day, err := time.ParseInLocation(dayLayout, result.Day, r.From.Location())
+		if err != nil {
+			continue
+		}
+		if i, ok := index[bucketStart(day, bucket).Format(dayLayout)]; ok {
+			series[i].Count += result.Visits
+			series[i].Visitors += result.Visitors
 		}
 	}
 
-	return dayVisits
+	return series
 }
 
-// GetTopPosts retorna os N posts mais visitados dos últimos X dias
-func (a *AnalyticsModule) GetTopPosts(blogID int, days int, limit int) []PostVisits {
+// GetTopPosts retorna os N posts mais visitados no intervalo
+func (a *AnalyticsModule) GetTopPosts(blogID int, r TimeRange, limit int) []PostVisits {
 	if a == nil || a.db == nil {
 		return []PostVisits{}
 	}
 
-	startDate := time.Now().AddDate(0, 0, -days)
+	top := a.GetTopValues(blogID, DimensionPost, r, limit)
 
-	var results []PostVisits
-	a.db.Model(&BlogEvent{}).
-		Select("post_id as post_id, COUNT(*) as count").
-		Where("blog_id = ? AND post_id IS NOT NULL AND created_at >= ?", blogID, startDate).
-		Group("post_id").
-		Order("count DESC").
-		Limit(limit).
-		Scan(&results)
+	results := make([]PostVisits, 0, len(top))
+	for _, item := range top {
+		postID, err := strconv.Atoi(item.Value)
+		if err != nil {
+			continue
+		}
+		results = append(results, PostVisits{PostID: postID, Count: item.Count})
+	}
+	return results
+}
+
+// GetTopValues retorna os valores mais visitados de uma dimensão
+// (DimensionBrowser, DimensionLanguage...) no intervalo. Com limit <= 0
+// retorna todos.
+func (a *AnalyticsModule) GetTopValues(blogID int, dimension string, r TimeRange, limit int) []DimensionVisits {
+	if a == nil || a.db == nil {
+		return []DimensionVisits{}
+	}
+
+	pending, from := a.pendingRows(blogID, r, dimension)
+	query := consolidated(a.db.Model(&DailyRollup{}), from).
+		Select("value, SUM(visits) AS count").
+		Where("blog_id = ? AND dimension = ? AND day >= ? AND day <= ?", blogID, dimension, r.FromKey(), r.ToKey()).
+		Group("value").
+		Order("count DESC, value")
+	if limit > 0 && len(pending) == 0 {
+		query = query.Limit(limit)
+	}
+
+	var results []DimensionVisits
+	query.Scan(&results)
+	if len(pending) == 0 {
+		return results
+	}
 
+	// Os eventos pendentes podem mudar a ordem: soma e ordena aqui
+	index := make(map[string]int, len(results))
+	for i, item := range results {
+		index[item.Value] = i
+	}
+	for _, row := range pending {
+		if i, ok := index[row.Value]; ok {
+			results[i].Count += row.Visits
+			continue
+		}
+		index[row.Value] = len(results)
+		results = append(results, DimensionVisits{Value: row.Value, Count: row.Visits})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].Value < results[j].Value
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
 	return results
 }
+
+// ExportRow é uma linha da exportação: as visitas de um valor de uma
+// dimensão em um dia
+type ExportRow struct {
+	Day       string
+	Dimension string
+	Value     string
+	Visits    int64
+	Visitors  int64
+}
+
+// ExportDaily percorre os rollups diários do blog no intervalo chamando fn
+// linha a linha, sem carregar tudo em memória. Se fn retornar erro a
+// exportação para.
+func (a *AnalyticsModule) ExportDaily(blogID int, r TimeRange, dimensions []string, fn func(ExportRow) error) error {
+	if a == nil || a.db == nil {
+		return nil
+	}
+
+	pending, from := a.pendingRows(blogID, r, dimensions...)
+	rows, err := consolidated(a.db.Model(&DailyRollup{}), from).
+		Where("blog_id = ? AND day >= ? AND day <= ? AND dimension IN ?", blogID, r.FromKey(), r.ToKey(), dimensions).
+		Order("day, dimension, visits DESC, value").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rollup DailyRollup
+		if err := a.db.ScanRows(rows, &rollup); err != nil {
+			return err
+		}
+		if err := fn(ExportRow{
+			Day:       rollup.Day,
+			Dimension: rollup.Dimension,
+			Value:     rollup.Value,
+			Visits:    rollup.Visits,
+			Visitors:  rollup.Visitors,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Os dias pendentes vêm depois de todos os consolidados
+	sort.Slice(pending, func(i, j int) bool {
+		p, q := pending[i], pending[j]
+		if p.Day != q.Day {
+			return p.Day < q.Day
+		}
+		if p.Dimension != q.Dimension {
+			return p.Dimension < q.Dimension
+		}
+		if p.Visits != q.Visits {
+			return p.Visits > q.Visits
+		}
+		return p.Value < q.Value
+	})
+	for _, row := range pending {
+		if err := fn(ExportRow{
+			Day:       row.Day,
+			Dimension: row.Dimension,
+			Value:     row.Value,
+			Visits:    row.Visits,
+			Visitors:  row.Visitors,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package analytics
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Motivos pelos quais uma requisição é considerada robô (coluna motivo_bot)
+const (
+	BotUserAgent  = "user-agent"  // User-Agent vazio ou de crawler/biblioteca conhecida
+	BotHeaders    = "headers"     // faltam cabeçalhos que todo navegador manda
+	BotReverseDNS = "reverse-dns" // IP resolve para um crawler conhecido
+	BotRate       = "rate"        // requisições demais do mesmo cliente em pouco tempo
+)
+
+// Tratamento de robôs (variável ANALYTICS_BOTS)
+const (
+	// BotsDrop descarta as visitas de robôs. É o padrão.
+	BotsDrop = "drop"
+	// BotsTag grava as visitas com Event = "bot", fora das estatísticas
+	BotsTag = "tag"
+)
+
+const (
+	// botRateWindow e botRateLimit definem o comportamento suspeito:
+	// mais de botRateLimit páginas do mesmo cliente dentro da janela
+	botRateWindow = time.Minute
+	botRateLimit  = 60
+	// rdnsTimeout limita cada consulta de DNS reverso, feita fora da requisição
+	rdnsTimeout = 2 * time.Second
+	// rdnsCacheSize limita quantos IPs ficam com o resultado em memória
+	rdnsCacheSize = 10000
+	// rdnsQueueSize limita os IPs esperando consulta; com a fila cheia o IP
+	// fica para a próxima visita
+	rdnsQueueSize = 256
+)
+
+// botPatterns são trechos de User-Agent (em minúsculas) de crawlers,
+// ferramentas de monitoramento, geradores de preview e bibliotecas HTTP
+var botPatterns = []string{
+	"bot", "crawl", "spider", "slurp", "scrapy",
+	"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "httpx",
+	"go-http-client", "java/", "okhttp", "axios/", "node-fetch", "undici",
+	"libwww", "httpclient", "guzzlehttp", "headlesschrome", "phantomjs",
+	"lighthouse", "pingdom", "uptimerobot", "statuscake", "uptime-kuma",
+	"site24x7", "facebookexternalhit", "whatsapp", "skypeuripreview",
+	"embedly", "iframely", "ahrefs", "semrush", "mj12", "bytespider",
+	"ccbot", "gptbot", "perplexity", "feedly", "feedbin", "feedfetcher",
+	"feedburner", "newsblur", "inoreader", "w3c_validator",
+}
+
+// browserHeaders são cabeçalhos que os navegadores mandam em toda
+// requisição. Navegadores antigos ou com extensões de privacidade podem
+// omitir um deles, por isso só a falta de dois ou mais marca robô.
+var browserHeaders = []string{"Accept-Language", "Accept", "Sec-Fetch-Mode"}
+
+// crawlerHosts são domínios dos nomes reversos de crawlers de buscadores
+var crawlerHosts = []string{
+	"googlebot.com", "google.com", "googleusercontent.com", "search.msn.com",
+	"crawl.yahoo.net", "yandex.ru", "yandex.net", "yandex.com", "baidu.com",
+	"baidu.jp", "applebot.apple.com", "crawl.amazonbot.amazon",
+	"petalsearch.com", "crawl.bytedance.com",
+}
+
+// BotStats resume o que foi filtrado desde o início do processo
+type BotStats struct {
+	Mode     string
+	Checked  int64            // requisições analisadas
+	Filtered int64            // requisições classificadas como robô
+	ByReason map[string]int64 // robôs por motivo
+}
+
+// botClassifier decide se uma requisição veio de um robô. As regras vão da
+// mais barata para a mais cara, e a primeira que casar define o motivo.
+type botClassifier struct {
+	reverseDNS bool
+	lookupAddr func(ctx context.Context, ip string) ([]string, error)
+
+	rate *rateWindow
+
+	// O DNS reverso nunca roda na requisição: um IP novo entra na fila e
+	// o resultado vale a partir da visita seguinte
+	rdnsMu      sync.Mutex
+	rdnsCache   map[string]bool
+	rdnsPending map[string]bool
+	rdnsQueue   chan string
+	rdnsDone    chan struct{}
+
+	checked  atomic.Int64
+	byReason sync.Map // motivo -> *atomic.Int64
+}
+
+func newBotClassifier(reverseDNS bool) *botClassifier {
+	b := &botClassifier{
+		reverseDNS:  reverseDNS,
+		lookupAddr:  net.DefaultResolver.LookupAddr,
+		rate:        newRateWindow(botRateWindow),
+		rdnsCache:   make(map[string]bool),
+		rdnsPending: make(map[string]bool),
+	}
+	if reverseDNS {
+		b.rdnsQueue = make(chan string, rdnsQueueSize)
+		b.rdnsDone = make(chan struct{})
+		go b.resolveLoop()
+	}
+	return b
+}
+
+// close encerra as consultas de DNS reverso pendentes
+func (b *botClassifier) close() {
+	if b == nil || b.rdnsQueue == nil {
+		return
+	}
+	close(b.rdnsQueue)
+	<-b.rdnsDone
+}
+
+// botModeFromEnv lê ANALYTICS_BOTS; qualquer valor diferente de "tag" descarta
+func botModeFromEnv() string {
+	if os.Getenv("ANALYTICS_BOTS") == BotsTag {
+		return BotsTag
+	}
+	return BotsDrop
+}
+
+// classify retorna o motivo pelo qual a requisição é de um robô, ou ""
+// se parece uma pessoa
+func (b *botClassifier) classify(c *gin.Context, ip string) string {
+	if b == nil {
+		return ""
+	}
+	b.checked.Add(1)
+
+	reason := b.match(c, ip)
+	if reason != "" {
+		counter, _ := b.byReason.LoadOrStore(reason, new(atomic.Int64))
+		counter.(*atomic.Int64).Add(1)
+	}
+	return reason
+}
+
+func (b *botClassifier) match(c *gin.Context, ip string) string {
+	ua := strings.ToLower(c.Request.UserAgent())
+	if ua == "" || (!strings.HasPrefix(ua, "mozilla/") && !strings.HasPrefix(ua, "opera/")) {
+		return BotUserAgent
+	}
+	for _, pattern := range botPatterns {
+		if strings.Contains(ua, pattern) {
+			return BotUserAgent
+		}
+	}
+
+	missing := 0
+	for _, header := range browserHeaders {
+		if c.GetHeader(header) == "" {
+			missing++
+		}
+	}
+	if missing >= 2 {
+		return BotHeaders
+	}
+
+	// O contador é só de memória; o IP nunca é gravado
+	if b.rate.hit(ip+"|"+ua, time.Now()) > botRateLimit {
+		return BotRate
+	}
+
+	if b.reverseDNS && b.isCrawlerIP(ip) {
+		return BotReverseDNS
+	}
+	return ""
+}
+
+// isCrawlerIP responde pelo cache. Um IP ainda desconhecido vai para a
+// fila de consulta e, até a resposta chegar, conta como pessoa.
+func (b *botClassifier) isCrawlerIP(ip string) bool {
+	b.rdnsMu.Lock()
+	defer b.rdnsMu.Unlock()
+
+	if crawler, ok := b.rdnsCache[ip]; ok {
+		return crawler
+	}
+	if !b.rdnsPending[ip] {
+		select {
+		case b.rdnsQueue <- ip:
+			b.rdnsPending[ip] = true
+		default:
+		}
+	}
+	return false
+}
+
+// resolveLoop consulta o DNS reverso dos IPs da fila, um por vez
+func (b *botClassifier) resolveLoop() {
+	defer close(b.rdnsDone)
+
+	for ip := range b.rdnsQueue {
+		crawler, ok := b.lookupCrawler(ip)
+
+		b.rdnsMu.Lock()
+		delete(b.rdnsPending, ip)
+		if ok {
+			if len(b.rdnsCache) >= rdnsCacheSize {
+				b.rdnsCache = make(map[string]bool)
+			}
+			b.rdnsCache[ip] = crawler
+		}
+		b.rdnsMu.Unlock()
+	}
+}
+
+// lookupCrawler diz se o nome reverso do IP é de um crawler conhecido. ok
+// é false quando a consulta estourou o tempo e deve ser refeita depois.
+func (b *botClassifier) lookupCrawler(ip string) (crawler bool, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), rdnsTimeout)
+	defer cancel()
+	names, err := b.lookupAddr(ctx, ip)
+	if err != nil && ctx.Err() != nil {
+		return false, false
+	}
+
+	for _, name := range names {
+		host := strings.TrimSuffix(strings.ToLower(name), ".")
+		if matchesDomain(host, crawlerHosts) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+func (b *botClassifier) stats(mode string) BotStats {
+	stats := BotStats{
+		Mode:     mode,
+		Checked:  b.checked.Load(),
+		ByReason: map[string]int64{},
+	}
+	b.byReason.Range(func(key, value any) bool {
+		count := value.(*atomic.Int64).Load()
+		stats.ByReason[key.(string)] = count
+		stats.Filtered += count
+		return true
+	})
+	return stats
+}
+
+// rateWindow conta requisições por chave em janelas fixas; a cada janela
+// nova o mapa é descartado, então a memória fica limitada aos clientes
+// ativos no último intervalo
+type rateWindow struct {
+	mu     sync.Mutex
+	size   time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+func newRateWindow(size time.Duration) *rateWindow {
+	return &rateWindow{size: size, counts: make(map[string]int)}
+}
+
+// hit registra uma requisição e retorna quantas a chave fez na janela atual
+func (r *rateWindow) hit(key string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.start) >= r.size {
+		r.start = now
+		r.counts = make(map[string]int)
+	}
+	r.counts[key]++
+	return r.counts[key]
+}
@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const firefoxUA = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+func botTestContext(ua, lang string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.SetTrustedProxies(nil) // como em main.go
+	c.Request = httptest.NewRequest("GET", "/@/blog/", nil)
+	c.Request.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	c.Request.Header.Set("Sec-Fetch-Mode", "navigate")
+	if ua != "" {
+		c.Request.Header.Set("User-Agent", ua)
+	}
+	if lang != "" {
+		c.Request.Header.Set("Accept-Language", lang)
+	}
+	return c
+}
+
+func TestBotClassifier(t *testing.T) {
+	tests := []struct {
+		ua      string
+		lang    string
+		missing []string // cabeçalhos de navegador removidos
+		reason  string
+	}{
+		{firefoxUA, "pt-BR", nil, ""},
+		{"", "pt-BR", nil, BotUserAgent},
+		{"curl/8.5.0", "", nil, BotUserAgent},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "", nil, BotUserAgent},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0", "en-US", nil, BotUserAgent},
+		{"Mozilla/5.0 (compatible; Feedfetcher-Google; +http://www.google.com/feedfetcher.html)", "", nil, BotUserAgent},
+		// Um indício só não basta: navegador sem Accept-Language, ou Safari
+		// antigo sem Sec-Fetch-Mode
+		{firefoxUA, "", nil, ""},
+		{firefoxUA, "pt-BR", []string{"Sec-Fetch-Mode"}, ""},
+		{firefoxUA, "", []string{"Accept"}, BotHeaders},
+		{firefoxUA, "pt-BR", []string{"Accept", "Sec-Fetch-Mode"}, BotHeaders},
+	}
+
+	b := newBotClassifier(false)
+	for _, tt := range tests {
+		c := botTestContext(tt.ua, tt.lang)
+		for _, header := range tt.missing {
+			c.Request.Header.Del(header)
+		}
+		assert.Equal(t, tt.reason, b.classify(c, "203.0.113.1"), "%s %v", tt.ua, tt.missing)
+	}
+
+	stats := b.stats(BotsDrop)
+	assert.Equal(t, int64(len(tests)), stats.Checked)
+	assert.Equal(t, int64(7), stats.Filtered)
+	assert.Equal(t, int64(5), stats.ByReason[BotUserAgent])
+	assert.Equal(t, int64(2), stats.ByReason[BotHeaders])
+}
+
+func TestBotClassifier_BrowserUserAgents(t *testing.T) {
+	// Trechos genéricos como "fetch", "feed", "monitor" e "preview" não
+	// podem pegar navegadores de verdade
+	browsers := []string{
+		firefoxUA,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+		"Mozilla/5.0 (Linux; Android 13; Monitor-Preview Feed Build) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 Fetch",
+	}
+
+	b := newBotClassifier(false)
+	for _, ua := range browsers {
+		assert.Equal(t, "", b.classify(botTestContext(ua, "pt-BR"), "203.0.113.1"), ua)
+	}
+}
+
+func TestBotClassifier_ReverseDNSOffRequestPath(t *testing.T) {
+	b := newBotClassifier(true)
+	defer b.close()
+
+	release := make(chan struct{})
+	lookups := make(chan string, 4)
+	b.lookupAddr = func(ctx context.Context, ip string) ([]string, error) {
+		<-release
+		lookups <- ip
+		return []string{"crawl-66-249-66-1.googlebot.com."}, nil
+	}
+
+	// A consulta está travada, mas a requisição não espera por ela
+	start := time.Now()
+	assert.Equal(t, "", b.classify(botTestContext(firefoxUA, "pt-BR"), "66.249.66.1"))
+	assert.Equal(t, "", b.classify(botTestContext(firefoxUA, "pt-BR"), "66.249.66.1"))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, "66.249.66.1", <-lookups)
+	assert.Eventually(t, func() bool {
+		return b.classify(botTestContext(firefoxUA, "pt-BR"), "66.249.66.1") == BotReverseDNS
+	}, time.Second, 5*time.Millisecond)
+
+	// Um IP só é consultado uma vez, mesmo com várias visitas na fila
+	assert.Empty(t, lookups)
+}
+
+func TestBotClassifier_Rate(t *testing.T) {
+	b := newBotClassifier(false)
+	for i := 0; i < botRateLimit; i++ {
+		assert.Equal(t, "", b.classify(botTestContext(firefoxUA, "pt-BR"), "203.0.113.1"))
+	}
+	assert.Equal(t, BotRate, b.classify(botTestContext(firefoxUA, "pt-BR"), "203.0.113.1"))
+	// Outro cliente não é afetado
+	assert.Equal(t, "", b.classify(botTestContext(firefoxUA, "pt-BR"), "203.0.113.2"))
+
+	r := newRateWindow(time.Minute)
+	now := time.Now()
+	r.hit("a", now)
+	assert.Equal(t, 2, r.hit("a", now))
+	assert.Equal(t, 1, r.hit("a", now.Add(time.Minute)))
+}
+
+func TestTrackVisit_RateIgnoresForwardedFor(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db, ingest: newIngester(db), bots: newBotClassifier(false), botMode: BotsTag}
+
+	// Cada requisição traz outro X-Forwarded-For, mas vem da mesma conexão
+	for i := 0; i <= botRateLimit; i++ {
+		c := botTestContext(firefoxUA, "pt-BR")
+		c.Request.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		c.Request.Header.Set("X-Real-IP", fmt.Sprintf("198.51.100.%d", i))
+		a.TrackVisit(c, 1, nil)
+	}
+	a.ingest.close()
+
+	assert.Equal(t, []DimensionVisits{{Value: BotRate, Count: 1}}, a.GetBotEvents(LastDays(1, time.Now())))
+}
+
+func TestTrackVisit_TagsBots(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db, ingest: newIngester(db), bots: newBotClassifier(false), botMode: BotsTag}
+
+	a.TrackVisit(botTestContext("Wget/1.21", ""), 1, nil)
+	a.TrackVisit(botTestContext(firefoxUA, "pt-BR"), 1, nil)
+	a.ingest.close()
+
+	assert.Equal(t, []DimensionVisits{{Value: BotUserAgent, Count: 1}}, a.GetBotEvents(LastDays(1, time.Now())))
+
+	// Só a visita humana entra nas estatísticas
+	assert.NoError(t, a.Rollup(time.Now()))
+	days := a.GetVisitSeries(1, LastDays(1, time.Now()), BucketDay)
+	assert.Equal(t, int64(1), days[0].Count)
+}
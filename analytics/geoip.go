@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoReloadInterval é o intervalo entre verificações do arquivo GEOIP_DB
+const geoReloadInterval = time.Minute
+
+// geoResolver resolve o país de um IP usando um banco local no formato
+// MaxMind (GeoLite2-Country, DB-IP Lite Country...). Nenhuma consulta sai
+// do servidor. Quando o arquivo muda ele é recarregado sem reiniciar.
+type geoResolver struct {
+	path string
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// geoRecord lê só o campo usado; os dois formatos usam country.iso_code
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// newGeoResolver carrega o banco e começa a observar o arquivo. Sem path
+// retorna nil e os eventos ficam sem país; um arquivo ausente ou inválido
+// só gera log, e é carregado assim que aparecer.
+func newGeoResolver(path string) *geoResolver {
+	if path == "" {
+		return nil
+	}
+
+	g := &geoResolver{
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := g.reload(); err != nil {
+		log.Printf("GeoIP database not loaded, countries will be empty: %v", err)
+	}
+	go g.watch()
+	return g
+}
+
+// reload abre o arquivo se ele mudou desde a última carga
+func (g *geoResolver) reload() error {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return err
+	}
+
+	g.mu.RLock()
+	unchanged := g.reader != nil && info.ModTime().Equal(g.modTime)
+	g.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	reader, err := maxminddb.Open(g.path)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	old := g.reader
+	g.reader = reader
+	g.modTime = info.ModTime()
+	g.mu.Unlock()
+
+	// Com o lock de escrita obtido, nenhuma consulta usa mais o leitor antigo
+	if old != nil {
+		old.Close()
+	}
+	log.Printf("GeoIP database loaded: %s (%s, built %s)", g.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).Format(dayLayout))
+	return nil
+}
+
+func (g *geoResolver) watch() {
+	defer close(g.done)
+
+	ticker := time.NewTicker(geoReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			if err := g.reload(); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error reloading GeoIP database: %v", err)
+			}
+		}
+	}
+}
+
+// country retorna o código ISO do país do IP, ou nil se não for possível
+// resolver (sem banco, IP privado, IP desconhecido)
+func (g *geoResolver) country(ip string) *string {
+	if g == nil {
+		return nil
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.reader == nil {
+		return nil
+	}
+
+	var record geoRecord
+	if err := g.reader.Lookup(parsed, &record); err != nil || record.Country.ISOCode == "" {
+		return nil
+	}
+	code := strings.ToUpper(record.Country.ISOCode)
+	return &code
+}
+
+// close para a observação do arquivo e libera o banco
+func (g *geoResolver) close() {
+	if g == nil {
+		return
+	}
+	close(g.stop)
+	<-g.done
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reader != nil {
+		g.reader.Close()
+		g.reader = nil
+	}
+}
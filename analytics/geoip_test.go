@@ -0,0 +1,30 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoResolver_Disabled(t *testing.T) {
+	g := newGeoResolver("")
+	assert.Nil(t, g)
+	assert.Nil(t, g.country("8.8.8.8"))
+	g.close()
+}
+
+func TestGeoResolver_MissingOrInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+
+	g := newGeoResolver(path)
+	defer g.close()
+	assert.Nil(t, g.country("8.8.8.8"))
+
+	// Arquivo inválido não derruba nada e mantém as consultas vazias
+	os.WriteFile(path, []byte("isto não é um mmdb"), 0644)
+	assert.Error(t, g.reload())
+	assert.Nil(t, g.country("8.8.8.8"))
+	assert.Nil(t, g.country("não é um ip"))
+}
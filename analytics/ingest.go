@@ -0,0 +1,222 @@
+package analytics
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// dedupeWindow é o intervalo em que refreshes do mesmo visitante não contam
+	dedupeWindow = 30 * time.Minute
+	// dedupeSize limita quantos visitantes recentes ficam em memória
+	dedupeSize = 50000
+	// queueSize é a capacidade da fila; cheia, novos eventos são descartados
+	queueSize = 4096
+	// batchSize é o máximo de eventos gravados em um único INSERT
+	batchSize = 500
+	// flushInterval é o tempo máximo que um evento espera na fila
+	flushInterval = 5 * time.Second
+)
+
+// IngestStats resume o estado da fila de gravação
+type IngestStats struct {
+	Pending int   // eventos aguardando gravação
+	Written int64 // eventos gravados desde o início do processo
+	Dropped int64 // eventos descartados por fila cheia ou erro ao gravar
+}
+
+// ingester recebe eventos por um canal limitado e grava em lotes, sem
+// bloquear a requisição. Visitas repetidas dentro de dedupeWindow são
+// filtradas em memória antes de entrar na fila.
+type ingester struct {
+	db     *gorm.DB
+	events chan BlogEvent
+	recent *visitLRU
+	live   *liveHub // recebe todos os eventos, inclusive os repetidos
+
+	mu     sync.RWMutex // protege closed contra envio em canal fechado
+	closed bool
+	done   chan struct{}
+
+	written atomic.Int64
+	dropped atomic.Int64
+}
+
+func newIngester(db *gorm.DB) *ingester {
+	in := &ingester{
+		db:     db,
+		events: make(chan BlogEvent, queueSize),
+		recent: newVisitLRU(dedupeSize),
+		done:   make(chan struct{}),
+	}
+	go in.run()
+	return in
+}
+
+// enqueue coloca o evento na fila, a menos que seja repetido ou que a fila
+// esteja cheia
+func (in *ingester) enqueue(event BlogEvent) {
+	in.live.publish(event)
+
+	key := visitKey(event)
+	if !in.recent.seen(key, event.CreatedAt) {
+		return
+	}
+
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.closed {
+		return
+	}
+
+	select {
+	case in.events <- event:
+	default:
+		// Backpressure: descartar em vez de segurar a requisição
+		in.dropped.Add(1)
+		in.recent.forget(key)
+	}
+}
+
+func (in *ingester) run() {
+	defer close(in.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]BlogEvent, 0, batchSize)
+	var lastDropped int64
+	for {
+		select {
+		case event, ok := <-in.events:
+			if !ok {
+				in.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				in.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			in.flush(batch)
+			batch = batch[:0]
+
+			if dropped := in.dropped.Load(); dropped != lastDropped {
+				log.Printf("Analytics: %d events dropped so far (queue full or write errors)", dropped)
+				lastDropped = dropped
+			}
+		}
+	}
+}
+
+func (in *ingester) flush(batch []BlogEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := in.db.CreateInBatches(batch, batchSize).Error; err != nil {
+		log.Printf("Error saving %d analytics events: %v", len(batch), err)
+		in.dropped.Add(int64(len(batch)))
+		return
+	}
+	in.written.Add(int64(len(batch)))
+}
+
+// close para de aceitar eventos, grava o que está na fila e espera o
+// worker terminar
+func (in *ingester) close() {
+	in.mu.Lock()
+	if !in.closed {
+		in.closed = true
+		close(in.events)
+	}
+	in.mu.Unlock()
+
+	<-in.done
+}
+
+func (in *ingester) stats() IngestStats {
+	return IngestStats{
+		Pending: len(in.events),
+		Written: in.written.Load(),
+		Dropped: in.dropped.Load(),
+	}
+}
+
+// visitKey identifica visitante/blog/post; eventos que não são visitas
+// (leituras, robôs) são deduplicados separadamente
+func visitKey(event BlogEvent) string {
+	key := fmt.Sprintf("%s|%d|", event.CookieID, event.BlogID)
+	if event.PostID != nil {
+		key += strconv.Itoa(*event.PostID)
+	}
+	if event.Event != "" && event.Event != "visit" {
+		key = event.Event + "|" + key
+	}
+	return key
+}
+
+// visitLRU guarda o horário da última visita contada de cada chave
+// visitante/blog/post, descartando as menos recentes quando enche
+type visitLRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // frente = mais recente
+	entries map[string]*list.Element
+}
+
+type visitEntry struct {
+	key  string
+	seen time.Time
+}
+
+func newVisitLRU(size int) *visitLRU {
+	return &visitLRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// seen registra a visita e informa se ela deve ser contada, ou seja, se
+// não houve outra da mesma chave dentro de dedupeWindow
+func (l *visitLRU) seen(key string, at time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		entry := el.Value.(*visitEntry)
+		if at.Sub(entry.seen) < dedupeWindow {
+			return false
+		}
+		entry.seen = at
+		l.order.MoveToFront(el)
+		return true
+	}
+
+	l.entries[key] = l.order.PushFront(&visitEntry{key: key, seen: at})
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*visitEntry).key)
+	}
+	return true
+}
+
+// forget remove a chave, para que uma visita descartada possa ser contada depois
+func (l *visitLRU) forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		l.order.Remove(el)
+		delete(l.entries, key)
+	}
+}
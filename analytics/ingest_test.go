@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"harmonista/database/dbtest"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := dbtest.Open(t)
+	if err := RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestVisitLRU_DedupeWindow(t *testing.T) {
+	lru := newVisitLRU(10)
+	now := time.Now()
+
+	assert.True(t, lru.seen("a|1|", now))
+	assert.False(t, lru.seen("a|1|", now.Add(10*time.Minute)))
+	assert.True(t, lru.seen("a|1|2", now.Add(10*time.Minute)))
+	assert.True(t, lru.seen("a|1|", now.Add(31*time.Minute)))
+}
+
+func TestVisitLRU_EvictsOldest(t *testing.T) {
+	lru := newVisitLRU(2)
+	now := time.Now()
+
+	lru.seen("a", now)
+	lru.seen("b", now)
+	lru.seen("c", now)
+
+	assert.True(t, lru.seen("a", now), "a deveria ter sido descartada")
+	assert.False(t, lru.seen("c", now))
+}
+
+func TestIngester_FlushesOnClose(t *testing.T) {
+	db := setupTestDB(t)
+	in := newIngester(db)
+
+	postID := 7
+	now := time.Now()
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v1", Event: "visit", CreatedAt: now})
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v1", Event: "visit", CreatedAt: now}) // refresh
+	in.enqueue(BlogEvent{BlogID: 1, PostID: &postID, CookieID: "v1", Event: "visit", CreatedAt: now})
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v2", Event: "visit", CreatedAt: now})
+	in.close()
+
+	var count int64
+	db.Model(&BlogEvent{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, int64(3), in.stats().Written)
+
+	// Depois de fechado, novos eventos são ignorados sem pânico
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v3", Event: "visit", CreatedAt: now})
+}
+
+func TestIngester_DropsWhenQueueIsFull(t *testing.T) {
+	// Sem worker consumindo, a fila enche e o excedente é descartado
+	in := &ingester{
+		events: make(chan BlogEvent, 1),
+		recent: newVisitLRU(10),
+		done:   make(chan struct{}),
+	}
+
+	now := time.Now()
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v1", CreatedAt: now})
+	in.enqueue(BlogEvent{BlogID: 1, CookieID: "v2", CreatedAt: now})
+
+	assert.Equal(t, int64(1), in.stats().Dropped)
+	assert.Equal(t, 1, in.stats().Pending)
+	assert.True(t, in.recent.seen("v2|1|", now), "evento descartado não deve contar como visto")
+}
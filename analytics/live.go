@@ -0,0 +1,217 @@
+package analytics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// liveWindow é por quanto tempo um leitor conta como ativo depois da
+// última visita; o beacon de leitura o remove antes, quando ele sai
+const liveWindow = 5 * time.Minute
+
+// LivePost é um post com leitores ativos agora
+type LivePost struct {
+	PostID  int // 0 = páginas que não são posts (índice, páginas fixas)
+	Readers int
+}
+
+// LiveSnapshot é o retrato dos leitores ativos de um blog
+type LiveSnapshot struct {
+	Active int
+	Posts  []LivePost // do mais lido ao menos lido
+	At     time.Time
+}
+
+type liveReader struct {
+	postID int
+	seen   time.Time
+}
+
+// liveHub guarda quem está lendo cada blog e avisa os inscritos a cada
+// mudança. Os eventos chegam pelo ingester, antes da deduplicação, para
+// que refreshes mantenham o leitor ativo.
+type liveHub struct {
+	mu      sync.Mutex
+	readers map[int]map[string]liveReader          // blog -> visitante
+	subs    map[int]map[chan LiveSnapshot]struct{} // blog -> inscritos
+	closed  bool
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{
+		readers: make(map[int]map[string]liveReader),
+		subs:    make(map[int]map[chan LiveSnapshot]struct{}),
+	}
+}
+
+// publish atualiza os leitores do blog do evento. Visitas marcam o leitor
+// como ativo no post; leituras (o beacon ao sair da página) o removem.
+func (h *liveHub) publish(event BlogEvent) {
+	if h == nil {
+		return
+	}
+	if event.Event != "visit" && event.Event != EventRead {
+		return
+	}
+	postID := 0
+	if event.PostID != nil {
+		postID = *event.PostID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	readers := h.readers[event.BlogID]
+	if event.Event == EventRead {
+		if reader, ok := readers[event.CookieID]; !ok || reader.postID != postID {
+			return
+		}
+		delete(readers, event.CookieID)
+	} else {
+		if readers == nil {
+			readers = make(map[string]liveReader)
+			h.readers[event.BlogID] = readers
+		}
+		readers[event.CookieID] = liveReader{postID: postID, seen: event.CreatedAt}
+	}
+
+	h.broadcast(event.BlogID, h.snapshotLocked(event.BlogID, time.Now()))
+}
+
+// broadcast envia o retrato sem bloquear: quem ainda não leu o anterior
+// recebe só o mais novo
+func (h *liveHub) broadcast(blogID int, snapshot LiveSnapshot) {
+	for ch := range h.subs[blogID] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
+
+// snapshotLocked descarta os leitores inativos e conta os restantes por post
+func (h *liveHub) snapshotLocked(blogID int, now time.Time) LiveSnapshot {
+	snapshot := LiveSnapshot{Posts: []LivePost{}, At: now}
+	readers := h.readers[blogID]
+
+	perPost := make(map[int]int)
+	for id, reader := range readers {
+		if now.Sub(reader.seen) > liveWindow {
+			delete(readers, id)
+			continue
+		}
+		perPost[reader.postID]++
+	}
+	if len(readers) == 0 {
+		delete(h.readers, blogID)
+	}
+
+	for postID, count := range perPost {
+		snapshot.Active += count
+		snapshot.Posts = append(snapshot.Posts, LivePost{PostID: postID, Readers: count})
+	}
+	sort.Slice(snapshot.Posts, func(i, j int) bool {
+		if snapshot.Posts[i].Readers != snapshot.Posts[j].Readers {
+			return snapshot.Posts[i].Readers > snapshot.Posts[j].Readers
+		}
+		return snapshot.Posts[i].PostID < snapshot.Posts[j].PostID
+	})
+	return snapshot
+}
+
+// snapshot retorna os leitores ativos do blog agora
+func (h *liveHub) snapshot(blogID int, now time.Time) LiveSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.snapshotLocked(blogID, now)
+}
+
+// subscribe inscreve no blog. O canal é fechado por cancel ou quando o hub
+// é encerrado.
+func (h *liveHub) subscribe(blogID int) (<-chan LiveSnapshot, func()) {
+	ch := make(chan LiveSnapshot, 1)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[blogID] == nil {
+		h.subs[blogID] = make(map[chan LiveSnapshot]struct{})
+	}
+	h.subs[blogID][ch] = struct{}{}
+	ch <- h.snapshotLocked(blogID, time.Now())
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if _, ok := h.subs[blogID][ch]; ok {
+				delete(h.subs[blogID], ch)
+				if len(h.subs[blogID]) == 0 {
+					delete(h.subs, blogID)
+				}
+				close(ch)
+			}
+		})
+	}
+	return ch, cancel
+}
+
+// close fecha todos os canais inscritos, encerrando os streams abertos
+func (h *liveHub) close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for blogID, subs := range h.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(h.subs, blogID)
+	}
+}
+
+// SubscribeLive inscreve nos leitores ativos do blog. O primeiro retrato
+// chega de imediato; os seguintes a cada visita ou saída. cancel deve ser
+// chamado quando o cliente desconectar.
+func (a *AnalyticsModule) SubscribeLive(blogID int) (<-chan LiveSnapshot, func()) {
+	if a == nil || a.live == nil {
+		ch := make(chan LiveSnapshot)
+		close(ch)
+		return ch, func() {}
+	}
+	return a.live.subscribe(blogID)
+}
+
+// LiveVisitors retorna os leitores ativos do blog agora. Os inativos só
+// saem da contagem quando alguém consulta, então os streams chamam isto
+// periodicamente além de ouvir SubscribeLive.
+func (a *AnalyticsModule) LiveVisitors(blogID int) LiveSnapshot {
+	if a == nil || a.live == nil {
+		return LiveSnapshot{Posts: []LivePost{}, At: time.Now()}
+	}
+	return a.live.snapshot(blogID, time.Now())
+}
+
+// StopLive encerra os streams ao vivo. Deve ser chamado antes do Shutdown
+// do servidor, que de outra forma esperaria pelas conexões abertas.
+func (a *AnalyticsModule) StopLive() {
+	if a == nil {
+		return
+	}
+	a.live.close()
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveHub_PublishesToBlogSubscribers(t *testing.T) {
+	h := newLiveHub()
+	updates, cancel := h.subscribe(1)
+	other, cancelOther := h.subscribe(2)
+	defer cancelOther()
+
+	// O retrato inicial chega na inscrição
+	assert.Equal(t, 0, (<-updates).Active)
+	<-other
+
+	postID := 7
+	now := time.Now()
+	h.publish(BlogEvent{BlogID: 1, PostID: &postID, CookieID: "v1", Event: "visit", CreatedAt: now})
+	h.publish(BlogEvent{BlogID: 1, CookieID: "v2", Event: "visit", CreatedAt: now})
+	h.publish(BlogEvent{BlogID: 1, CookieID: "v3", Event: "bot", CreatedAt: now})
+
+	// Só o último retrato fica no canal
+	snapshot := <-updates
+	assert.Equal(t, 2, snapshot.Active)
+	assert.Equal(t, []LivePost{{PostID: 0, Readers: 1}, {PostID: 7, Readers: 1}}, snapshot.Posts)
+
+	// Inscritos de outro blog não recebem nada
+	select {
+	case <-other:
+		t.Fatal("blog 2 não deveria receber eventos do blog 1")
+	default:
+	}
+
+	// O beacon de leitura tira o leitor do post
+	h.publish(BlogEvent{BlogID: 1, PostID: &postID, CookieID: "v1", Event: EventRead, CreatedAt: now})
+	assert.Equal(t, []LivePost{{PostID: 0, Readers: 1}}, (<-updates).Posts)
+
+	cancel()
+	_, ok := <-updates
+	assert.False(t, ok)
+}
+
+func TestLiveHub_ExpiresInactiveReaders(t *testing.T) {
+	h := newLiveHub()
+	now := time.Now()
+	h.publish(BlogEvent{BlogID: 1, CookieID: "v1", Event: "visit", CreatedAt: now.Add(-liveWindow - time.Second)})
+	h.publish(BlogEvent{BlogID: 1, CookieID: "v2", Event: "visit", CreatedAt: now})
+
+	assert.Equal(t, 1, h.snapshot(1, now).Active)
+	assert.Equal(t, 0, h.snapshot(1, now.Add(liveWindow+time.Second)).Active)
+	assert.Empty(t, h.readers)
+}
+
+func TestLiveHub_CloseEndsStreams(t *testing.T) {
+	h := newLiveHub()
+	updates, cancel := h.subscribe(1)
+	<-updates
+
+	h.close()
+	_, ok := <-updates
+	assert.False(t, ok)
+	cancel() // não deve fechar o canal de novo
+
+	// Inscrições depois do encerramento já nascem fechadas
+	late, _ := h.subscribe(1)
+	_, ok = <-late
+	assert.False(t, ok)
+}
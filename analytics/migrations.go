@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"harmonista/database"
+)
+
+// Structs congeladas do schema de analytics, como em database/schema.go:
+// mudanças nos models entram como uma nova migração no fim da lista.
+
+type blogEventV1 struct {
+	ID           uint   `gorm:"primary_key;autoIncrement"`
+	BlogID       int    `gorm:"not null;index"`
+	PostID       *int   `gorm:"index"`
+	CookieID     string `gorm:"not null;index"`
+	Event        string `gorm:"not null;default:'visit'"`
+	Pais         *string
+	Lingua       *string
+	Navegador    *string
+	Origem       *string `gorm:"size:255"`
+	TipoOrigem   *string `gorm:"size:16"`
+	UtmSource    *string `gorm:"size:100"`
+	UtmMedium    *string `gorm:"size:100"`
+	UtmCampaign  *string `gorm:"size:100"`
+	MotivoBot    *string `gorm:"size:16"`
+	Profundidade *int
+	TempoLeitura *int
+	CreatedAt    time.Time `gorm:"index"`
+}
+
+func (blogEventV1) TableName() string { return "blog_events" }
+
+type dailyRollupV1 struct {
+	ID        uint   `gorm:"primary_key;autoIncrement"`
+	BlogID    int    `gorm:"not null;uniqueIndex:idx_daily_rollup"`
+	Day       string `gorm:"not null;size:10;uniqueIndex:idx_daily_rollup"`
+	Dimension string `gorm:"not null;size:32;uniqueIndex:idx_daily_rollup"`
+	Value     string `gorm:"not null;size:255;uniqueIndex:idx_daily_rollup"`
+	Visits    int64  `gorm:"not null;default:0"`
+	Visitors  int64  `gorm:"not null;default:0"`
+}
+
+func (dailyRollupV1) TableName() string { return "analytics_daily" }
+
+type monthlyRollupV1 struct {
+	ID        uint   `gorm:"primary_key;autoIncrement"`
+	BlogID    int    `gorm:"not null;uniqueIndex:idx_monthly_rollup"`
+	Month     string `gorm:"not null;size:7;uniqueIndex:idx_monthly_rollup"`
+	Dimension string `gorm:"not null;size:32;uniqueIndex:idx_monthly_rollup"`
+	Value     string `gorm:"not null;size:255;uniqueIndex:idx_monthly_rollup"`
+	Visits    int64  `gorm:"not null;default:0"`
+	Visitors  int64  `gorm:"not null;default:0"`
+}
+
+func (monthlyRollupV1) TableName() string { return "analytics_monthly" }
+
+var schemaV1 = []any{&blogEventV1{}, &dailyRollupV1{}, &monthlyRollupV1{}}
+
+// Migrations é o histórico do schema do banco de analytics, que é separado
+// do principal e tem a sua própria tabela schema_migrations
+var Migrations = []database.Migration{
+	{
+		// Schema de antes das migrações versionadas; bancos existentes só
+		// ganham as colunas e tabelas que faltam
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(schemaV1...)
+		},
+		Down: func(tx *gorm.DB) error {
+			for i := len(schemaV1) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(schemaV1[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Versões antigas guardavam o IP de cada visita; a coluna sai junto
+		// com os dados. Desfazer devolve a coluna, vazia.
+		Version: 2,
+		Name:    "drop_visitor_ip",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&blogEventV1{}, "ip") {
+				return nil
+			}
+			// No SQLite o DropColumn do gorm recria a tabela e perde os
+			// índices; o ALTER TABLE mantém
+			return tx.Exec("ALTER TABLE blog_events DROP COLUMN ip").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE blog_events ADD COLUMN ip VARCHAR(64)").Error
+		},
+	},
+}
+
+// RunMigrations aplica as migrações pendentes do banco de analytics
+func RunMigrations(db *gorm.DB) error {
+	migrator, err := database.NewMigrator(db, Migrations)
+	if err != nil {
+		return err
+	}
+	count, err := migrator.Up()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("Analytics migrations applied: %d", count)
+	}
+	return nil
+}
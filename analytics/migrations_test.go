@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/database"
+	"harmonista/database/dbtest"
+)
+
+// blogEventLegacy é a tabela como as versões com IP a criavam
+type blogEventLegacy struct {
+	ID        uint   `gorm:"primary_key;autoIncrement"`
+	BlogID    int    `gorm:"not null;index"`
+	PostID    *int   `gorm:"index"`
+	CookieID  string `gorm:"not null;index"`
+	Event     string `gorm:"not null;default:'visit'"`
+	IP        string `gorm:"not null"`
+	Pais      *string
+	Lingua    *string
+	Navegador *string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (blogEventLegacy) TableName() string { return "blog_events" }
+
+func TestMigrations_DropLegacyIP(t *testing.T) {
+	db := dbtest.Open(t)
+	assert.NoError(t, db.AutoMigrate(&blogEventLegacy{}))
+	db.Create(&blogEventLegacy{BlogID: 1, CookieID: "a", Event: "visit", IP: "203.0.113.7", CreatedAt: time.Now()})
+
+	assert.NoError(t, RunMigrations(db))
+
+	assert.False(t, db.Migrator().HasColumn(&BlogEvent{}, "ip"))
+	assert.True(t, db.Migrator().HasIndex(&BlogEvent{}, "CookieID"), "os índices ficam")
+	assert.True(t, db.Migrator().HasColumn(&BlogEvent{}, "origem"))
+	var events []BlogEvent
+	db.Find(&events)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "a", events[0].CookieID)
+
+	// Rodar de novo não faz nada
+	assert.NoError(t, RunMigrations(db))
+}
+
+func TestMigrations_RoundTrip(t *testing.T) {
+	db := dbtest.Open(t)
+	assert.NoError(t, RunMigrations(db))
+
+	migrator, err := database.NewMigrator(db, Migrations)
+	assert.NoError(t, err)
+	count, err := migrator.Down(len(Migrations))
+	assert.NoError(t, err)
+	assert.Equal(t, len(Migrations), count)
+	for _, table := range schemaV1 {
+		assert.False(t, db.Migrator().HasTable(table))
+	}
+
+	assert.NoError(t, RunMigrations(db))
+	assert.True(t, db.Migrator().HasTable(&BlogEvent{}))
+	assert.False(t, db.Migrator().HasColumn(&BlogEvent{}, "ip"))
+}
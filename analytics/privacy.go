@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Modos de identificação do visitante (variável ANALYTICS_MODE)
+const (
+	// ModeCookieless identifica visitas por um hash diário de IP+UA+blog,
+	// sem gravar cookies nem o IP. É o padrão.
+	ModeCookieless = "cookieless"
+	// ModeCookie usa o cookie harmonista_visitor_id de 2 anos (comportamento antigo)
+	ModeCookie = "cookie"
+)
+
+// modeFromEnv lê ANALYTICS_MODE; qualquer valor diferente de "cookie" cai no modo sem cookies
+func modeFromEnv() string {
+	if os.Getenv("ANALYTICS_MODE") == ModeCookie {
+		return ModeCookie
+	}
+	return ModeCookieless
+}
+
+// dailySalt é um sal aleatório que troca a cada dia (UTC) e só existe em
+// memória. Sem ele não é possível recalcular o hash a partir de um IP, e
+// visitas de dias diferentes não podem ser ligadas ao mesmo visitante.
+type dailySalt struct {
+	mu   sync.Mutex
+	day  string
+	salt []byte
+}
+
+func (s *dailySalt) current(now time.Time) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := now.UTC().Format("2006-01-02")
+	if day != s.day || s.salt == nil {
+		salt := make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			// Sem aleatoriedade não há como anonimizar; o hash do horário
+			// ainda evita reaproveitar o sal do dia anterior
+			sum := sha256.Sum256([]byte(now.String()))
+			salt = sum[:]
+		}
+		s.day = day
+		s.salt = salt
+	}
+	return s.salt
+}
+
+// visitorHash identifica o visitante dentro de um dia e de um blog
+func (s *dailySalt) visitorHash(now time.Time, ip, userAgent string, blogID int) string {
+	h := sha256.New()
+	h.Write(s.current(now))
+	h.Write([]byte(ip))
+	h.Write([]byte{0})
+	h.Write([]byte(userAgent))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(blogID)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// doNotTrack indica se o navegador pediu para não ser rastreado
+// (cabeçalhos DNT ou Sec-GPC)
+func doNotTrack(c *gin.Context) bool {
+	return c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1"
+}
@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailySalt_RotatesEachDay(t *testing.T) {
+	var s dailySalt
+	morning := time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 5, 10, 23, 59, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 5, 11, 0, 1, 0, 0, time.UTC)
+
+	first := s.visitorHash(morning, "203.0.113.7", firefoxUA, 1)
+	assert.Equal(t, first, s.visitorHash(night, "203.0.113.7", firefoxUA, 1), "mesmo dia, mesmo visitante")
+	assert.NotEqual(t, first, s.visitorHash(morning, "203.0.113.7", firefoxUA, 2), "outro blog")
+	assert.NotEqual(t, first, s.visitorHash(nextDay, "203.0.113.7", firefoxUA, 1), "o sal troca à meia-noite UTC")
+
+	// O sal só existe em memória: outro processo não chega ao mesmo hash
+	var other dailySalt
+	assert.NotEqual(t, first, other.visitorHash(morning, "203.0.113.7", firefoxUA, 1))
+}
+
+func TestVisitorHash_DoesNotContainIP(t *testing.T) {
+	var s dailySalt
+	ip := "203.0.113.7"
+	hash := s.visitorHash(time.Now(), ip, firefoxUA, 1)
+
+	assert.Len(t, hash, 64)
+	assert.NotContains(t, hash, ip)
+	assert.NotContains(t, hash, strings.ReplaceAll(ip, ".", ""))
+}
+
+func TestTrackVisit_StoresNoIP(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db, ingest: newIngester(db), bots: newBotClassifier(false)}
+
+	c := botTestContext(firefoxUA, "pt-BR")
+	c.Request.Header.Set("X-Forwarded-For", "203.0.113.7")
+	a.TrackVisit(c, 1, nil)
+	a.ingest.close()
+
+	assert.False(t, db.Migrator().HasColumn(&BlogEvent{}, "ip"))
+	assert.Empty(t, c.Writer.Header().Values("Set-Cookie"), "o modo sem cookies não grava cookie")
+
+	var rows []map[string]any
+	db.Table("blog_events").Find(&rows)
+	assert.Len(t, rows, 1)
+	for column, value := range rows[0] {
+		if s, ok := value.(string); ok {
+			assert.NotContains(t, s, "203.0.113.7", column)
+		}
+	}
+}
+
+func TestTrackVisit_HonorsDoNotTrack(t *testing.T) {
+	for _, header := range []string{"DNT", "Sec-GPC"} {
+		t.Run(header, func(t *testing.T) {
+			db := setupTestDB(t)
+			a := &AnalyticsModule{db: db, ingest: newIngester(db), bots: newBotClassifier(false)}
+
+			c := botTestContext(firefoxUA, "pt-BR")
+			c.Request.Header.Set(header, "1")
+			a.TrackVisit(c, 1, nil)
+			a.TrackRead(c, 1, 3, 80, 60)
+
+			// Com o cabeçalho em "0" a visita conta normalmente
+			c = botTestContext(firefoxUA, "pt-BR")
+			c.Request.Header.Set(header, "0")
+			a.TrackVisit(c, 2, nil)
+			a.ingest.close()
+
+			var events []BlogEvent
+			db.Find(&events)
+			assert.Len(t, events, 1)
+			assert.Equal(t, 2, events[0].BlogID)
+		})
+	}
+}
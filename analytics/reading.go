@@ -0,0 +1,194 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventRead é o evento enviado pelo beacon de leitura ao sair de um post
+const EventRead = "read"
+
+// MaxReadSeconds limita o tempo de leitura aceito; abas esquecidas abertas
+// não devem distorcer a mediana
+const MaxReadSeconds = 2 * 60 * 60
+
+// readDepths são as faixas de profundidade aceitas, em % do post lido
+var readDepths = []int{0, 25, 50, 75, 100}
+
+// readTimeBuckets são os limites inferiores, em segundos, das faixas do
+// histograma de tempo de leitura. A mediana é estimada a partir dele, já
+// que os rollups só guardam contagens.
+var readTimeBuckets = []int{0, 5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 240, 300, 420, 600, 900, 1200, 1800, 3600}
+
+// ValidReadDepth informa se a profundidade é uma das faixas do beacon
+func ValidReadDepth(depth int) bool {
+	for _, d := range readDepths {
+		if d == depth {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackRead registra até onde um post foi lido e por quanto tempo. Segue as
+// mesmas regras de TrackVisit: DNT, robôs e uma leitura por visitante a
+// cada dedupeWindow.
+func (a *AnalyticsModule) TrackRead(c *gin.Context, blogID int, postID int, depth int, seconds int) {
+	if a == nil || a.db == nil {
+		return
+	}
+	if doNotTrack(c) {
+		return
+	}
+	if a.bots.classify(c, c.ClientIP()) != "" {
+		return
+	}
+	if seconds > MaxReadSeconds {
+		seconds = MaxReadSeconds
+	}
+
+	a.ingest.enqueue(BlogEvent{
+		BlogID:       blogID,
+		PostID:       &postID,
+		CookieID:     a.visitorID(c, blogID),
+		Event:        EventRead,
+		Profundidade: &depth,
+		TempoLeitura: &seconds,
+		CreatedAt:    time.Now(),
+	})
+}
+
+// readTimeBucketSQL monta o CASE que coloca tempo_leitura na sua faixa
+func readTimeBucketSQL() string {
+	var sql strings.Builder
+	sql.WriteString("CASE")
+	for i := len(readTimeBuckets) - 1; i > 0; i-- {
+		fmt.Fprintf(&sql, " WHEN tempo_leitura >= %d THEN '%d'", readTimeBuckets[i], readTimeBuckets[i])
+	}
+	sql.WriteString(" ELSE '0' END")
+	return sql.String()
+}
+
+// PostReading resume o engajamento de leitura de um post
+type PostReading struct {
+	PostID         int
+	PostTitle      string
+	Reads          int64   // leituras medidas pelo beacon
+	CompletionRate float64 // % das leituras que chegaram ao fim do post
+	MedianSeconds  int     // tempo mediano na página (estimado pelo histograma)
+}
+
+// GetReadingStats retorna os posts com mais leituras medidas no intervalo
+func (a *AnalyticsModule) GetReadingStats(blogID int, r TimeRange, limit int) []PostReading {
+	if a == nil || a.db == nil {
+		return []PostReading{}
+	}
+
+	type readingRow struct {
+		Dimension string
+		Value     string
+		Visits    int64
+	}
+	var rows []readingRow
+	pending, from := a.pendingRows(blogID, r, DimensionReadDepth, DimensionReadTime)
+	consolidated(a.db.Model(&DailyRollup{}), from).
+		Select("dimension, value, SUM(visits) AS visits").
+		Where("blog_id = ? AND dimension IN ? AND day >= ? AND day <= ?", blogID, []string{DimensionReadDepth, DimensionReadTime}, r.FromKey(), r.ToKey()).
+		Group("dimension, value").
+		Scan(&rows)
+	for _, row := range pending {
+		rows = append(rows, readingRow{row.Dimension, row.Value, row.Visits})
+	}
+
+	type histogram map[int]int64 // faixa -> leituras
+	depths := map[int]histogram{}
+	times := map[int]histogram{}
+	for _, row := range rows {
+		postID, bucket, ok := splitPostValue(row.Value)
+		if !ok {
+			continue
+		}
+		target := depths
+		if row.Dimension == DimensionReadTime {
+			target = times
+		}
+		if target[postID] == nil {
+			target[postID] = histogram{}
+		}
+		target[postID][bucket] += row.Visits
+	}
+
+	results := make([]PostReading, 0, len(depths))
+	for postID, depth := range depths {
+		var reads int64
+		for _, count := range depth {
+			reads += count
+		}
+		if reads == 0 {
+			continue
+		}
+		results = append(results, PostReading{
+			PostID:         postID,
+			Reads:          reads,
+			CompletionRate: float64(depth[100]) / float64(reads) * 100,
+			MedianSeconds:  medianFromHistogram(times[postID]),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Reads != results[j].Reads {
+			return results[i].Reads > results[j].Reads
+		}
+		return results[i].PostID < results[j].PostID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// splitPostValue separa valores "postID:faixa" das dimensões de leitura
+func splitPostValue(value string) (postID int, bucket int, ok bool) {
+	post, rest, found := strings.Cut(value, ":")
+	if !found {
+		return 0, 0, false
+	}
+	postID, err1 := strconv.Atoi(post)
+	bucket, err2 := strconv.Atoi(rest)
+	return postID, bucket, err1 == nil && err2 == nil
+}
+
+// medianFromHistogram estima a mediana interpolando dentro da faixa onde
+// está a leitura do meio
+func medianFromHistogram(counts map[int]int64) int {
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	half := float64(total) / 2
+	var cumulative int64
+	for i, lower := range readTimeBuckets {
+		count := counts[lower]
+		if count == 0 {
+			continue
+		}
+		if float64(cumulative+count) >= half {
+			if i+1 == len(readTimeBuckets) {
+				return lower
+			}
+			width := float64(readTimeBuckets[i+1] - lower)
+			return lower + int(width*(half-float64(cumulative))/float64(count))
+		}
+		cumulative += count
+	}
+	return readTimeBuckets[len(readTimeBuckets)-1]
+}
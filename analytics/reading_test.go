@@ -0,0 +1,44 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedianFromHistogram(t *testing.T) {
+	assert.Equal(t, 0, medianFromHistogram(nil))
+	// 1 leitura em [60, 90) e 1 em [120, 180): o meio fica no fim da primeira faixa
+	assert.Equal(t, 90, medianFromHistogram(map[int]int64{60: 1, 120: 1}))
+	// Todas na mesma faixa: metade da faixa
+	assert.Equal(t, 75, medianFromHistogram(map[int]int64{60: 4}))
+	assert.Equal(t, 3600, medianFromHistogram(map[int]int64{3600: 3}))
+}
+
+func TestGetReadingStats(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db}
+
+	now := time.Now()
+	postID := 5
+	depth := func(d int) *int { return &d }
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, PostID: &postID, CookieID: "a", Event: EventRead, Profundidade: depth(100), TempoLeitura: depth(200), CreatedAt: now},
+		{BlogID: 1, PostID: &postID, CookieID: "b", Event: EventRead, Profundidade: depth(25), TempoLeitura: depth(12), CreatedAt: now},
+		{BlogID: 1, PostID: &postID, CookieID: "c", Event: EventRead, Profundidade: depth(100), TempoLeitura: depth(190), CreatedAt: now},
+		{BlogID: 1, PostID: &postID, CookieID: "d", Event: EventRead, Profundidade: depth(50), TempoLeitura: depth(40), CreatedAt: now},
+		{BlogID: 1, PostID: &postID, CookieID: "a", Event: "visit", CreatedAt: now},
+	})
+	assert.NoError(t, a.Rollup(now))
+
+	stats := a.GetReadingStats(1, LastDays(30, now), 10)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, int64(4), stats[0].Reads)
+		assert.Equal(t, 50.0, stats[0].CompletionRate)
+		assert.Equal(t, 45, stats[0].MedianSeconds)
+	}
+
+	// Leituras não contam como visitas
+	assert.Equal(t, int64(1), a.GetVisitSeries(1, LastDays(1, now), BucketDay)[0].Count)
+}
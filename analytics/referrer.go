@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tipos de origem de uma visita (coluna tipo_origem)
+const (
+	ReferrerSearch   = "search"   // buscadores
+	ReferrerSocial   = "social"   // redes sociais
+	ReferrerDirect   = "direct"   // sem Referer (digitado, favoritos, apps)
+	ReferrerInternal = "internal" // outra página do Harmonista (/leia, outro blog...)
+	ReferrerOther    = "other"    // qualquer outro site
+)
+
+// maxUTMLength limita o tamanho dos parâmetros utm_* gravados
+const maxUTMLength = 100
+
+// searchEngines e socialNetworks são comparados com o host sem "www.";
+// um item casa com o próprio domínio e com os subdomínios dele
+var searchEngines = []string{
+	"google.com", "bing.com", "duckduckgo.com", "search.yahoo.com", "yandex.ru",
+	"yandex.com", "ecosia.org", "baidu.com", "search.brave.com", "startpage.com",
+	"kagi.com", "qwant.com",
+}
+
+var socialNetworks = []string{
+	"facebook.com", "fb.com", "instagram.com", "t.co", "twitter.com", "x.com",
+	"linkedin.com", "lnkd.in", "reddit.com", "news.ycombinator.com", "bsky.app",
+	"threads.net", "mastodon.social", "whatsapp.com", "t.me", "youtube.com",
+	"pinterest.com", "tiktok.com", "tumblr.com",
+}
+
+// referrerOrigin reduz o Referer ao host de origem e classifica a visita.
+// Caminhos e query strings de sites externos nunca são gravados; de páginas
+// do próprio Harmonista fica só a seção (/leia, /@/blog), que é pública.
+func referrerOrigin(referer, baseHost string) (origin *string, kind string) {
+	if referer == "" {
+		return nil, ReferrerDirect
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return nil, ReferrerDirect
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	if baseHost != "" && (host == baseHost || strings.HasSuffix(host, "."+baseHost)) {
+		section := internalSection(u.Path)
+		if sub := strings.TrimSuffix(host, "."+baseHost); sub != host {
+			// Blog acessado pelo subdomínio (blog.dominio)
+			section = "/@/" + sub
+		}
+		return &section, ReferrerInternal
+	}
+
+	switch {
+	case matchesDomain(host, searchEngines) || isGoogle(host):
+		kind = ReferrerSearch
+	case matchesDomain(host, socialNetworks):
+		kind = ReferrerSocial
+	default:
+		kind = ReferrerOther
+	}
+	return &host, kind
+}
+
+// internalSection identifica de onde, dentro do Harmonista, veio a visita
+func internalSection(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "leia":
+		return "/leia"
+	case parts[0] == "@" && len(parts) > 1 && parts[1] != "":
+		// Inclui respostas publicadas em outros blogs
+		return "/@/" + parts[1]
+	case parts[0] == "admin":
+		return "/admin"
+	default:
+		return "/"
+	}
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGoogle cobre os domínios nacionais (google.com.br, google.pt...)
+func isGoogle(host string) bool {
+	return strings.HasPrefix(host, "google.") || strings.Contains(host, ".google.")
+}
+
+// baseHostFromEnv retorna o host de DOMAIN, sem protocolo, porta e "www."
+func baseHostFromEnv() string {
+	domain := os.Getenv("DOMAIN")
+	if domain == "" {
+		domain = "http://localhost"
+	}
+	if !strings.Contains(domain, "://") {
+		domain = "http://" + domain
+	}
+	u, err := url.Parse(domain)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// utmParam lê um parâmetro utm_* da URL, normalizado e com tamanho limitado
+func utmParam(c *gin.Context, name string) *string {
+	value := strings.ToLower(strings.TrimSpace(c.Query(name)))
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxUTMLength {
+		value = strings.ToValidUTF8(value[:maxUTMLength], "")
+	}
+	return &value
+}
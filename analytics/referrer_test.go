@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferrerOrigin(t *testing.T) {
+	tests := []struct {
+		referer string
+		origin  string
+		kind    string
+	}{
+		{"", "", ReferrerDirect},
+		{"not a url", "", ReferrerDirect},
+		{"https://www.google.com.br/search?q=harmonista", "google.com.br", ReferrerSearch},
+		{"https://duckduckgo.com/", "duckduckgo.com", ReferrerSearch},
+		{"https://t.co/abc123", "t.co", ReferrerSocial},
+		{"https://m.facebook.com/story.php?id=1", "m.facebook.com", ReferrerSocial},
+		{"https://exemplo.org/algum/caminho?token=secreto", "exemplo.org", ReferrerOther},
+		{"https://harmonista.com/leia/poesia", "/leia", ReferrerInternal},
+		{"https://harmonista.com/@/outroblog/minha-resposta", "/@/outroblog", ReferrerInternal},
+		{"https://outroblog.harmonista.com/minha-resposta", "/@/outroblog", ReferrerInternal},
+		{"https://www.harmonista.com/", "/", ReferrerInternal},
+	}
+
+	for _, tt := range tests {
+		origin, kind := referrerOrigin(tt.referer, "harmonista.com")
+		assert.Equal(t, tt.kind, kind, tt.referer)
+		if tt.origin == "" {
+			assert.Nil(t, origin, tt.referer)
+		} else if assert.NotNil(t, origin, tt.referer) {
+			assert.Equal(t, tt.origin, *origin, tt.referer)
+		}
+	}
+}
+
+func TestTrackVisit_ReferrerAndUTM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db, ingest: newIngester(db), baseHost: "harmonista.com"}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/@/blog/post?utm_source=Newsletter&utm_campaign="+strings.Repeat("x", 150), nil)
+	c.Request.Header.Set("Referer", "https://news.ycombinator.com/item?id=1")
+	a.TrackVisit(c, 1, nil)
+	a.ingest.close()
+
+	var event BlogEvent
+	assert.NoError(t, db.First(&event).Error)
+	assert.Equal(t, "news.ycombinator.com", *event.Origem)
+	assert.Equal(t, ReferrerSocial, *event.TipoOrigem)
+	assert.Equal(t, "newsletter", *event.UtmSource)
+	assert.Nil(t, event.UtmMedium)
+	assert.Len(t, *event.UtmCampaign, maxUTMLength)
+
+	assert.NoError(t, a.Rollup(time.Now()))
+	assert.Equal(t, []DimensionVisits{{Value: "news.ycombinator.com", Count: 1}}, a.GetTopValues(1, DimensionReferrer, LastDays(30, time.Now()), 10))
+	assert.Equal(t, []DimensionVisits{{Value: strings.Repeat("x", maxUTMLength), Count: 1}}, a.GetTopValues(1, DimensionCampaign, LastDays(30, time.Now()), 10))
+}
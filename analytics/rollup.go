@@ -0,0 +1,377 @@
+package analytics
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dimensões agregadas nas tabelas de rollup
+const (
+	DimensionTotal    = "total"    // todas as visitas do blog (value vazio)
+	DimensionPost     = "post"     // value = ID do post
+	DimensionBrowser  = "browser"  // value = navegador
+	DimensionLanguage = "language" // value = idioma preferido
+	DimensionCountry  = "country"  // value = código ISO do país (GeoIP)
+
+	DimensionReferrer     = "referrer"      // value = host de origem ou seção do Harmonista
+	DimensionReferrerType = "referrer_type" // value = ReferrerSearch, ReferrerSocial...
+	DimensionCampaign     = "campaign"      // value = utm_campaign (ou utm_source, sem campanha)
+
+	// Dimensões dos eventos de leitura; value = "postID:faixa"
+	DimensionReadDepth = "read_depth" // faixa = % do post lido (readDepths)
+	DimensionReadTime  = "read_time"  // faixa = limite inferior em segundos (readTimeBuckets)
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+
+	// rollupInterval é o intervalo entre execuções do job de agregação
+	rollupInterval = 10 * time.Minute
+	// defaultRetentionDays é o padrão de ANALYTICS_RETENTION_DAYS
+	defaultRetentionDays = 90
+	// minRetentionDays garante que o dia anterior ainda possa ser reagregado
+	minRetentionDays = 2
+)
+
+// DailyRollup guarda visitas agregadas por dia (horário do servidor).
+// Visitors conta identificadores distintos no dia.
+type DailyRollup struct {
+	ID        uint   `gorm:"primary_key;autoIncrement"`
+	BlogID    int    `gorm:"not null;uniqueIndex:idx_daily_rollup"`
+	Day       string `gorm:"not null;size:10;uniqueIndex:idx_daily_rollup"` // 2006-01-02
+	Dimension string `gorm:"not null;size:32;uniqueIndex:idx_daily_rollup"`
+	Value     string `gorm:"not null;size:255;uniqueIndex:idx_daily_rollup"`
+	Visits    int64  `gorm:"not null;default:0"`
+	Visitors  int64  `gorm:"not null;default:0"`
+}
+
+func (DailyRollup) TableName() string {
+	return "analytics_daily"
+}
+
+// MonthlyRollup soma os rollups diários do mês. Como o identificador do
+// visitante muda todo dia no modo sem cookies, Visitors é a soma dos
+// visitantes únicos de cada dia.
+type MonthlyRollup struct {
+	ID        uint   `gorm:"primary_key;autoIncrement"`
+	BlogID    int    `gorm:"not null;uniqueIndex:idx_monthly_rollup"`
+	Month     string `gorm:"not null;size:7;uniqueIndex:idx_monthly_rollup"` // 2006-01
+	Dimension string `gorm:"not null;size:32;uniqueIndex:idx_monthly_rollup"`
+	Value     string `gorm:"not null;size:255;uniqueIndex:idx_monthly_rollup"`
+	Visits    int64  `gorm:"not null;default:0"`
+	Visitors  int64  `gorm:"not null;default:0"`
+}
+
+func (MonthlyRollup) TableName() string {
+	return "analytics_monthly"
+}
+
+// rollupDimensions mapeia cada dimensão para o tipo de evento e a coluna
+// agrupada em blog_events. As expressões usam só SQL comum ao SQLite e ao
+// Postgres (CAST AS TEXT, ||, COALESCE, CASE), e os dias são cortados por
+// intervalo de created_at, sem funções de data do banco.
+var rollupDimensions = []struct {
+	name   string
+	event  string
+	column string // valor gravado em Value
+	where  string
+}{
+	{DimensionTotal, "visit", "", ""},
+	{DimensionPost, "visit", "CAST(post_id AS TEXT)", "post_id IS NOT NULL"},
+	{DimensionBrowser, "visit", "COALESCE(navegador, '')", ""},
+	{DimensionLanguage, "visit", "COALESCE(lingua, '')", ""},
+	{DimensionCountry, "visit", "COALESCE(pais, '')", ""},
+	{DimensionReferrer, "visit", "origem", "origem IS NOT NULL"},
+	{DimensionReferrerType, "visit", "COALESCE(tipo_origem, '')", ""},
+	{DimensionCampaign, "visit", "COALESCE(utm_campaign, utm_source)", "utm_campaign IS NOT NULL OR utm_source IS NOT NULL"},
+	{DimensionReadDepth, EventRead, "CAST(post_id AS TEXT) || ':' || CAST(profundidade AS TEXT)", "post_id IS NOT NULL AND profundidade IS NOT NULL"},
+	{DimensionReadTime, EventRead, "CAST(post_id AS TEXT) || ':' || " + readTimeBucketSQL(), "post_id IS NOT NULL AND tempo_leitura IS NOT NULL"},
+}
+
+// retentionFromEnv lê ANALYTICS_RETENTION_DAYS; 0 mantém os eventos para sempre
+func retentionFromEnv() int {
+	value := os.Getenv("ANALYTICS_RETENTION_DAYS")
+	if value == "" {
+		return defaultRetentionDays
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Printf("Invalid ANALYTICS_RETENTION_DAYS %q, using %d", value, defaultRetentionDays)
+		return defaultRetentionDays
+	}
+	if days > 0 && days < minRetentionDays {
+		return minRetentionDays
+	}
+	return days
+}
+
+// runRollups executa o job periodicamente até stop ser fechado
+func (a *AnalyticsModule) runRollups(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Rollup(time.Now()); err != nil {
+			log.Printf("Error rolling up analytics: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rollup agrega os dias ainda não consolidados (na primeira execução,
+// todo o histórico de eventos), atualiza os meses afetados e remove os
+// eventos mais antigos que a janela de retenção
+func (a *AnalyticsModule) Rollup(now time.Time) error {
+	if a == nil || a.db == nil {
+		return nil
+	}
+
+	start, ok := a.rollupStart(now)
+	if !ok {
+		a.markRolledUp(now)
+		return nil // nenhum evento ainda
+	}
+
+	today := startOfDay(now)
+	months := map[string]bool{}
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if err := a.rollupDay(day); err != nil {
+			return err
+		}
+		months[day.Format(monthLayout)] = true
+	}
+	for month := range months {
+		if err := a.rollupMonth(month); err != nil {
+			return err
+		}
+	}
+	a.markRolledUp(now)
+
+	return a.prune(now)
+}
+
+// markRolledUp registra que os dias antes do de now estão consolidados
+func (a *AnalyticsModule) markRolledUp(now time.Time) {
+	day := startOfDay(now)
+	a.rolledUp.Store(&day)
+}
+
+// liveFrom devolve o dia a partir do qual os rollups podem estar
+// incompletos: o da última execução do job neste processo ou, antes dela,
+// o último dia gravado, que o processo anterior pode ter agregado pela
+// metade. ok é false enquanto não há rollup nenhum.
+func (a *AnalyticsModule) liveFrom() (time.Time, bool) {
+	if rolledUp := a.rolledUp.Load(); rolledUp != nil {
+		return *rolledUp, true
+	}
+	var lastDay string
+	a.db.Model(&DailyRollup{}).Select("COALESCE(MAX(day), '')").Scan(&lastDay)
+	day, err := time.ParseInLocation(dayLayout, lastDay, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// rollupStart decide o primeiro dia a (re)agregar: o dia anterior ao
+// último já consolidado (eventos podem chegar atrasados pela fila) ou,
+// sem rollups, o dia do evento mais antigo (backfill)
+func (a *AnalyticsModule) rollupStart(now time.Time) (time.Time, bool) {
+	var lastDay string
+	a.db.Model(&DailyRollup{}).Select("COALESCE(MAX(day), '')").Scan(&lastDay)
+	if lastDay != "" {
+		if day, err := time.ParseInLocation(dayLayout, lastDay, now.Location()); err == nil {
+			return day.AddDate(0, 0, -1), true
+		}
+	}
+
+	var first BlogEvent
+	if err := a.db.Order("created_at ASC").First(&first).Error; err != nil {
+		return time.Time{}, false
+	}
+	return startOfDay(first.CreatedAt.In(now.Location())), true
+}
+
+type rollupRow struct {
+	BlogID   int
+	Value    string
+	Visits   int64
+	Visitors int64
+}
+
+// rollupDay recalcula todas as dimensões de um dia a partir dos eventos
+func (a *AnalyticsModule) rollupDay(day time.Time) error {
+	key := day.Format(dayLayout)
+	rows, err := a.dayRows(day, 0)
+	if err != nil {
+		return err
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("day = ?", key).Delete(&DailyRollup{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, batchSize).Error
+	})
+}
+
+// dayRows agrega os eventos de um dia nas linhas do rollup diário. Com
+// blogID 0 agrega todos os blogs; sem dimensions, todas as dimensões.
+func (a *AnalyticsModule) dayRows(day time.Time, blogID int, dimensions ...string) ([]DailyRollup, error) {
+	from, to := day, day.AddDate(0, 0, 1)
+	key := day.Format(dayLayout)
+
+	var rows []DailyRollup
+	for _, dim := range rollupDimensions {
+		if len(dimensions) > 0 && !slices.Contains(dimensions, dim.name) {
+			continue
+		}
+		value, group := "''", "blog_id"
+		if dim.column != "" {
+			value, group = dim.column, "blog_id, "+dim.column
+		}
+
+		query := a.db.Model(&BlogEvent{}).
+			Select("blog_id, "+value+" AS value, COUNT(*) AS visits, COUNT(DISTINCT cookie_id) AS visitors").
+			Where("event = ? AND created_at >= ? AND created_at < ?", dim.event, from, to)
+		if dim.where != "" {
+			query = query.Where(dim.where)
+		}
+		if blogID != 0 {
+			query = query.Where("blog_id = ?", blogID)
+		}
+
+		var results []rollupRow
+		if err := query.Group(group).Scan(&results).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			rows = append(rows, DailyRollup{
+				BlogID:    r.BlogID,
+				Day:       key,
+				Dimension: dim.name,
+				Value:     r.Value,
+				Visits:    r.Visits,
+				Visitors:  r.Visitors,
+			})
+		}
+	}
+	return rows, nil
+}
+
+// pendingRows agrega na hora, direto dos eventos, os dias de r que o job
+// ainda vai refazer: o da última execução em diante. Assim as consultas
+// não ficam até rollupInterval atrasadas. from é o primeiro desses dias;
+// os rollups gravados só valem antes dele (consolidated). Antes da
+// primeira execução from é "" e os rollups valem para tudo.
+func (a *AnalyticsModule) pendingRows(blogID int, r TimeRange, dimensions ...string) (rows []DailyRollup, from string) {
+	rolledUp := a.rolledUp.Load()
+	if rolledUp == nil {
+		return nil, ""
+	}
+
+	start := *rolledUp
+	if start.Before(startOfDay(r.From)) {
+		start = startOfDay(r.From)
+	}
+	end := startOfDay(r.To)
+	if today := startOfDay(time.Now()); end.After(today) {
+		end = today
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		dayRows, err := a.dayRows(day, blogID, dimensions...)
+		if err != nil {
+			log.Printf("Error reading pending analytics events: %v", err)
+			continue
+		}
+		rows = append(rows, dayRows...)
+	}
+	return rows, rolledUp.Format(dayLayout)
+}
+
+// consolidated restringe uma consulta de DailyRollup aos dias antes de from,
+// os que pendingRows não cobre
+func consolidated(query *gorm.DB, from string) *gorm.DB {
+	if from == "" {
+		return query
+	}
+	return query.Where("day < ?", from)
+}
+
+// rollupMonth recalcula o mês somando os rollups diários
+func (a *AnalyticsModule) rollupMonth(month string) error {
+	var results []struct {
+		BlogID    int
+		Dimension string
+		Value     string
+		Visits    int64
+		Visitors  int64
+	}
+	if err := a.db.Model(&DailyRollup{}).
+		Select("blog_id, dimension, value, SUM(visits) AS visits, SUM(visitors) AS visitors").
+		Where("day LIKE ?", month+"-%").
+		Group("blog_id, dimension, value").
+		Scan(&results).Error; err != nil {
+		return err
+	}
+
+	rows := make([]MonthlyRollup, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, MonthlyRollup{
+			BlogID:    r.BlogID,
+			Month:     month,
+			Dimension: r.Dimension,
+			Value:     r.Value,
+			Visits:    r.Visits,
+			Visitors:  r.Visitors,
+		})
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("month = ?", month).Delete(&MonthlyRollup{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, batchSize).Error
+	})
+}
+
+// prune apaga eventos brutos fora da janela de retenção. Os dias apagados
+// já estão consolidados, já que o rollup só reprocessa a partir de ontem.
+func (a *AnalyticsModule) prune(now time.Time) error {
+	if a.retentionDays == 0 {
+		return nil
+	}
+
+	cutoff := startOfDay(now).AddDate(0, 0, -a.retentionDays)
+	result := a.db.Where("created_at < ?", cutoff).Delete(&BlogEvent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Analytics: pruned %d events older than %s", result.RowsAffected, cutoff.Format(dayLayout))
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,144 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestRollup_BackfillAndRead(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	postID := 3
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, CookieID: "a", Event: "visit", Navegador: strPtr("Firefox"), Lingua: strPtr("pt-BR"), CreatedAt: yesterday},
+		{BlogID: 1, CookieID: "a", PostID: &postID, Event: "visit", Navegador: strPtr("Firefox"), CreatedAt: yesterday},
+		{BlogID: 1, CookieID: "b", PostID: &postID, Event: "visit", Navegador: strPtr("Chrome"), CreatedAt: now},
+		{BlogID: 2, CookieID: "c", Event: "visit", CreatedAt: now},
+	})
+
+	assert.NoError(t, a.Rollup(now))
+
+	days := a.GetVisitSeries(1, LastDays(2, now), BucketDay)
+	assert.Equal(t, int64(2), days[0].Count)
+	assert.Equal(t, int64(1), days[1].Count)
+
+	assert.Equal(t, []PostVisits{{PostID: 3, Count: 2}}, a.GetTopPosts(1, LastDays(30, now), 10))
+	assert.Equal(t, int64(2), a.GetPostVisitCount(3))
+
+	browsers := a.GetTopValues(1, DimensionBrowser, LastDays(30, now), 10)
+	assert.Equal(t, []DimensionVisits{{Value: "Firefox", Count: 2}, {Value: "Chrome", Count: 1}}, browsers)
+
+	var visitors int64
+	db.Model(&DailyRollup{}).Select("visitors").
+		Where("blog_id = 1 AND dimension = ? AND day = ?", DimensionTotal, yesterday.Format(dayLayout)).
+		Scan(&visitors)
+	assert.Equal(t, int64(1), visitors)
+
+	// Rodar de novo não duplica os números
+	assert.NoError(t, a.Rollup(now))
+	assert.Equal(t, int64(2), a.GetPostVisitCount(3))
+}
+
+func TestRollup_PrunesOldEvents(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db, retentionDays: 30}
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -40)
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, CookieID: "a", Event: "visit", CreatedAt: old},
+		{BlogID: 1, CookieID: "b", Event: "visit", CreatedAt: now},
+	})
+
+	assert.NoError(t, a.Rollup(now))
+
+	var remaining int64
+	db.Model(&BlogEvent{}).Count(&remaining)
+	assert.Equal(t, int64(1), remaining)
+
+	// O dia apagado continua nos rollups
+	var visits int64
+	db.Model(&DailyRollup{}).Select("visits").
+		Where("blog_id = 1 AND dimension = ? AND day = ?", DimensionTotal, old.Format(dayLayout)).
+		Scan(&visits)
+	assert.Equal(t, int64(1), visits)
+}
+
+func TestRollup_PendingEventsCountImmediately(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	postID := 3
+	depth := func(d int) *int { return &d }
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, CookieID: "a", PostID: &postID, Event: "visit", Navegador: strPtr("Firefox"), CreatedAt: yesterday},
+		{BlogID: 1, CookieID: "a", PostID: &postID, Event: "visit", Navegador: strPtr("Firefox"), CreatedAt: now},
+	})
+	assert.NoError(t, a.Rollup(now))
+
+	// Eventos gravados depois da última execução do job
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, CookieID: "b", PostID: &postID, Event: "visit", Navegador: strPtr("Chrome"), CreatedAt: now},
+		{BlogID: 1, CookieID: "c", PostID: &postID, Event: "visit", Navegador: strPtr("Chrome"), CreatedAt: now},
+		{BlogID: 1, CookieID: "b", PostID: &postID, Event: EventRead, Profundidade: depth(100), TempoLeitura: depth(60), CreatedAt: now},
+		{BlogID: 2, CookieID: "d", Event: "visit", CreatedAt: now},
+	})
+
+	r := LastDays(2, now)
+	assert.Equal(t, Totals{Visits: 4, Visitors: 4}, a.GetTotals(1, r))
+	days := a.GetVisitSeries(1, r, BucketDay)
+	assert.Equal(t, int64(1), days[0].Count)
+	assert.Equal(t, int64(3), days[1].Count)
+	assert.Equal(t, int64(4), a.GetPostVisitCount(3))
+	assert.Equal(t, []DimensionVisits{{Value: "Chrome", Count: 2}, {Value: "Firefox", Count: 2}}, a.GetTopValues(1, DimensionBrowser, r, 10))
+	assert.Equal(t, []DimensionVisits{{Value: "Chrome", Count: 2}}, a.GetTopValues(1, DimensionBrowser, r, 1))
+	assert.Equal(t, int64(1), a.GetReadingStats(1, r, 10)[0].Reads)
+
+	var exported []ExportRow
+	assert.NoError(t, a.ExportDaily(1, r, []string{DimensionTotal}, func(row ExportRow) error {
+		exported = append(exported, row)
+		return nil
+	}))
+	assert.Equal(t, []ExportRow{
+		{Day: yesterday.Format(dayLayout), Dimension: DimensionTotal, Visits: 1, Visitors: 1},
+		{Day: now.Format(dayLayout), Dimension: DimensionTotal, Visits: 3, Visitors: 3},
+	}, exported)
+
+	// Depois da próxima execução os números continuam os mesmos
+	assert.NoError(t, a.Rollup(now))
+	assert.Equal(t, Totals{Visits: 4, Visitors: 4}, a.GetTotals(1, r))
+	assert.Equal(t, int64(4), a.GetPostVisitCount(3))
+}
+
+func TestGetPostVisitCount_BeforeFirstRollup(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	postID := 3
+	db.Create(&[]BlogEvent{
+		{BlogID: 1, CookieID: "a", PostID: &postID, Event: "visit", CreatedAt: yesterday},
+		{BlogID: 1, CookieID: "b", PostID: &postID, Event: "visit", CreatedAt: now},
+	})
+
+	// Sem rollup nenhum, a contagem vem direto dos eventos
+	a := &AnalyticsModule{db: db}
+	assert.Equal(t, int64(2), a.GetPostVisitCount(3))
+	assert.Equal(t, int64(0), a.GetPostVisitCount(4))
+
+	// Rollups de um processo anterior mais eventos que ele não agregou
+	assert.NoError(t, a.Rollup(now))
+	db.Create(&BlogEvent{BlogID: 1, CookieID: "c", PostID: &postID, Event: "visit", CreatedAt: now})
+	restarted := &AnalyticsModule{db: db}
+	assert.Equal(t, int64(3), restarted.GetPostVisitCount(3))
+}
@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Agrupamento das séries de visitas
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"  // semanas começando na segunda-feira
+	BucketMonth = "month" // meses do calendário
+)
+
+// TimeRange é um intervalo de dias inteiros, de From até To (inclusive),
+// no horário do servidor. Todas as consultas do painel recebem um.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// LastDays retorna os últimos N dias, terminando no dia de now
+func LastDays(days int, now time.Time) TimeRange {
+	if days < 1 {
+		days = 1
+	}
+	to := startOfDay(now)
+	return TimeRange{From: to.AddDate(0, 0, -(days - 1)), To: to}
+}
+
+// NewTimeRange monta o intervalo a partir de datas 2006-01-02
+func NewTimeRange(from, to string) (TimeRange, error) {
+	start, err := time.ParseInLocation(dayLayout, from, time.Local)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("data inicial inválida, use AAAA-MM-DD")
+	}
+	end, err := time.ParseInLocation(dayLayout, to, time.Local)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("data final inválida, use AAAA-MM-DD")
+	}
+	if start.After(end) {
+		return TimeRange{}, fmt.Errorf("a data inicial é depois da data final")
+	}
+	return TimeRange{From: start, To: end}, nil
+}
+
+// Days retorna quantos dias o intervalo cobre
+func (r TimeRange) Days() int {
+	return int(startOfDay(r.To).Sub(startOfDay(r.From)).Hours()/24+0.5) + 1
+}
+
+// Previous retorna o período de mesmo tamanho imediatamente anterior,
+// usado nas comparações
+func (r TimeRange) Previous() TimeRange {
+	days := r.Days()
+	to := startOfDay(r.From).AddDate(0, 0, -1)
+	return TimeRange{From: to.AddDate(0, 0, -(days - 1)), To: to}
+}
+
+// FromKey e ToKey são os limites no formato das colunas day dos rollups
+func (r TimeRange) FromKey() string {
+	return r.From.Format(dayLayout)
+}
+
+func (r TimeRange) ToKey() string {
+	return r.To.Format(dayLayout)
+}
+
+// BucketFor escolhe o agrupamento que mantém o gráfico legível: dias até
+// dois meses, semanas até seis meses e meses a partir daí
+func BucketFor(r TimeRange) string {
+	switch days := r.Days(); {
+	case days <= 62:
+		return BucketDay
+	case days <= 186:
+		return BucketWeek
+	default:
+		return BucketMonth
+	}
+}
+
+// bucketStart retorna o primeiro dia do grupo ao qual day pertence
+func bucketStart(day time.Time, bucket string) time.Time {
+	day = startOfDay(day)
+	switch bucket {
+	case BucketWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // segunda = 0
+		return day.AddDate(0, 0, -offset)
+	case BucketMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+// bucketLabel é o rótulo curto exibido embaixo das barras
+func bucketLabel(start time.Time, bucket string) string {
+	if bucket == BucketMonth {
+		return start.Format("01/2006")
+	}
+	return start.Format("02/01")
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
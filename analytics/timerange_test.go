@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeRange_DaysAndPrevious(t *testing.T) {
+	r, err := NewTimeRange("2025-03-01", "2025-03-31")
+	assert.NoError(t, err)
+	assert.Equal(t, 31, r.Days())
+
+	prev := r.Previous()
+	assert.Equal(t, "2025-01-29", prev.FromKey())
+	assert.Equal(t, "2025-02-28", prev.ToKey())
+	assert.Equal(t, 31, prev.Days())
+
+	last := LastDays(7, time.Date(2025, 3, 10, 18, 30, 0, 0, time.Local))
+	assert.Equal(t, "2025-03-04", last.FromKey())
+	assert.Equal(t, "2025-03-10", last.ToKey())
+
+	_, err = NewTimeRange("2025-03-02", "2025-03-01")
+	assert.Error(t, err)
+}
+
+func TestBucketFor(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, BucketDay, BucketFor(LastDays(30, now)))
+	assert.Equal(t, BucketWeek, BucketFor(LastDays(90, now)))
+	assert.Equal(t, BucketMonth, BucketFor(LastDays(365, now)))
+}
+
+func TestGetVisitSeries_Buckets(t *testing.T) {
+	db := setupTestDB(t)
+	a := &AnalyticsModule{db: db}
+
+	db.Create(&[]DailyRollup{
+		{BlogID: 1, Day: "2025-03-03", Dimension: DimensionTotal, Visits: 4, Visitors: 2}, // segunda
+		{BlogID: 1, Day: "2025-03-09", Dimension: DimensionTotal, Visits: 1, Visitors: 1}, // domingo
+		{BlogID: 1, Day: "2025-03-10", Dimension: DimensionTotal, Visits: 5, Visitors: 3},
+		{BlogID: 1, Day: "2025-04-02", Dimension: DimensionTotal, Visits: 7, Visitors: 6},
+	})
+
+	r, _ := NewTimeRange("2025-03-03", "2025-04-06")
+
+	weeks := a.GetVisitSeries(1, r, BucketWeek)
+	assert.Len(t, weeks, 5)
+	assert.Equal(t, PeriodVisits{Date: "2025-03-03", Label: "03/03", Count: 5, Visitors: 3}, weeks[0])
+	assert.Equal(t, int64(5), weeks[1].Count)
+	assert.Equal(t, int64(0), weeks[2].Count)
+	assert.Equal(t, int64(7), weeks[4].Count)
+
+	months := a.GetVisitSeries(1, r, BucketMonth)
+	assert.Equal(t, []PeriodVisits{
+		{Date: "2025-03-01", Label: "03/2025", Count: 10, Visitors: 6},
+		{Date: "2025-04-01", Label: "04/2025", Count: 7, Visitors: 6},
+	}, months)
+
+	assert.Equal(t, Totals{Visits: 17, Visitors: 12}, a.GetTotals(1, r))
+	assert.Equal(t, Totals{}, a.GetTotals(1, r.Previous()))
+}
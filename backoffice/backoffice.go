@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,16 +13,18 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"harmonista/analytics"
 	"harmonista/cache"
 	"harmonista/models"
 )
 
 type BackofficeModule struct {
-	db *gorm.DB
+	db        *gorm.DB
+	analytics *analytics.AnalyticsModule
 }
 
-func NewBackofficeModule(db *gorm.DB) *BackofficeModule {
-	return &BackofficeModule{db: db}
+func NewBackofficeModule(db *gorm.DB, analyticsModule *analytics.AnalyticsModule) *BackofficeModule {
+	return &BackofficeModule{db: db, analytics: analyticsModule}
 }
 
 func (b *BackofficeModule) RegisterRoutes(router *gin.Engine) {
@@ -30,6 +33,8 @@ func (b *BackofficeModule) RegisterRoutes(router *gin.Engine) {
 		backofficeGroup.GET("/login", b.loginPage)
 		backofficeGroup.POST("/login", b.loginPost)
 		backofficeGroup.GET("/index", b.requireBackofficeAuth, b.index)
+		backofficeGroup.GET("/analytics", b.requireBackofficeAuth, b.analyticsStatus)
+		backofficeGroup.GET("/cache", b.requireBackofficeAuth, b.cacheStatus)
 		backofficeGroup.POST("/toggle-list-reader/:blogID", b.requireBackofficeAuth, b.toggleListReader)
 		backofficeGroup.POST("/toggle-adult/:blogID", b.requireBackofficeAuth, b.toggleAdult)
 		backofficeGroup.POST("/validate-user/:userID", b.requireBackofficeAuth, b.validateUser)
@@ -165,6 +170,113 @@ func (b *BackofficeModule) index(c *gin.Context) {
 	})
 }
 
+// botReasonLabels descreve os motivos de filtragem de robôs
+var botReasonLabels = map[string]string{
+	analytics.BotUserAgent:  "User-Agent de robô ou biblioteca",
+	analytics.BotHeaders:    "Sem cabeçalhos de navegador",
+	analytics.BotReverseDNS: "DNS reverso de crawler",
+	analytics.BotRate:       "Muitas requisições por minuto",
+	// Gravado antes de a falta do Accept-Language sozinha deixar de bastar
+	"no-language": "Sem Accept-Language",
+}
+
+type botReasonRow struct {
+	Label string
+	Count int64
+}
+
+// analyticsStatus mostra a fila de gravação e quanto tráfego de robôs foi filtrado
+func (b *BackofficeModule) analyticsStatus(c *gin.Context) {
+	if b.analytics == nil {
+		c.HTML(http.StatusOK, "backoffice_analytics.html", gin.H{
+			"analyticsEnabled": false,
+		})
+		return
+	}
+
+	bots := b.analytics.BotStats()
+	reasons := make([]botReasonRow, 0, len(bots.ByReason))
+	for reason, count := range bots.ByReason {
+		reasons = append(reasons, botReasonRow{Label: botReasonLabel(reason), Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i].Count > reasons[j].Count })
+
+	// Com ANALYTICS_BOTS=tag os robôs também ficam gravados
+	var stored []botReasonRow
+	for _, item := range b.analytics.GetBotEvents(analytics.LastDays(30, time.Now())) {
+		stored = append(stored, botReasonRow{Label: botReasonLabel(item.Value), Count: item.Count})
+	}
+
+	filteredPercent := 0.0
+	if bots.Checked > 0 {
+		filteredPercent = float64(bots.Filtered) / float64(bots.Checked) * 100
+	}
+
+	c.HTML(http.StatusOK, "backoffice_analytics.html", gin.H{
+		"analyticsEnabled": true,
+		"bots":             bots,
+		"filteredPercent":  filteredPercent,
+		"reasons":          reasons,
+		"stored":           stored,
+		"ingest":           b.analytics.Stats(),
+	})
+}
+
+func botReasonLabel(reason string) string {
+	if label, ok := botReasonLabels[reason]; ok {
+		return label
+	}
+	if reason == "" {
+		return "Desconhecido"
+	}
+	return reason
+}
+
+// cacheTierLabels descreve as camadas do cache de páginas
+var cacheTierLabels = map[string]string{
+	"memory": "Memória (LRU)",
+	"file":   "Disco (./cache)",
+	"tiered": "Memória + disco",
+}
+
+type cacheTierRow struct {
+	Label string
+	cache.Stats
+	SizeMB float64
+	MaxMB  float64
+}
+
+// cacheStatus mostra os contadores do cache de páginas e de cada camada
+func (b *BackofficeModule) cacheStatus(c *gin.Context) {
+	stats := cache.DefaultStore().Stats()
+	tiers := stats.Tiers
+	if len(tiers) == 0 {
+		tiers = []cache.Stats{stats}
+	}
+
+	rows := make([]cacheTierRow, 0, len(tiers))
+	for _, tier := range tiers {
+		label, ok := cacheTierLabels[tier.Name]
+		if !ok {
+			label = tier.Name
+		}
+		rows = append(rows, cacheTierRow{
+			Label:  label,
+			Stats:  tier,
+			SizeMB: float64(tier.Bytes) / (1 << 20),
+			MaxMB:  float64(tier.MaxBytes) / (1 << 20),
+		})
+	}
+
+	c.HTML(http.StatusOK, "backoffice_cache.html", gin.H{
+		"store":   cacheTierLabels[stats.Name],
+		"hits":    stats.Hits,
+		"misses":  stats.Misses,
+		"hitRate": stats.HitRate(),
+		"tiers":   rows,
+	})
+}
+
 func (b *BackofficeModule) toggleListReader(c *gin.Context) {
 	blogID := c.Param("blogID")
 
@@ -179,6 +291,7 @@ func (b *BackofficeModule) toggleListReader(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar blog"})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":      true,
@@ -200,6 +313,7 @@ func (b *BackofficeModule) toggleAdult(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar blog"})
 		return
 	}
+	cache.BlogChanged(blog.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
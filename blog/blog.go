@@ -1,39 +1,31 @@
 package blog
 
 import (
-	"bytes"
 	"fmt"
 	"html/template"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
-	htmlrenderer "github.com/yuin/goldmark/renderer/html"
 	"gorm.io/gorm"
 
 	"harmonista/analytics"
+	"harmonista/cache"
 	"harmonista/models"
 )
 
 type BlogModule struct {
 	db        *gorm.DB
 	analytics *analytics.AnalyticsModule
-}
+	renderers sync.Map // markdownOptions -> goldmark.Markdown
 
-// markdown renderer configured with Goldmark and useful extensions
-var md = goldmark.New(
-	goldmark.WithExtensions(
-		extension.GFM,     // tables, strikethrough, task lists, autolinks (GFM set)
-		extension.Linkify, // linkify raw URLs
-	),
-	goldmark.WithRendererOptions(
-		htmlrenderer.WithUnsafe(), // allow raw HTML passthrough in Markdown
-	),
-)
+	// Aquecedor do cache (ver StartCacheWarmer)
+	stopWarmer chan struct{}
+	warmerDone chan struct{}
+}
 
 type NavLink struct {
 	Text string
@@ -41,10 +33,25 @@ type NavLink struct {
 }
 
 func NewBlogModule(db *gorm.DB, analyticsModule *analytics.AnalyticsModule) *BlogModule {
-	return &BlogModule{
+	b := &BlogModule{
 		db:        db,
 		analytics: analyticsModule,
 	}
+	return b
+}
+
+// findMedia busca em uma consulta as mídias do blog usadas nas imagens do Markdown
+func (b *BlogModule) findMedia(blogID int, paths []string) map[string]*models.Media {
+	var items []models.Media
+	if err := b.db.Where("blog_id = ? AND url IN ?", blogID, paths).Find(&items).Error; err != nil {
+		return nil
+	}
+
+	found := make(map[string]*models.Media, len(items))
+	for i := range items {
+		found[items[i].URL] = &items[i]
+	}
+	return found
 }
 
 func parseNavLinks(navString string) []NavLink {
@@ -103,7 +110,25 @@ func (b *BlogModule) RegisterRoutes(router *gin.Engine) {
 		blogGroup.GET("/", b.index)
 		blogGroup.GET("/p/:pageSlug", b.page)
 		blogGroup.GET("/t/:tagName", b.tag)
+		blogGroup.GET("/stats", b.stats)
 		blogGroup.GET("/:postSlug", b.post)
+		blogGroup.POST("/_leitura", b.readingBeacon)
+	}
+
+	// Páginas servidas pelo cache não passam pelos handlers
+	cache.OnHit(b.trackCachedVisit)
+}
+
+// trackCachedVisit conta a visita de uma página servida pelo cache
+func (b *BlogModule) trackCachedVisit(c *gin.Context, visit cache.Visit) {
+	b.trackVisit(c, visit.BlogID, visit.PostID)
+}
+
+// trackVisit conta a visita, exceto nas renderizações do próprio cache
+// (revalidação e aquecimento), que não vêm de um leitor
+func (b *BlogModule) trackVisit(c *gin.Context, blogID int, postID *int) {
+	if b.analytics != nil && !cache.Background(c) {
+		b.analytics.TrackVisit(c, blogID, postID)
 	}
 }
 
@@ -125,9 +150,9 @@ func (b *BlogModule) index(c *gin.Context) {
 	}
 
 	// Track visit to blog home
-	if b.analytics != nil {
-		b.analytics.TrackVisit(c, blog.ID, nil)
-	}
+	b.trackVisit(c, blog.ID, nil)
+	cache.VisitOnHit(c, blog.ID, nil)
+	cache.Depends(c, cache.BlogDep(blog.ID), cache.PostsDep(blog.ID))
 
 	// Debug: verificar se o tema está sendo carregado
 	fmt.Printf("DEBUG - Blog ID: %d, Subdomain: %s, Theme length: %d\n", blog.ID, blog.Subdomain, len(blog.Theme))
@@ -157,7 +182,7 @@ func (b *BlogModule) index(c *gin.Context) {
 		"blog":                blog,
 		"posts":               posts,
 		"navLinks":            navLinks,
-		"blogDescriptionHTML": template.HTML(renderMarkdown(blog.Description)),
+		"blogDescriptionHTML": template.HTML(b.renderMarkdown(blog, blog.Description)),
 		"previewCSS":          previewCSS,
 		"blogThemeCSS":        template.CSS(blog.Theme),
 		"blogURL":             blogURL,
@@ -185,6 +210,9 @@ func (b *BlogModule) page(c *gin.Context) {
 	if err := b.db.Where("blog_id = ? AND slug = ? AND draft = ?", blog.ID, pageSlug, false).
 		First(&page).Error; err != nil {
 		fmt.Printf("DEBUG PAGE - Página não encontrada. BlogID=%d, Slug=%s, Error=%v\n", blog.ID, pageSlug, err)
+		if b.redirectOldSlug(c, blog, models.SlugKindPage, pageSlug) {
+			return
+		}
 
 		// Verificar todas as páginas deste blog
 		var allPages []models.Page
@@ -201,11 +229,12 @@ func (b *BlogModule) page(c *gin.Context) {
 	}
 
 	fmt.Printf("DEBUG PAGE - Página encontrada: ID=%d, Title=%s\n", page.ID, page.Title)
+	cache.Depends(c, cache.BlogDep(blog.ID), cache.PageDep(int(page.ID)))
 
 	// Track visit to blog page (não trackeamos pages no analytics por enquanto)
 	// Pages são diferentes de Posts, e o requisito era trackear Posts
 
-	contentHTML := template.HTML(renderMarkdown(page.Content))
+	contentHTML := template.HTML(b.renderMarkdown(blog, page.Content))
 
 	navLinks := parseNavLinks(blog.Nav)
 
@@ -246,15 +275,18 @@ func (b *BlogModule) tag(c *gin.Context) {
 		return
 	}
 
-	// Buscar a tag pelo nome
+	// Buscar a tag do blog pelo nome, sem diferenciar maiúsculas
 	var tag models.Tag
-	if err := b.db.Where("title = ?", tagName).First(&tag).Error; err != nil {
+	if err := b.db.Where("blog_id = ? AND name = ?", blog.ID, models.NormalizeTagName(tagName)).
+		First(&tag).Error; err != nil {
 		c.HTML(http.StatusNotFound, "blog_error.html", gin.H{
 			"error": "Tag não encontrada",
 		})
 		return
 	}
 
+	cache.Depends(c, cache.BlogDep(blog.ID), cache.PostsDep(blog.ID), cache.TagDep(int(tag.ID)))
+
 	// Buscar posts com essa tag
 	var posts []models.Post
 	b.db.Table("posts").
@@ -271,9 +303,10 @@ func (b *BlogModule) tag(c *gin.Context) {
 	c.HTML(http.StatusOK, "blog_tag.html", gin.H{
 		"blog":                blog,
 		"tag":                 tag,
+		"tagDescriptionHTML":  template.HTML(b.renderMarkdown(blog, tag.Description)),
 		"posts":               posts,
 		"navLinks":            navLinks,
-		"blogDescriptionHTML": template.HTML(renderMarkdown(blog.Description)),
+		"blogDescriptionHTML": template.HTML(b.renderMarkdown(blog, blog.Description)),
 		"previewCSS":          previewCSS,
 		"blogThemeCSS":        template.CSS(blog.Theme),
 	})
@@ -294,6 +327,9 @@ func (b *BlogModule) post(c *gin.Context) {
 	var post models.Post
 	if err := b.db.Where("blog_id = ? AND slug = ? AND draft = ?", blog.ID, postSlug, false).
 		First(&post).Error; err != nil {
+		if b.redirectOldSlug(c, blog, models.SlugKindPost, postSlug) {
+			return
+		}
 		c.HTML(http.StatusNotFound, "blog_error.html", gin.H{
 			"error": "Post não encontrado",
 		})
@@ -301,9 +337,9 @@ func (b *BlogModule) post(c *gin.Context) {
 	}
 
 	postID := int(post.ID)
-	if b.analytics != nil {
-		b.analytics.TrackVisit(c, blog.ID, &postID)
-	}
+	b.trackVisit(c, blog.ID, &postID)
+	cache.VisitOnHit(c, blog.ID, &postID)
+	cache.Depends(c, cache.BlogDep(blog.ID), cache.PostDep(postID), cache.RepliesDep(postID))
 
 	// Buscar tags do post
 	var tags []models.Tag
@@ -311,6 +347,9 @@ func (b *BlogModule) post(c *gin.Context) {
 		Joins("INNER JOIN post_tags ON tags.id = post_tags.tag_id").
 		Where("post_tags.post_id = ?", post.ID).
 		Find(&tags)
+	for _, tag := range tags {
+		cache.Depends(c, cache.TagDep(int(tag.ID)))
+	}
 
 	var replyToPost *models.Post
 	if post.ReplyPostID != nil {
@@ -320,6 +359,8 @@ func (b *BlogModule) post(c *gin.Context) {
 			First(&parentPost).Error; err == nil {
 			replyToPost = &parentPost
 		}
+		// Mesmo rascunho o post respondido é dependência: publicado, o link aparece
+		cache.Depends(c, cache.PostDep(*post.ReplyPostID))
 	}
 
 	// Buscar respostas a este post
@@ -329,7 +370,7 @@ func (b *BlogModule) post(c *gin.Context) {
 		Order("created_at ASC").
 		Find(&replies)
 
-	contentHTML := template.HTML(renderMarkdown(post.Content))
+	contentHTML := template.HTML(b.renderMarkdown(blog, post.Content))
 
 	navLinks := parseNavLinks(blog.Nav)
 	previewCSS := c.Query("css")
@@ -358,6 +399,7 @@ func (b *BlogModule) post(c *gin.Context) {
 	// Preparar dados das respostas
 	var repliesData []gin.H
 	for _, reply := range replies {
+		cache.Depends(c, cache.BlogDep(reply.BlogID))
 		replyURL := buildBlogURL(c, &reply.Blog, "/"+reply.Slug)
 		repliesData = append(repliesData, gin.H{
 			"ID":        reply.ID,
@@ -381,18 +423,10 @@ func (b *BlogModule) post(c *gin.Context) {
 		"blogThemeCSS": template.CSS(blog.Theme),
 		"postURL":      postURL,
 		"blogURL":      blogURL,
+		"readingStats": b.analytics != nil && blog.ReadingStats,
 	})
 }
 
-func renderMarkdown(content string) string {
-	var buf bytes.Buffer
-	if err := md.Convert([]byte(content), &buf); err != nil {
-		// Em caso de erro, retorna o conteúdo original para não quebrar a página
-		return content
-	}
-	return buf.String()
-}
-
 func formatInlineMarkdown(text string) string {
 	text = replaceBold(text)
 	text = replaceItalic(text)
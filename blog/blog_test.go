@@ -1,24 +1,29 @@
 package blog
 
 import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"harmonista/analytics"
+	"harmonista/database"
+	"harmonista/database/dbtest"
 	"harmonista/models"
 )
 
-func setupTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := dbtest.Open(t)
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatal(err)
 	}
-
-	db.AutoMigrate(&models.User{}, &models.Blog{}, &models.Post{}, &models.Tag{}, &models.PostTag{})
 	return db
 }
 
@@ -50,10 +55,18 @@ func createTestBlog(db *gorm.DB, userID int) *models.Blog {
 }
 
 func createTestPost(db *gorm.DB, blogID int, draft bool) *models.Post {
+	// Slugs são únicos por blog: os posts seguintes ganham -2, -3...
+	slug := "test-post"
+	var count int64
+	db.Model(&models.Post{}).Where("blog_id = ?", blogID).Count(&count)
+	if count > 0 {
+		slug = fmt.Sprintf("test-post-%d", count+1)
+	}
+
 	post := &models.Post{
 		BlogID:    blogID,
 		Title:     "Test Post",
-		Slug:      "test-post",
+		Slug:      slug,
 		Content:   "# Test Content\n\nThis is a **test** post.",
 		Draft:     draft,
 		CreatedAt: time.Now(),
@@ -64,8 +77,8 @@ func createTestPost(db *gorm.DB, blogID int, draft bool) *models.Post {
 }
 
 func TestGetBlogBySubdomain(t *testing.T) {
-	db := setupTestDB()
-	blogModule := NewBlogModule(db)
+	db := setupTestDB(t)
+	blogModule := NewBlogModule(db, nil)
 
 	user := createTestUser(db)
 	expectedBlog := createTestBlog(db, user.ID)
@@ -78,8 +91,8 @@ func TestGetBlogBySubdomain(t *testing.T) {
 }
 
 func TestGetBlogBySubdomain_NotFound(t *testing.T) {
-	db := setupTestDB()
-	blogModule := NewBlogModule(db)
+	db := setupTestDB(t)
+	blogModule := NewBlogModule(db, nil)
 
 	blog, err := blogModule.getBlogBySubdomain("nonexistent")
 
@@ -88,7 +101,7 @@ func TestGetBlogBySubdomain_NotFound(t *testing.T) {
 }
 
 func TestIndex_Success(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -102,7 +115,7 @@ func TestIndex_Success(t *testing.T) {
 }
 
 func TestIndex_OnlyPublishedPosts(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -116,7 +129,7 @@ func TestIndex_OnlyPublishedPosts(t *testing.T) {
 }
 
 func TestPost_Success(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -131,7 +144,7 @@ func TestPost_Success(t *testing.T) {
 }
 
 func TestPost_DraftNotVisible(t *testing.T) {
-	db := setupTestDB()
+	db := setupTestDB(t)
 
 	user := createTestUser(db)
 	blog := createTestBlog(db, user.ID)
@@ -143,7 +156,26 @@ func TestPost_DraftNotVisible(t *testing.T) {
 	assert.Error(t, err)
 }
 
+// markdownRenderer renderiza como as páginas do blog, pelo
+// BlogModule.renderMarkdown, com os recursos de opts ligados no blog
+func markdownRenderer(t *testing.T) func(opts markdownOptions, content string) string {
+	blogModule := NewBlogModule(setupTestDB(t), nil)
+	return func(opts markdownOptions, content string) string {
+		blog := &models.Blog{
+			ID:                      1,
+			MarkdownFootnotes:       opts.Footnotes,
+			MarkdownHeadingAnchors:  opts.HeadingAnchors,
+			MarkdownDefinitionLists: opts.DefinitionLists,
+			MarkdownTypographer:     opts.Typographer,
+			MarkdownTOC:             opts.TOC,
+		}
+		assert.Equal(t, opts, markdownOptionsFor(blog))
+		return blogModule.renderMarkdown(blog, content)
+	}
+}
+
 func TestRenderMarkdown_Headers(t *testing.T) {
+	render := markdownRenderer(t)
 	tests := []struct {
 		input    string
 		expected string
@@ -156,15 +188,16 @@ func TestRenderMarkdown_Headers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			result := renderMarkdown(tt.input)
+			result := render(markdownOptions{}, tt.input)
 			assert.Contains(t, result, tt.expected)
 		})
 	}
 }
 
 func TestRenderMarkdown_Lists(t *testing.T) {
+	render := markdownRenderer(t)
 	input := "- Item 1\n- Item 2\n- Item 3"
-	result := renderMarkdown(input)
+	result := render(markdownOptions{}, input)
 
 	assert.Contains(t, result, "<ul>")
 	assert.Contains(t, result, "<li>Item 1</li>")
@@ -174,14 +207,25 @@ func TestRenderMarkdown_Lists(t *testing.T) {
 }
 
 func TestRenderMarkdown_CodeBlock(t *testing.T) {
+	render := markdownRenderer(t)
 	input := "```\ncode here\n```"
-	result := renderMarkdown(input)
+	result := render(markdownOptions{}, input)
 
 	assert.Contains(t, result, "<pre><code>")
 	assert.Contains(t, result, "code here")
 	assert.Contains(t, result, "</code></pre>")
 }
 
+func TestRenderMarkdown_HighlightedCodeBlock(t *testing.T) {
+	render := markdownRenderer(t)
+	input := "```go {hl_lines=[2]}\npackage main\nfunc main() {}\n```"
+	result := render(markdownOptions{}, input)
+
+	assert.Contains(t, result, `<pre class="chroma">`)
+	assert.Contains(t, result, `<span class="line hl">`)
+	assert.Contains(t, result, `<span class="kd">func</span>`)
+}
+
 func TestReplaceBold(t *testing.T) {
 	input := "This is **bold** text"
 	expected := "This is <strong>bold</strong> text"
@@ -225,6 +269,7 @@ func TestFormatInlineMarkdown(t *testing.T) {
 }
 
 func TestRenderMarkdown_ComplexDocument(t *testing.T) {
+	render := markdownRenderer(t)
 	input := `# Main Title
 
 This is a paragraph with **bold** and *italic* text.
@@ -240,7 +285,7 @@ Check [this link](https://example.com) for more info.
 code block here
 ` + "```"
 
-	result := renderMarkdown(input)
+	result := render(markdownOptions{}, input)
 
 	assert.Contains(t, result, "<h1>Main Title</h1>")
 	assert.Contains(t, result, "<strong>bold</strong>")
@@ -252,3 +297,374 @@ code block here
 	assert.Contains(t, result, "<pre><code>")
 	assert.Contains(t, result, "code block here")
 }
+
+func TestRenderMarkdown_ResponsiveImage(t *testing.T) {
+	db := setupTestDB(t)
+	blogModule := NewBlogModule(db, nil)
+
+	db.Create(&[]models.Media{{
+		BlogID:      1,
+		Key:         "1/abc/original.jpg",
+		URL:         "/uploads/1/abc/original.jpg",
+		ContentType: "image/jpeg",
+		Width:       2000,
+		Height:      1000,
+		Variants:    `[{"url":"/uploads/1/abc/w960.jpg","width":960,"height":480,"content_type":"image/jpeg"},{"url":"/uploads/1/abc/w480.jpg","width":480,"height":240,"content_type":"image/jpeg"}]`,
+	}, {
+		BlogID: 2,
+		Key:    "2/def/original.jpg",
+		URL:    "/uploads/2/def/original.jpg",
+		Width:  800,
+		Height: 600,
+	}})
+
+	// Todas as imagens do post saem de uma consulta só
+	queries := 0
+	db.Callback().Query().Before("gorm:query").Register("count_media", func(tx *gorm.DB) {
+		if tx.Statement.Table == "media" {
+			queries++
+		}
+	})
+
+	input := "![Uma foto](/uploads/1/abc/original.jpg)\n\n[![De novo](/uploads/1/abc/original.jpg)](/x)\n\n![De outro blog](/uploads/2/def/original.jpg)"
+	result := blogModule.renderMarkdown(&models.Blog{ID: 1}, input)
+	assert.Equal(t, 1, queries)
+
+	assert.Contains(t, result, `src="/uploads/1/abc/original.jpg"`)
+	assert.Contains(t, result, `alt="Uma foto"`)
+	assert.Contains(t, result, `srcset="/uploads/1/abc/w480.jpg 480w, /uploads/1/abc/w960.jpg 960w, /uploads/1/abc/original.jpg 2000w"`)
+	assert.Contains(t, result, `width="2000" height="1000" loading="lazy" decoding="async"`)
+	assert.Contains(t, result, `<a href="/x"><img src="/uploads/1/abc/original.jpg" alt="De novo" srcset=`)
+	assert.NotContains(t, result, "<picture>")
+
+	// A mídia de outro blog com a mesma URL não é usada
+	assert.Contains(t, result, `<img src="/uploads/2/def/original.jpg" alt="De outro blog">`)
+	assert.NotContains(t, result, `width="800"`)
+
+	// Sem imagens locais, nenhuma consulta
+	blogModule.renderMarkdown(&models.Blog{ID: 1}, "![Externa](https://example.com/a.jpg)")
+	assert.Equal(t, 1, queries)
+}
+
+func TestRenderMarkdown_ExternalImageUnchanged(t *testing.T) {
+	db := setupTestDB(t)
+	blogModule := NewBlogModule(db, nil)
+
+	result := blogModule.renderMarkdown(&models.Blog{}, "![Externa](https://example.com/foto.jpg \"Título\")")
+
+	assert.Contains(t, result, `<img src="https://example.com/foto.jpg" alt="Externa" title="Título">`)
+	assert.NotContains(t, result, "srcset")
+}
+
+func TestRenderMarkdown_HeadingAnchorsAndTOC(t *testing.T) {
+	render := markdownRenderer(t)
+
+	input := "[[toc]]\n\n## Introdução\n\n### Detalhes\n\n## Introdução"
+	result := render(markdownOptions{HeadingAnchors: true, TOC: true}, input)
+
+	assert.Contains(t, result, `<h2 id="introducao">Introdução<a href="#introducao" title="Link permanente" class="heading-anchor">#</a></h2>`)
+	assert.Contains(t, result, `<h2 id="introducao-1">`)
+	assert.Contains(t, result, `<nav class="toc">`)
+	assert.Contains(t, result, "<li><a href=\"#introducao\">Introdução</a>\n<ul>\n<li><a href=\"#detalhes\">Detalhes</a></li>")
+	assert.NotContains(t, result, "[[toc]]")
+}
+
+func TestRenderMarkdown_FeaturesDisabledByDefault(t *testing.T) {
+	db := setupTestDB(t)
+	blogModule := NewBlogModule(db, nil)
+
+	input := "[[toc]]\n\n## Título\n\nTexto[^1] \"citação\"\n\n[^1]: Nota"
+	result := blogModule.renderMarkdown(&models.Blog{}, input)
+
+	assert.Contains(t, result, "<h2>Título</h2>")
+	assert.Contains(t, result, "[[toc]]")
+	assert.Contains(t, result, "&quot;citação&quot;")
+	assert.NotContains(t, result, "footnote")
+}
+
+func TestRenderMarkdown_FootnotesDefinitionsTypographer(t *testing.T) {
+	render := markdownRenderer(t)
+
+	input := "Texto[^1] \"citação\" d'água -- fim...\n\nTermo\n: Definição\n\n[^1]: Nota"
+	result := render(markdownOptions{Footnotes: true, DefinitionLists: true, Typographer: true}, input)
+
+	assert.Contains(t, result, `class="footnote-ref"`)
+	assert.Contains(t, result, `<div class="footnotes" role="doc-endnotes">`)
+	assert.Contains(t, result, "<dt>Termo</dt>\n<dd>Definição</dd>")
+	assert.Contains(t, result, "“citação” d’água — fim…")
+}
+
+func TestRenderMarkdown_PortugueseTypography(t *testing.T) {
+	render := markdownRenderer(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"travessão de diálogo", "-- Vamos embora, disse ela.", "<p>—\u00a0Vamos embora, disse ela.</p>"},
+		{"travessão intercalado", "A casa -- velha e torta -- caiu.", "A casa — velha e torta — caiu."},
+		{"hífen solto", "Ele veio - e foi.", "Ele veio — e foi."},
+		{"meia-risca em intervalo", "Páginas 10--20", "Páginas 10–20"},
+		{"hífen de palavra", "guarda-chuva", "guarda-chuva"},
+		{"ordinais", "O 1o lugar e a 2a vez, os 3os colocados", "O 1º lugar e a 2ª vez, os 3ºs colocados"},
+		{"moeda", "Custa R$ 10,00", "Custa R$\u00a010,00"},
+		{"abreviações", "O Sr. Silva e a Dra. Souza, nº 5", "O Sr.\u00a0Silva e a Dra.\u00a0Souza, nº\u00a05"},
+		{"aspas angulares", "<<Olá>>", "«Olá»"},
+		{"código intacto", "Use `--force` e `1o`", "<code>--force</code> e <code>1o</code>"},
+		{"título", "## -- Fala 1a", "—\u00a0Fala 1ª</h2>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := render(markdownOptions{Typographer: true}, tt.input)
+			assert.Contains(t, result, tt.expected)
+		})
+	}
+}
+
+func TestRenderMarkdown_InlineMath(t *testing.T) {
+	render := markdownRenderer(t)
+	result := render(markdownOptions{}, "Energia: $E = mc^2$.")
+
+	assert.Contains(t, result, `<math xmlns="http://www.w3.org/1998/Math/MathML">`)
+	assert.Contains(t, result, "<mi>E</mi><mo>=</mo><mi>m</mi><msup><mi>c</mi><mn>2</mn></msup>")
+	assert.Contains(t, result, `<annotation encoding="application/x-tex">E = mc^2</annotation>`)
+	assert.NotContains(t, result, "<script")
+}
+
+func TestRenderMarkdown_DisplayMath(t *testing.T) {
+	render := markdownRenderer(t)
+	input := "$$\n\\sum_{i=1}^{n} i = \\frac{n(n+1)}{2}\n$$"
+	result := render(markdownOptions{}, input)
+
+	assert.Contains(t, result, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`)
+	assert.Contains(t, result, `<munderover><mo largeop="true" movablelimits="true">∑</mo>`)
+	assert.Contains(t, result, "<mfrac><mrow><mi>n</mi><mo>(</mo>")
+	assert.NotContains(t, result, "<p>")
+}
+
+func TestRenderMarkdown_MathEnvironments(t *testing.T) {
+	render := markdownRenderer(t)
+	input := "$$\n\\begin{pmatrix} a & b \\\\ c & d \\end{pmatrix} \\left( \\sqrt[3]{x} \\right)\n$$"
+	result := render(markdownOptions{}, input)
+
+	assert.Contains(t, result, "<mtable><mtr><mtd><mrow><mi>a</mi></mrow></mtd><mtd><mrow><mi>b</mi></mrow></mtd></mtr>")
+	assert.Contains(t, result, `<mo fence="true" stretchy="true">(</mo><mroot>`)
+	assert.NotContains(t, result, "math-error")
+}
+
+func TestRenderMarkdown_InvalidMath(t *testing.T) {
+	render := markdownRenderer(t)
+	tests := []struct {
+		input string
+		error string
+	}{
+		{"Erro: $\\frac{1}{$ aqui", "chave { sem fechamento"},
+		{"Erro: $\\foo{x}$ aqui", `comando desconhecido: \foo`},
+		{"Erro: $\\left( x$ aqui", `\left sem \right`},
+		{"Erro: $x^2^3$ aqui", "expoente duplo"},
+		{"$$\n\\begin{matrix} a \\end{pmatrix}\n$$", `\begin{matrix} fechado com \end{pmatrix}`},
+		{"$$\nx + y", "$$ sem fechamento"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := render(markdownOptions{}, tt.input)
+			assert.Contains(t, result, `class="math-error" title="Erro na fórmula: `+tt.error)
+			assert.NotContains(t, result, "<math")
+		})
+	}
+}
+
+func TestRenderMarkdown_DollarSignsThatAreNotMath(t *testing.T) {
+	render := markdownRenderer(t)
+	tests := []string{
+		"Custa R$ 10,00 ou R$ 20,00",
+		"De R$5 por R$6",
+		"US$10 e $20",
+		"Código `$x$` fica intacto",
+		"Escapado: \\$x\\$",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			result := render(markdownOptions{}, input)
+			assert.NotContains(t, result, "<math")
+			assert.NotContains(t, result, "math-error")
+		})
+	}
+}
+
+func TestLatexToMathML_DeepNesting(t *testing.T) {
+	input := strings.Repeat("{", 200) + "x" + strings.Repeat("}", 200)
+	_, err := latexToMathML(input, false)
+
+	assert.Error(t, err)
+}
+
+func TestReadingBeacon(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID, false)
+
+	analyticsDB := dbtest.Open(t)
+	analyticsModule := analytics.NewAnalyticsModule(analyticsDB)
+	defer analyticsModule.Close()
+
+	router := setupTestRouter(NewBlogModule(db, analyticsModule))
+	send := func(body string) int {
+		req := httptest.NewRequest("POST", "/@/testblog/_leitura", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		req.Header.Set("Accept-Language", "pt-BR")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	valid := fmt.Sprintf(`{"post": %d, "depth": 75, "seconds": 42}`, post.ID)
+
+	// Opção desligada no blog
+	assert.Equal(t, http.StatusNotFound, send(valid))
+
+	db.Model(blog).Update("reading_stats", true)
+	assert.Equal(t, http.StatusNoContent, send(valid))
+	assert.Equal(t, http.StatusBadRequest, send(fmt.Sprintf(`{"post": %d, "depth": 60, "seconds": 42}`, post.ID)))
+	assert.Equal(t, http.StatusBadRequest, send(`não é json`))
+	assert.Equal(t, http.StatusBadRequest, send(`{"post": 1, "depth": 25, "seconds": `+strings.Repeat("1", 2000)+`}`))
+	assert.Equal(t, http.StatusNotFound, send(`{"post": 999, "depth": 25, "seconds": 10}`))
+}
+
+func TestTopPostURLs(t *testing.T) {
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+
+	popular := &models.Post{BlogID: other.ID, Title: "Popular", Slug: "popular"}
+	quiet := &models.Post{BlogID: blog.ID, Title: "Quieto", Slug: "quieto"}
+	draft := &models.Post{BlogID: blog.ID, Title: "Rascunho", Slug: "rascunho", Draft: true}
+	db.Create(popular)
+	db.Create(quiet)
+	db.Create(draft)
+
+	analyticsDB := dbtest.Open(t)
+	analyticsModule := analytics.NewAnalyticsModule(analyticsDB)
+	defer analyticsModule.Close()
+
+	// Um insert só, com uma linha de hoje: o rollup que roda ao criar o
+	// módulo, se vier depois, só refaz ontem e hoje
+	day := time.Now().AddDate(0, 0, -2).Format("2006-01-02")
+	assert.NoError(t, analyticsDB.Create(&[]analytics.DailyRollup{
+		{BlogID: blog.ID, Day: time.Now().Format("2006-01-02"), Dimension: analytics.DimensionTotal, Visits: 1},
+		{BlogID: blog.ID, Day: day, Dimension: analytics.DimensionPost, Value: fmt.Sprint(quiet.ID), Visits: 3},
+		{BlogID: blog.ID, Day: day, Dimension: analytics.DimensionPost, Value: fmt.Sprint(draft.ID), Visits: 50},
+		{BlogID: other.ID, Day: day, Dimension: analytics.DimensionPost, Value: fmt.Sprint(popular.ID), Visits: 20},
+	}).Error)
+
+	b := NewBlogModule(db, analyticsModule)
+	// Os mais visitados de todos os blogs juntos, sem rascunhos
+	assert.Equal(t, []string{
+		"https://harmonista.org/@/outro/popular",
+		"https://harmonista.org/@/testblog/quieto",
+	}, b.topPostURLs(10))
+	assert.Equal(t, []string{"https://harmonista.org/@/outro/popular"}, b.topPostURLs(2))
+
+	// Sem analytics não há o que aquecer
+	assert.Empty(t, NewBlogModule(db, nil).topPostURLs(10))
+}
+
+func TestOldSlugRedirect(t *testing.T) {
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID, false)
+	page := &models.Page{BlogID: blog.ID, Title: "Sobre", Slug: "sobre-mim"}
+	db.Create(page)
+	db.Create(&[]models.SlugRedirect{
+		{BlogID: blog.ID, Kind: models.SlugKindPost, Slug: "antigo", TargetID: post.ID},
+		{BlogID: blog.ID, Kind: models.SlugKindPost, Slug: "mais-antigo", TargetID: post.ID},
+		{BlogID: blog.ID, Kind: models.SlugKindPage, Slug: "sobre", TargetID: page.ID},
+		{BlogID: blog.ID + 1, Kind: models.SlugKindPost, Slug: "de-outro-blog", TargetID: post.ID},
+	})
+
+	router := setupTestRouter(NewBlogModule(db, nil))
+	router.SetHTMLTemplate(template.Must(template.New("blog_error.html").Parse("{{.error}}")))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/@/testblog/antigo?css=/public/css/temas/a.css")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://harmonista.org/@/testblog/"+post.Slug+"?css=/public/css/temas/a.css", w.Header().Get("Location"))
+	assert.Equal(t, "https://harmonista.org/@/testblog/"+post.Slug, get("/@/testblog/mais-antigo").Header().Get("Location"))
+	assert.Equal(t, "https://harmonista.org/@/testblog/p/sobre-mim", get("/@/testblog/p/sobre").Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/de-outro-blog").Code)
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/p/antigo").Code)
+
+	// Rascunho não tem endereço público para onde ir
+	db.Model(post).Update("draft", true)
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/antigo").Code)
+}
+
+func TestTrashedPostHidden(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	post := createTestPost(db, blog.ID, false)
+	kept := createTestPost(db, blog.ID, false)
+	tag := &models.Tag{BlogID: blog.ID, Title: "Go", Name: "go"}
+	db.Create(tag)
+	db.Create(&[]models.PostTag{{PostID: int(post.ID), TagID: int(tag.ID)}, {PostID: int(kept.ID), TagID: int(tag.ID)}})
+	db.Create(&models.SlugRedirect{BlogID: blog.ID, Kind: models.SlugKindPost, Slug: "antigo", TargetID: post.ID})
+	db.Delete(post)
+
+	router := setupTestRouter(NewBlogModule(db, nil))
+	templates := template.Must(template.New("blog_error.html").Parse("{{.error}}"))
+	template.Must(templates.New("blog_tag.html").Parse("{{range .posts}}{{.Slug}};{{end}}"))
+	router.SetHTMLTemplate(templates)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/"+post.Slug).Code)
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/antigo").Code)
+	assert.Equal(t, kept.Slug+";", get("/@/testblog/t/go").Body.String())
+}
+
+func TestTag_ScopedCaseInsensitive(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(db)
+	blog := createTestBlog(db, user.ID)
+	other := &models.Blog{UserID: user.ID, Title: "Outro", Subdomain: "outro"}
+	db.Create(other)
+	db.Create(&[]models.Tag{
+		{BlogID: blog.ID, Title: "Banco de Dados", Name: "banco de dados", Description: "Sobre **SQL**"},
+		{BlogID: other.ID, Title: "Só do outro", Name: "só do outro"},
+	})
+
+	router := setupTestRouter(NewBlogModule(db, nil))
+	templates := template.Must(template.New("blog_error.html").Parse("{{.error}}"))
+	template.Must(templates.New("blog_tag.html").Parse("{{.tag.Title}}|{{.tagDescriptionHTML}}"))
+	router.SetHTMLTemplate(templates)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/@/testblog/t/BANCO%20DE%20DADOS")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Banco de Dados|")
+	assert.Contains(t, w.Body.String(), "<strong>SQL</strong>")
+	assert.Equal(t, http.StatusNotFound, get("/@/testblog/t/s%C3%B3%20do%20outro").Code)
+}
@@ -0,0 +1,231 @@
+package blog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/text/unicode/norm"
+)
+
+// tocMarker é o parágrafo que vira o sumário do post
+const tocMarker = "[[toc]]"
+
+// headingIDs gera ids de títulos sem acentos ("Introdução" -> "introducao"),
+// já que o gerador padrão do goldmark descarta qualquer caractere não ASCII.
+// Um novo valor é usado a cada conversão para que os ids não vazem entre posts.
+type headingIDs struct {
+	values map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{values: map[string]bool{}}
+}
+
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	id := headingSlug(string(value))
+	if id == "" {
+		id = "secao"
+	}
+
+	result := id
+	for i := 1; s.values[result]; i++ {
+		result = fmt.Sprintf("%s-%d", id, i)
+	}
+	s.values[result] = true
+	return []byte(result)
+}
+
+func (s *headingIDs) Put(value []byte) {
+	s.values[string(value)] = true
+}
+
+// headingSlug remove acentos e mantém apenas letras, números e hífens
+func headingSlug(title string) string {
+	var b strings.Builder
+	lastHyphen := true
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// marca de acento separada pela normalização
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			lastHyphen = false
+		case r == ' ' || r == '-' || r == '_':
+			if !lastHyphen {
+				b.WriteByte('-')
+				lastHyphen = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// headings adiciona links permanentes aos títulos e expande o marcador
+// [[toc]] em um sumário aninhado. Depende de parser.WithAutoHeadingID.
+type headings struct {
+	anchors bool
+	toc     bool
+}
+
+func (e *headings) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 100),
+	))
+	if e.toc {
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(
+			util.Prioritized(&tocRenderer{}, 100),
+		))
+	}
+}
+
+type headingEntry struct {
+	node *ast.Heading
+	id   []byte
+	text []byte
+}
+
+func (e *headings) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var entries []headingEntry
+	var markers []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			if id, ok := node.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					entries = append(entries, headingEntry{node: node, id: b, text: altText(node, source)})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			if e.toc && isTOCMarker(node, source) {
+				markers = append(markers, node)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, marker := range markers {
+		toc := &tocNode{}
+		if list := buildTOC(entries); list != nil {
+			toc.AppendChild(toc, list)
+		}
+		marker.Parent().ReplaceChild(marker.Parent(), marker, toc)
+	}
+
+	if e.anchors {
+		for _, entry := range entries {
+			addHeadingAnchor(entry.node, entry.id)
+		}
+	}
+}
+
+func isTOCMarker(p *ast.Paragraph, source []byte) bool {
+	lines := p.Lines()
+	if lines.Len() != 1 {
+		return false
+	}
+	line := lines.At(0)
+	return strings.EqualFold(string(bytes.TrimSpace(line.Value(source))), tocMarker)
+}
+
+// buildTOC monta listas aninhadas a partir dos níveis dos títulos. O menor
+// nível encontrado vira a raiz; saltos de nível (h2 -> h4) entram como
+// um único nível de aninhamento.
+func buildTOC(entries []headingEntry) *ast.List {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	root := newTOCList()
+	lists := []*ast.List{root}
+	levels := []int{entries[0].node.Level}
+	var lastItem *ast.ListItem
+
+	for _, entry := range entries {
+		for len(levels) > 1 && entry.node.Level < levels[len(levels)-1] {
+			lists = lists[:len(lists)-1]
+			levels = levels[:len(levels)-1]
+		}
+		if entry.node.Level > levels[len(levels)-1] && lastItem != nil {
+			child := newTOCList()
+			lastItem.AppendChild(lastItem, child)
+			lists = append(lists, child)
+			levels = append(levels, entry.node.Level)
+		}
+
+		link := ast.NewLink()
+		link.Destination = append([]byte("#"), entry.id...)
+		link.AppendChild(link, ast.NewString(entry.text))
+
+		block := ast.NewTextBlock()
+		block.AppendChild(block, link)
+
+		lastItem = ast.NewListItem(2)
+		lastItem.AppendChild(lastItem, block)
+
+		current := lists[len(lists)-1]
+		current.AppendChild(current, lastItem)
+	}
+
+	return root
+}
+
+func newTOCList() *ast.List {
+	list := ast.NewList('-')
+	list.IsTight = true
+	return list
+}
+
+// addHeadingAnchor coloca um link "#" no fim do título
+func addHeadingAnchor(heading *ast.Heading, id []byte) {
+	link := ast.NewLink()
+	link.Destination = append([]byte("#"), id...)
+	link.Title = []byte("Link permanente")
+	link.SetAttributeString("class", []byte("heading-anchor"))
+	link.AppendChild(link, ast.NewString([]byte("#")))
+	heading.AppendChild(heading, link)
+}
+
+// kindTOC é o nó que envolve o sumário gerado a partir de [[toc]]
+var kindTOC = ast.NewNodeKind("TOC")
+
+type tocNode struct {
+	ast.BaseBlock
+}
+
+func (n *tocNode) Kind() ast.NodeKind {
+	return kindTOC
+}
+
+func (n *tocNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type tocRenderer struct{}
+
+func (r *tocRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindTOC, r.renderTOC)
+}
+
+func (r *tocRenderer) renderTOC(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<nav class="toc">` + "\n")
+	} else {
+		_, _ = w.WriteString("</nav>\n")
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,203 @@
+package blog
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"harmonista/media"
+	"harmonista/models"
+)
+
+// imageSizes corresponde à largura máxima da coluna de texto dos temas
+const imageSizes = "(max-width: 800px) 100vw, 800px"
+
+// mediaLookup busca de uma vez as mídias do blog usadas nas imagens de um
+// conteúdo, pelo caminho local ("/uploads/..."), e devolve as encontradas
+type mediaLookup func(blogID int, paths []string) map[string]*models.Media
+
+// mediaBlogKey guarda no parser.Context o ID do blog dono do conteúdo. Sem
+// ele as imagens são renderizadas como no renderer padrão.
+var mediaBlogKey = parser.NewContextKey()
+
+// kindMediaImage é uma imagem da biblioteca de mídia do blog
+var kindMediaImage = ast.NewNodeKind("MediaImage")
+
+type mediaImage struct {
+	ast.BaseInline
+	image *ast.Image
+	media *models.Media
+}
+
+func (n *mediaImage) Kind() ast.NodeKind {
+	return kindMediaImage
+}
+
+func (n *mediaImage) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"URL": n.media.URL}, nil)
+}
+
+// responsiveImages é uma extensão do goldmark que troca imagens da
+// biblioteca de mídia por <img srcset> (e <picture> quando houver WebP),
+// usando as dimensões guardadas das variantes. As mídias do post são
+// buscadas em uma só consulta, antes de renderizar; outras imagens são
+// renderizadas como no renderer padrão.
+type responsiveImages struct {
+	lookup mediaLookup
+}
+
+func (e *responsiveImages) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 100),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&imageRenderer{Config: html.NewConfig()}, 100),
+	))
+}
+
+func (e *responsiveImages) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	blogID, ok := pc.Get(mediaBlogKey).(int)
+	if !ok {
+		return
+	}
+
+	var images []*ast.Image
+	var paths []string
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := n.(*ast.Image); ok && entering {
+			if path := localMediaPath(string(image.Destination)); path != "" {
+				images = append(images, image)
+				paths = append(paths, path)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(images) == 0 {
+		return
+	}
+
+	found := e.lookup(blogID, paths)
+	for i, image := range images {
+		if item, ok := found[paths[i]]; ok {
+			image.Parent().ReplaceChild(image.Parent(), image, &mediaImage{image: image, media: item})
+		}
+	}
+}
+
+type imageRenderer struct {
+	html.Config
+}
+
+func (r *imageRenderer) SetOption(name renderer.OptionName, value interface{}) {
+	r.Config.SetOption(name, value)
+}
+
+func (r *imageRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMediaImage, r.renderMediaImage)
+}
+
+func (r *imageRenderer) renderMediaImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := node.(*mediaImage)
+		r.renderResponsive(w, source, n.image, n.media)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *imageRenderer) renderResponsive(w util.BufWriter, source []byte, n *ast.Image, item *models.Media) {
+	var fallback, webp []media.Variant
+	for _, v := range media.ParseVariants(item) {
+		if v.ContentType == "image/webp" {
+			webp = append(webp, v)
+		} else {
+			fallback = append(fallback, v)
+		}
+	}
+
+	// O original também entra no srcset do formato de origem
+	fallback = append(fallback, media.Variant{URL: item.URL, Width: item.Width, Height: item.Height})
+
+	if len(webp) > 0 {
+		_, _ = w.WriteString(`<picture><source type="image/webp" srcset="`)
+		_, _ = w.WriteString(srcset(webp))
+		_, _ = w.WriteString(`" sizes="` + imageSizes + `">`)
+	}
+
+	_, _ = w.WriteString(`<img src="`)
+	_, _ = w.Write(util.EscapeHTML(util.URLEscape([]byte(item.URL), true)))
+	_, _ = w.WriteString(`" alt="`)
+	_, _ = w.Write(util.EscapeHTML(altText(n, source)))
+	_ = w.WriteByte('"')
+	if len(fallback) > 1 {
+		_, _ = w.WriteString(` srcset="` + srcset(fallback) + `" sizes="` + imageSizes + `"`)
+	}
+	_, _ = fmt.Fprintf(w, ` width="%d" height="%d" loading="lazy" decoding="async"`, item.Width, item.Height)
+	r.renderTitleAndAttributes(w, n)
+	_, _ = w.WriteString(">")
+
+	if len(webp) > 0 {
+		_, _ = w.WriteString(`</picture>`)
+	}
+}
+
+func (r *imageRenderer) renderTitleAndAttributes(w util.BufWriter, n *ast.Image) {
+	if n.Title != nil {
+		_, _ = w.WriteString(` title="`)
+		_, _ = w.Write(util.EscapeHTML(n.Title))
+		_ = w.WriteByte('"')
+	}
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, n, html.ImageAttributeFilter)
+	}
+}
+
+// srcset monta a lista "url largura w" ordenada da menor para a maior
+func srcset(variants []media.Variant) string {
+	sort.Slice(variants, func(i, j int) bool { return variants[i].Width < variants[j].Width })
+
+	parts := make([]string, 0, len(variants))
+	for _, v := range variants {
+		parts = append(parts, fmt.Sprintf("%s %dw", util.EscapeHTML(util.URLEscape([]byte(v.URL), true)), v.Width))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// altText concatena o texto dos filhos da imagem (o "alt" do Markdown)
+func altText(n ast.Node, source []byte) []byte {
+	var buf []byte
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			buf = append(buf, t.Segment.Value(source)...)
+		case *ast.String:
+			buf = append(buf, t.Value...)
+		default:
+			buf = append(buf, altText(c, source)...)
+		}
+	}
+	return buf
+}
+
+// localMediaPath converte URLs absolutas do próprio domínio em caminho
+// local ("/uploads/..."); URLs externas retornam vazio
+func localMediaPath(url string) string {
+	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") {
+		return url
+	}
+
+	domain := strings.TrimSuffix(os.Getenv("DOMAIN"), "/")
+	if domain != "" && strings.HasPrefix(url, domain+"/") {
+		return strings.TrimPrefix(url, domain)
+	}
+
+	return ""
+}
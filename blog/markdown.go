@@ -0,0 +1,131 @@
+package blog
+
+import (
+	"bytes"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	htmlrenderer "github.com/yuin/goldmark/renderer/html"
+
+	"harmonista/models"
+)
+
+// codeHighlighting colors fenced code blocks with chroma using CSS classes
+// (each theme sets its palette; base.css derives one for themes that
+// don't), so no inline styles are emitted. Fence attributes enable line
+// numbers and highlighted lines:
+//
+//	```go {linenos=true, hl_lines=[2, "4-5"], linenostart=10}
+var codeHighlighting = highlighting.NewHighlighting(
+	highlighting.WithFormatOptions(
+		chromahtml.WithClasses(true),
+	),
+)
+
+// markdownOptions are the optional Markdown features a blog can turn on
+// in its settings. It is comparable so it can key the renderer cache.
+type markdownOptions struct {
+	Footnotes       bool
+	HeadingAnchors  bool
+	DefinitionLists bool
+	Typographer     bool
+	TOC             bool
+}
+
+func markdownOptionsFor(blog *models.Blog) markdownOptions {
+	if blog == nil {
+		return markdownOptions{}
+	}
+	return markdownOptions{
+		Footnotes:       blog.MarkdownFootnotes,
+		HeadingAnchors:  blog.MarkdownHeadingAnchors,
+		DefinitionLists: blog.MarkdownDefinitionLists,
+		Typographer:     blog.MarkdownTypographer,
+		TOC:             blog.MarkdownTOC,
+	}
+}
+
+// headingIDs reports whether headings need generated ids
+func (o markdownOptions) headingIDs() bool {
+	return o.HeadingAnchors || o.TOC
+}
+
+// newMarkdown builds the Goldmark renderer. When lookup is set, images
+// hosted in the media library are rendered with srcset.
+func newMarkdown(lookup mediaLookup, opts markdownOptions) goldmark.Markdown {
+	extensions := []goldmark.Extender{
+		extension.GFM,     // tables, strikethrough, task lists, autolinks (GFM set)
+		extension.Linkify, // linkify raw URLs
+		codeHighlighting,  // server-side syntax highlighting for fenced code
+		mathExtension,     // $...$ and $$...$$ rendered as MathML
+	}
+	if lookup != nil {
+		extensions = append(extensions, &responsiveImages{lookup: lookup})
+	}
+	if opts.Footnotes {
+		extensions = append(extensions, extension.NewFootnote(
+			extension.WithFootnoteBacklinkTitle("Voltar ao texto"),
+		))
+	}
+	if opts.DefinitionLists {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+	if opts.Typographer {
+		extensions = append(extensions, portugueseTypographer)
+	}
+	if opts.headingIDs() {
+		extensions = append(extensions, &headings{anchors: opts.HeadingAnchors, toc: opts.TOC})
+	}
+
+	var parserOptions []parser.Option
+	if opts.headingIDs() {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(
+			htmlrenderer.WithUnsafe(), // allow raw HTML passthrough in Markdown
+		),
+	)
+}
+
+// markdownFor returns the module renderer (with media lookup) for the
+// blog's feature set, building it on first use
+func (b *BlogModule) markdownFor(opts markdownOptions) goldmark.Markdown {
+	if cached, ok := b.renderers.Load(opts); ok {
+		return cached.(goldmark.Markdown)
+	}
+	cached, _ := b.renderers.LoadOrStore(opts, newMarkdown(b.findMedia, opts))
+	return cached.(goldmark.Markdown)
+}
+
+// renderMarkdown renders content with the features enabled for the blog
+func (b *BlogModule) renderMarkdown(blog *models.Blog, content string) string {
+	opts := markdownOptionsFor(blog)
+	return convertMarkdown(b.markdownFor(opts), content, blog, opts)
+}
+
+// convertMarkdown renders content; blog, when set, scopes the media
+// library lookups of the images
+func convertMarkdown(md goldmark.Markdown, content string, blog *models.Blog, opts markdownOptions) string {
+	var contextOptions []parser.ContextOption
+	if opts.headingIDs() {
+		contextOptions = append(contextOptions, parser.WithIDs(newHeadingIDs()))
+	}
+	pc := parser.NewContext(contextOptions...)
+	if blog != nil {
+		pc.Set(mediaBlogKey, blog.ID)
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(content), &buf, parser.WithContext(pc)); err != nil {
+		// Em caso de erro, retorna o conteúdo original para não quebrar a página
+		return content
+	}
+	return buf.String()
+}
@@ -0,0 +1,254 @@
+package blog
+
+import (
+	"bytes"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mathExtension renderiza $...$ (inline) e $$...$$ (destaque) como MathML
+// no servidor, sem JavaScript. Para não confundir preços ("R$ 10",
+// "R$5 e R$6"), o $ de abertura não pode vir colado a letras ou números
+// nem seguido de espaço, e o de fechamento não pode ser seguido de dígito.
+// Expressões inválidas aparecem como código com a classe math-error.
+var mathExtension = &mathMarkdown{}
+
+type mathMarkdown struct{}
+
+func (e *mathMarkdown) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 701)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 501)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&mathRenderer{}, 100),
+	))
+}
+
+// kindMath é uma expressão $...$ ou $$...$$ dentro de um parágrafo
+var kindMath = ast.NewNodeKind("Math")
+
+type mathInline struct {
+	ast.BaseInline
+	literal []byte
+	display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind {
+	return kindMath
+}
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Literal": string(n.literal)}, nil)
+}
+
+// kindMathBlock é um bloco $$ ... $$ que pode ocupar várias linhas
+var kindMathBlock = ast.NewNodeKind("MathBlock")
+
+type mathBlock struct {
+	ast.BaseBlock
+	literal []byte
+	closed  bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind {
+	return kindMathBlock
+}
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Literal": string(n.literal)}, nil)
+}
+
+type mathInlineParser struct{}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+		return nil
+	}
+
+	line, _ := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+
+	end := findMathClose(line, delim)
+	if end < 0 {
+		return nil
+	}
+
+	node := &mathInline{
+		literal: append([]byte(nil), line[delim:end]...),
+		display: delim == 2,
+	}
+	block.Advance(end + delim)
+	return node
+}
+
+// findMathClose devolve a posição do delimitador de fechamento na linha,
+// ou -1 se a expressão não fecha nela
+func findMathClose(line []byte, delim int) int {
+	if len(line) <= delim || (delim == 1 && util.IsSpace(line[delim])) {
+		return -1
+	}
+
+	for i := delim; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			if delim == 2 {
+				if i+1 < len(line) && line[i+1] == '$' && i > delim {
+					return i
+				}
+				return -1
+			}
+			if i == delim || util.IsSpace(line[i-1]) {
+				return -1
+			}
+			if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+type mathBlockParser struct{}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &mathBlock{}
+	rest := trimmed[2:]
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		// $$ ... $$ em uma linha só: precisa terminar no fechamento, senão
+		// é texto normal com uma expressão no meio
+		if len(bytes.TrimSpace(rest[end+2:])) > 0 {
+			return nil, parser.NoChildren
+		}
+		node.literal = append(node.literal, rest[:end]...)
+		node.closed = true
+	} else {
+		node.literal = append(node.literal, rest...)
+	}
+
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*mathBlock)
+	if n.closed {
+		return parser.Close
+	}
+
+	line, _ := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+	if end := bytes.Index(line, []byte("$$")); end >= 0 {
+		n.literal = append(n.literal, line[:end]...)
+		n.closed = true
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+
+	n.literal = append(n.literal, line...)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type mathRenderer struct{}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, r.renderMath)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathInline)
+
+	delim := "$"
+	if n.display {
+		delim = "$$"
+	}
+	writeMath(w, string(n.literal), n.display, delim, nil)
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathBlock)
+
+	var err error
+	if !n.closed {
+		err = errMathUnclosed
+	}
+	writeMath(w, string(n.literal), true, "$$", err)
+	_ = w.WriteByte('\n')
+	return ast.WalkSkipChildren, nil
+}
+
+// writeMath escreve o MathML ou, se a expressão for inválida, o LaTeX
+// original como código, com o motivo no title
+func writeMath(w util.BufWriter, tex string, display bool, delim string, err error) {
+	var xml string
+	if err == nil {
+		xml, err = latexToMathML(tex, display)
+	}
+	if err == nil {
+		_, _ = w.WriteString(xml)
+		return
+	}
+
+	source := util.EscapeHTML([]byte(delim + tex + delim))
+	title := util.EscapeHTML([]byte("Erro na fórmula: " + err.Error()))
+	if display {
+		_, _ = w.WriteString(`<pre class="math-error" title="`)
+		_, _ = w.Write(title)
+		_, _ = w.WriteString(`"><code>`)
+		_, _ = w.Write(source)
+		_, _ = w.WriteString(`</code></pre>`)
+		return
+	}
+	_, _ = w.WriteString(`<code class="math-error" title="`)
+	_, _ = w.Write(title)
+	_, _ = w.WriteString(`">`)
+	_, _ = w.Write(source)
+	_, _ = w.WriteString(`</code>`)
+}
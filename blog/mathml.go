@@ -0,0 +1,714 @@
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Conversor de um subconjunto de LaTeX para MathML, feito para o que
+// aparece em posts: frações, raízes, índices, letras gregas, operadores,
+// \left...\right, matrizes e ambientes de alinhamento. Não há JavaScript
+// no cliente; o navegador renderiza o MathML diretamente.
+
+// maxMathDepth limita o aninhamento para que expressões patológicas
+// ("{{{{...") não estourem a pilha
+const maxMathDepth = 64
+
+// functionApplication separa o nome da função do argumento (sin x)
+const functionApplication = "<mo>&#x2061;</mo>"
+
+var (
+	errMathTooDeep  = errors.New("expressão aninhada demais")
+	errMathUnclosed = errors.New("$$ sem fechamento")
+)
+
+// mathItem é um trecho de MathML já renderizado. limits indica operadores
+// cujos índices vão acima/abaixo (\sum, \lim) em vez de à direita; after
+// vem depois dos índices (o operador invisível de aplicação de função).
+type mathItem struct {
+	xml    string
+	limits bool
+	after  string
+}
+
+type mathParser struct {
+	src     []rune
+	pos     int
+	display bool
+	depth   int
+}
+
+// latexToMathML converte a expressão em um elemento <math>, guardando o
+// LaTeX original como anotação
+func latexToMathML(tex string, display bool) (string, error) {
+	p := &mathParser{src: []rune(tex), display: display}
+	items, err := p.parseList()
+	if err != nil {
+		return "", err
+	}
+	if !p.eof() {
+		return "", p.unexpected()
+	}
+
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString(`><semantics><mrow>`)
+	b.WriteString(joinItems(items))
+	b.WriteString(`</mrow><annotation encoding="application/x-tex">`)
+	b.WriteString(html.EscapeString(strings.TrimSpace(tex)))
+	b.WriteString(`</annotation></semantics></math>`)
+	return b.String(), nil
+}
+
+func joinItems(items []mathItem) string {
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString(item.xml)
+	}
+	return b.String()
+}
+
+func row(items []mathItem) string {
+	return "<mrow>" + joinItems(items) + "</mrow>"
+}
+
+func (p *mathParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *mathParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *mathParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *mathParser) unexpected() error {
+	if p.eof() {
+		return errors.New("fim inesperado da expressão")
+	}
+	if p.peek() == '}' {
+		return errors.New("chave } sem abertura")
+	}
+	if cmd, ok := p.peekCommand(); ok {
+		return fmt.Errorf(`\%s fora de lugar`, cmd)
+	}
+	return fmt.Errorf("%q fora de lugar", p.peek())
+}
+
+// peekCommand devolve o nome do comando na posição atual, sem consumir
+func (p *mathParser) peekCommand() (string, bool) {
+	if p.peek() != '\\' {
+		return "", false
+	}
+	saved := p.pos
+	name := p.readCommand()
+	p.pos = saved
+	return name, true
+}
+
+// readCommand consome "\nome" (letras) ou "\x" (um símbolo)
+func (p *mathParser) readCommand() string {
+	p.pos++ // '\'
+	start := p.pos
+	for !p.eof() && isASCIILetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start && !p.eof() {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// atListEnd diz se a lista atual termina aqui: fim do grupo, célula ou
+// linha de tabela, \end, \right ou \middle
+func (p *mathParser) atListEnd() bool {
+	switch p.peek() {
+	case '}', '&':
+		return true
+	}
+	if cmd, ok := p.peekCommand(); ok {
+		switch cmd {
+		case `\`, "end", "right", "middle":
+			return true
+		}
+	}
+	return false
+}
+
+func (p *mathParser) parseList() ([]mathItem, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxMathDepth {
+		return nil, errMathTooDeep
+	}
+
+	var items []mathItem
+	for {
+		p.skipSpace()
+		if p.eof() || p.atListEnd() {
+			return items, nil
+		}
+		item, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// parseAtom lê um elemento e seus índices (^, _ e apóstrofos)
+func (p *mathParser) parseAtom() (mathItem, error) {
+	var base mathItem
+	if c := p.peek(); c == '^' || c == '_' {
+		base = mathItem{xml: "<mrow></mrow>"}
+	} else {
+		var err error
+		if base, err = p.parsePrimary(false); err != nil {
+			return mathItem{}, err
+		}
+	}
+
+	var sub, sup string
+	for {
+		p.skipSpace()
+		switch c := p.peek(); {
+		case c == '^' || c == '_':
+			p.pos++
+			arg, err := p.parseArgument()
+			if err != nil {
+				return mathItem{}, err
+			}
+			if c == '^' {
+				if sup != "" {
+					return mathItem{}, errors.New("expoente duplo")
+				}
+				sup = arg
+			} else {
+				if sub != "" {
+					return mathItem{}, errors.New("índice duplo")
+				}
+				sub = arg
+			}
+		case c == '\'':
+			primes := 0
+			for p.peek() == '\'' {
+				primes++
+				p.pos++
+			}
+			if sup != "" {
+				return mathItem{}, errors.New("expoente duplo")
+			}
+			sup = "<mo>" + strings.Repeat("′", primes) + "</mo>"
+		default:
+			if cmd, ok := p.peekCommand(); ok && (cmd == "limits" || cmd == "nolimits") {
+				p.readCommand()
+				base.limits = cmd == "limits"
+				continue
+			}
+			return attachScripts(base, sub, sup), nil
+		}
+	}
+}
+
+func attachScripts(base mathItem, sub, sup string) mathItem {
+	under, over, both := "msub", "msup", "msubsup"
+	if base.limits {
+		under, over, both = "munder", "mover", "munderover"
+	}
+
+	xml := base.xml
+	switch {
+	case sub != "" && sup != "":
+		xml = "<" + both + ">" + base.xml + sub + sup + "</" + both + ">"
+	case sub != "":
+		xml = "<" + under + ">" + base.xml + sub + "</" + under + ">"
+	case sup != "":
+		xml = "<" + over + ">" + base.xml + sup + "</" + over + ">"
+	}
+	return mathItem{xml: xml + base.after}
+}
+
+// parseArgument lê o argumento de um comando ou índice: um grupo {...}
+// ou um único símbolo (x^2, \frac12)
+func (p *mathParser) parseArgument() (string, error) {
+	p.skipSpace()
+	if p.eof() {
+		return "", errors.New("argumento ausente")
+	}
+	if p.peek() == '{' {
+		return p.parseGroup()
+	}
+	if p.atListEnd() || p.peek() == '^' || p.peek() == '_' {
+		return "", p.unexpected()
+	}
+	item, err := p.parsePrimary(true)
+	if err != nil {
+		return "", err
+	}
+	return item.xml + item.after, nil
+}
+
+func (p *mathParser) parseGroup() (string, error) {
+	p.pos++ // '{'
+	items, err := p.parseList()
+	if err != nil {
+		return "", err
+	}
+	if p.peek() != '}' {
+		if p.eof() {
+			return "", errors.New("chave { sem fechamento")
+		}
+		return "", p.unexpected()
+	}
+	p.pos++
+	return row(items), nil
+}
+
+// readRawGroup lê {texto} sem interpretar, para \text e nomes de ambiente
+func (p *mathParser) readRawGroup() (string, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return "", errors.New("esperava {")
+	}
+	p.pos++
+	start, level := p.pos, 1
+	for ; !p.eof(); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			level++
+		case '}':
+			level--
+			if level == 0 {
+				text := string(p.src[start:p.pos])
+				p.pos++
+				return text, nil
+			}
+		}
+	}
+	return "", errors.New("chave { sem fechamento")
+}
+
+// readOptional lê [texto] opcional, devolvendo "" quando ausente
+func (p *mathParser) readOptional() (string, bool, error) {
+	p.skipSpace()
+	if p.peek() != '[' {
+		return "", false, nil
+	}
+	p.pos++
+	start, level := p.pos, 0
+	for ; !p.eof(); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			level++
+		case '}':
+			level--
+		case ']':
+			if level == 0 {
+				text := string(p.src[start:p.pos])
+				p.pos++
+				return text, true, nil
+			}
+		}
+	}
+	return "", false, errors.New("colchete [ sem fechamento")
+}
+
+// parsePrimary lê um elemento sem índices. Com single, números ocupam
+// um só dígito, como nos argumentos do LaTeX (x^23 é x² seguido de 3).
+func (p *mathParser) parsePrimary(single bool) (mathItem, error) {
+	c := p.peek()
+	switch {
+	case c == '{':
+		xml, err := p.parseGroup()
+		return mathItem{xml: xml}, err
+	case c == '\\':
+		return p.parseCommand()
+	case c >= '0' && c <= '9' || c == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]):
+		start := p.pos
+		p.pos++
+		for !single && !p.eof() && (isDigit(p.peek()) || p.peek() == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1])) {
+			p.pos++
+		}
+		return mathItem{xml: "<mn>" + string(p.src[start:p.pos]) + "</mn>"}, nil
+	case unicode.IsLetter(c):
+		p.pos++
+		return mathItem{xml: "<mi>" + html.EscapeString(string(c)) + "</mi>"}, nil
+	case c == '~':
+		p.pos++
+		return space("0.2778em"), nil
+	case c == '#' || c == '%' || c == '$':
+		return mathItem{}, fmt.Errorf("caractere %q não permitido", c)
+	case c == '}' || c == '&':
+		return mathItem{}, p.unexpected()
+	}
+
+	p.pos++
+	return operator(string(c)), nil
+}
+
+func operator(symbol string) mathItem {
+	switch symbol {
+	case "-":
+		symbol = "−"
+	case "*":
+		symbol = "∗"
+	}
+	return mathItem{xml: "<mo>" + html.EscapeString(symbol) + "</mo>"}
+}
+
+func identifier(symbol string) mathItem {
+	return mathItem{xml: "<mi>" + html.EscapeString(symbol) + "</mi>"}
+}
+
+func space(width string) mathItem {
+	return mathItem{xml: `<mspace width="` + width + `"></mspace>`}
+}
+
+func (p *mathParser) parseCommand() (mathItem, error) {
+	start := p.pos
+	name := p.readCommand()
+
+	if symbol, ok := mathGreek[name]; ok {
+		if unicode.IsUpper([]rune(symbol)[0]) {
+			return mathItem{xml: `<mi mathvariant="normal">` + symbol + "</mi>"}, nil
+		}
+		return identifier(symbol), nil
+	}
+	if symbol, ok := mathIdentifiers[name]; ok {
+		return identifier(symbol), nil
+	}
+	if symbol, ok := mathOperators[name]; ok {
+		return operator(symbol), nil
+	}
+	if symbol, ok := mathBigOperators[name]; ok {
+		// Somatórios e afins levam os limites acima/abaixo só em destaque;
+		// integrais mantêm os índices ao lado
+		limits := p.display && !strings.Contains(name, "int")
+		return mathItem{xml: `<mo largeop="true" movablelimits="true">` + symbol + "</mo>", limits: limits}, nil
+	}
+	if width, ok := mathSpaces[name]; ok {
+		return space(width), nil
+	}
+	if _, ok := mathFunctions[name]; ok {
+		limits := p.display && mathFunctions[name]
+		return mathItem{xml: "<mi>" + name + "</mi>", limits: limits, after: functionApplication}, nil
+	}
+	if variant, ok := mathFonts[name]; ok {
+		return p.parseFont(variant)
+	}
+	if accent, ok := mathAccents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		if accent.under {
+			return mathItem{xml: `<munder accentunder="true">` + arg + `<mo stretchy="true">` + accent.symbol + "</mo></munder>"}, nil
+		}
+		return mathItem{xml: `<mover accent="true">` + arg + `<mo stretchy="` + fmt.Sprint(accent.stretchy) + `">` + accent.symbol + "</mo></mover>"}, nil
+	}
+	if size, ok := mathDelimiterSizes[name]; ok {
+		delim, err := p.parseDelimiter()
+		if err != nil {
+			return mathItem{}, err
+		}
+		return mathItem{xml: `<mo minsize="` + size + `" maxsize="` + size + `">` + delim + "</mo>"}, nil
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		return mathItem{xml: "<mfrac>" + num + den + "</mfrac>"}, nil
+	case "binom":
+		n, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		k, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		return mathItem{xml: `<mrow><mo>(</mo><mfrac linethickness="0">` + n + k + "</mfrac><mo>)</mo></mrow>"}, nil
+	case "sqrt":
+		index, hasIndex, err := p.readOptional()
+		if err != nil {
+			return mathItem{}, err
+		}
+		radicand, err := p.parseArgument()
+		if err != nil {
+			return mathItem{}, err
+		}
+		if !hasIndex {
+			return mathItem{xml: "<msqrt>" + radicand + "</msqrt>"}, nil
+		}
+		sub := &mathParser{src: []rune(index), display: p.display, depth: p.depth}
+		items, err := sub.parseList()
+		if err != nil {
+			return mathItem{}, err
+		}
+		if !sub.eof() {
+			return mathItem{}, sub.unexpected()
+		}
+		return mathItem{xml: "<mroot>" + radicand + row(items) + "</mroot>"}, nil
+	case "text", "textrm", "textup", "textnormal", "mbox", "textbf", "textit":
+		text, err := p.readRawGroup()
+		if err != nil {
+			return mathItem{}, err
+		}
+		variant := ""
+		switch name {
+		case "textbf":
+			variant = ` mathvariant="bold"`
+		case "textit":
+			variant = ` mathvariant="italic"`
+		}
+		return mathItem{xml: "<mtext" + variant + ">" + html.EscapeString(unescapeText(text)) + "</mtext>"}, nil
+	case "operatorname":
+		text, err := p.readRawGroup()
+		if err != nil {
+			return mathItem{}, err
+		}
+		return mathItem{xml: "<mi>" + html.EscapeString(strings.TrimSpace(text)) + "</mi>", after: functionApplication}, nil
+	case "left":
+		return p.parseLeftRight()
+	case "middle":
+		return mathItem{}, errors.New(`\middle fora de \left...\right`)
+	case "right":
+		return mathItem{}, errors.New(`\right sem \left`)
+	case "begin":
+		return p.parseEnvironment()
+	case "end":
+		return mathItem{}, errors.New(`\end sem \begin`)
+	case "displaystyle", "textstyle":
+		return mathItem{}, nil
+	case `\`:
+		return mathItem{}, errors.New(`quebra de linha \\ fora de um ambiente (use \begin{aligned})`)
+	}
+
+	return mathItem{}, fmt.Errorf("comando desconhecido: %s", string(p.src[start:p.pos]))
+}
+
+// parseFont aplica \mathbf, \mathbb etc. Letras viram um único <mi> com a
+// variante; expressões mais complexas usam <mstyle>.
+func (p *mathParser) parseFont(variant string) (mathItem, error) {
+	p.skipSpace()
+	if p.peek() == '{' {
+		saved := p.pos
+		text, err := p.readRawGroup()
+		if err != nil {
+			return mathItem{}, err
+		}
+		if text != "" && isPlainWord(text) {
+			return mathItem{xml: `<mi mathvariant="` + variant + `">` + text + "</mi>"}, nil
+		}
+		p.pos = saved
+	}
+
+	arg, err := p.parseArgument()
+	if err != nil {
+		return mathItem{}, err
+	}
+	return mathItem{xml: `<mstyle mathvariant="` + variant + `">` + arg + "</mstyle>"}, nil
+}
+
+// parseDelimiter lê o delimitador depois de \left, \right ou \big
+func (p *mathParser) parseDelimiter() (string, error) {
+	p.skipSpace()
+	if p.eof() {
+		return "", errors.New("delimitador ausente")
+	}
+	if p.peek() == '\\' {
+		name := p.readCommand()
+		if symbol, ok := mathDelimiters[name]; ok {
+			return symbol, nil
+		}
+		return "", fmt.Errorf(`delimitador inválido: \%s`, name)
+	}
+	c := p.peek()
+	if strings.ContainsRune("()[]|./<>", c) {
+		p.pos++
+		switch c {
+		case '.':
+			return "", nil
+		case '<':
+			return "⟨", nil
+		case '>':
+			return "⟩", nil
+		}
+		return html.EscapeString(string(c)), nil
+	}
+	return "", fmt.Errorf("delimitador inválido: %q", c)
+}
+
+func fence(symbol string) string {
+	if symbol == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + symbol + "</mo>"
+}
+
+func (p *mathParser) parseLeftRight() (mathItem, error) {
+	open, err := p.parseDelimiter()
+	if err != nil {
+		return mathItem{}, err
+	}
+
+	var b strings.Builder
+	b.WriteString("<mrow>" + fence(open))
+	for {
+		items, err := p.parseList()
+		if err != nil {
+			return mathItem{}, err
+		}
+		b.WriteString(joinItems(items))
+
+		cmd, ok := p.peekCommand()
+		if !ok || (cmd != "middle" && cmd != "right") {
+			if p.eof() {
+				return mathItem{}, errors.New(`\left sem \right`)
+			}
+			return mathItem{}, p.unexpected()
+		}
+		p.readCommand()
+		delim, err := p.parseDelimiter()
+		if err != nil {
+			return mathItem{}, err
+		}
+		if cmd == "right" {
+			b.WriteString(fence(delim) + "</mrow>")
+			return mathItem{xml: b.String()}, nil
+		}
+		b.WriteString(`<mo stretchy="true">` + delim + "</mo>")
+	}
+}
+
+// parseEnvironment converte \begin{...}...\end{...} em <mtable>
+func (p *mathParser) parseEnvironment() (mathItem, error) {
+	env, err := p.readRawGroup()
+	if err != nil {
+		return mathItem{}, err
+	}
+	style, ok := mathEnvironments[env]
+	if !ok {
+		return mathItem{}, fmt.Errorf("ambiente desconhecido: %s", env)
+	}
+	if env == "array" {
+		// A especificação de colunas ({lcr}) é ignorada
+		if _, err := p.readRawGroup(); err != nil {
+			return mathItem{}, err
+		}
+	}
+
+	var rows [][]string
+	var cells []string
+	for {
+		items, err := p.parseList()
+		if err != nil {
+			return mathItem{}, err
+		}
+		cells = append(cells, joinItems(items))
+
+		if p.peek() == '&' {
+			p.pos++
+			continue
+		}
+		cmd, ok := p.peekCommand()
+		if !ok {
+			if p.eof() {
+				return mathItem{}, fmt.Errorf(`\begin{%s} sem \end`, env)
+			}
+			return mathItem{}, p.unexpected()
+		}
+		switch cmd {
+		case `\`:
+			p.readCommand()
+			if _, _, err := p.readOptional(); err != nil { // espaçamento extra: \\[2pt]
+				return mathItem{}, err
+			}
+			rows = append(rows, cells)
+			cells = nil
+			continue
+		case "end":
+			p.readCommand()
+			end, err := p.readRawGroup()
+			if err != nil {
+				return mathItem{}, err
+			}
+			if end != env {
+				return mathItem{}, fmt.Errorf(`\begin{%s} fechado com \end{%s}`, env, end)
+			}
+		default:
+			return mathItem{}, p.unexpected()
+		}
+		break
+	}
+	// Uma quebra \\ no fim não cria linha vazia
+	if len(cells) > 1 || cells[0] != "" {
+		rows = append(rows, cells)
+	}
+
+	var b strings.Builder
+	b.WriteString("<mtable")
+	if style.align != "" {
+		b.WriteString(` columnalign="` + style.align + `"`)
+	}
+	if style.displaystyle {
+		b.WriteString(` displaystyle="true"`)
+	}
+	b.WriteString(">")
+	for _, cells := range rows {
+		b.WriteString("<mtr>")
+		for _, cell := range cells {
+			b.WriteString("<mtd><mrow>" + cell + "</mrow></mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+
+	if style.open == "" && style.close == "" {
+		return mathItem{xml: b.String()}, nil
+	}
+	return mathItem{xml: "<mrow>" + fence(style.open) + b.String() + fence(style.close) + "</mrow>"}, nil
+}
+
+func unescapeText(text string) string {
+	return strings.NewReplacer(`\{`, "{", `\}`, "}", `\$`, "$", `\%`, "%", `\&`, "&", `\_`, "_", `\#`, "#", "~", " ").Replace(text)
+}
+
+func isPlainWord(text string) bool {
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,124 @@
+package blog
+
+// Tabelas de comandos LaTeX aceitos pelo conversor de MathML
+
+var mathGreek = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "omicron": "ο", "pi": "π", "varpi": "ϖ",
+	"rho": "ρ", "varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ",
+	"phi": "ϕ", "varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+// mathIdentifiers são símbolos que se comportam como variáveis
+var mathIdentifiers = map[string]string{
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+	"hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "wp": "℘",
+	"top": "⊤", "bot": "⊥", "triangle": "△", "prime": "′",
+}
+
+var mathOperators = map[string]string{
+	// aritmética
+	"times": "×", "cdot": "⋅", "pm": "±", "mp": "∓", "div": "÷", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖", "otimes": "⊗", "odot": "⊙",
+	"setminus": "∖", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬",
+	"cup": "∪", "cap": "∩", "sqcup": "⊔", "sqcap": "⊓",
+	// relações
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "ll": "≪", "gg": "≫",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "mid": "∣", "parallel": "∥", "perp": "⊥", "models": "⊨", "vdash": "⊢",
+	"prec": "≺", "succ": "≻", "preceq": "⪯", "succeq": "⪰", "doteq": "≐",
+	// setas
+	"to": "→", "rightarrow": "→", "gets": "←", "leftarrow": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "iff": "⟺", "implies": "⟹",
+	"mapsto": "↦", "longrightarrow": "⟶", "longleftarrow": "⟵", "uparrow": "↑", "downarrow": "↓",
+	"hookrightarrow": "↪", "rightleftharpoons": "⇌",
+	// lógica e diversos
+	"forall": "∀", "exists": "∃", "nexists": "∄", "therefore": "∴", "because": "∵",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "angle": "∠",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"vert": "|", "Vert": "‖", "colon": ":", "degree": "°",
+	// símbolos escapados
+	"{": "{", "}": "}", "|": "‖", "#": "#", "%": "%", "&": "&", "_": "_", "$": "$",
+}
+
+var mathBigOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+// mathFunctions indica se os índices da função vão embaixo em destaque (\lim)
+var mathFunctions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false, "tanh": false,
+	"log": false, "ln": false, "lg": false, "exp": false, "dim": false, "ker": false,
+	"deg": false, "hom": false, "arg": false,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "gcd": true, "Pr": true,
+}
+
+var mathSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", " ": "0.2778em",
+	"!": "-0.1667em", "quad": "1em", "qquad": "2em",
+}
+
+var mathFonts = map[string]string{
+	"mathbf": "bold", "mathit": "italic", "mathrm": "normal", "mathbb": "double-struck",
+	"mathcal": "script", "mathscr": "script", "mathfrak": "fraktur", "mathsf": "sans-serif",
+	"mathtt": "monospace", "boldsymbol": "bold-italic", "bm": "bold-italic",
+}
+
+type mathAccent struct {
+	symbol   string
+	under    bool
+	stretchy bool
+}
+
+var mathAccents = map[string]mathAccent{
+	"hat": {symbol: "^"}, "widehat": {symbol: "^", stretchy: true},
+	"tilde": {symbol: "~"}, "widetilde": {symbol: "~", stretchy: true},
+	"bar": {symbol: "¯"}, "overline": {symbol: "‾", stretchy: true},
+	"vec": {symbol: "→"}, "overrightarrow": {symbol: "→", stretchy: true},
+	"dot": {symbol: "˙"}, "ddot": {symbol: "¨"},
+	"overbrace": {symbol: "⏞", stretchy: true},
+	"underline": {symbol: "_", under: true}, "underbrace": {symbol: "⏟", under: true},
+}
+
+var mathDelimiters = map[string]string{
+	"{": "{", "}": "}", "|": "‖", "langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|",
+	"lVert": "‖", "rVert": "‖", "backslash": "∖",
+}
+
+var mathDelimiterSizes = map[string]string{
+	"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em",
+	"Big": "1.8em", "Bigl": "1.8em", "Bigr": "1.8em",
+	"bigg": "2.4em", "biggl": "2.4em", "biggr": "2.4em",
+	"Bigg": "3em", "Biggl": "3em", "Biggr": "3em",
+}
+
+type mathEnvironment struct {
+	open, close  string
+	align        string
+	displaystyle bool
+}
+
+var mathEnvironments = map[string]mathEnvironment{
+	"matrix":   {},
+	"array":    {},
+	"pmatrix":  {open: "(", close: ")"},
+	"bmatrix":  {open: "[", close: "]"},
+	"Bmatrix":  {open: "{", close: "}"},
+	"vmatrix":  {open: "|", close: "|"},
+	"Vmatrix":  {open: "‖", close: "‖"},
+	"cases":    {open: "{", align: "left left"},
+	"aligned":  {align: "right left", displaystyle: true},
+	"align":    {align: "right left", displaystyle: true},
+	"align*":   {align: "right left", displaystyle: true},
+	"split":    {align: "right left", displaystyle: true},
+	"gathered": {displaystyle: true},
+}
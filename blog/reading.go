@@ -0,0 +1,59 @@
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/analytics"
+	"harmonista/models"
+)
+
+// maxBeaconBytes limita o corpo aceito do beacon de leitura
+const maxBeaconBytes = 1024
+
+// readBeacon é o payload enviado por public/js/leitura.js
+type readBeacon struct {
+	Post    int `json:"post"`
+	Depth   int `json:"depth"`   // % do post lido: 0, 25, 50, 75 ou 100
+	Seconds int `json:"seconds"` // tempo com a página visível
+}
+
+// readingBeacon recebe o beacon de leitura. sendBeacon não lê a resposta,
+// mas os códigos de erro ajudam a depurar.
+func (b *BlogModule) readingBeacon(c *gin.Context) {
+	if b.analytics == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// sendBeacon manda text/plain para evitar preflight; o corpo é JSON
+	var payload readBeacon
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBeaconBytes)
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+	if payload.Post <= 0 || !analytics.ValidReadDepth(payload.Depth) || payload.Seconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	blog, err := b.getBlogBySubdomain(c.Param("subdomain"))
+	if err != nil || !blog.ReadingStats {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blog não encontrado"})
+		return
+	}
+
+	var post models.Post
+	if err := b.db.Select("id").
+		Where("id = ? AND blog_id = ? AND draft = ?", payload.Post, blog.ID, false).
+		First(&post).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post não encontrado"})
+		return
+	}
+
+	b.analytics.TrackRead(c, blog.ID, int(post.ID), payload.Depth, payload.Seconds)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/models"
+)
+
+// redirectOldSlug responde 301 para o endereço atual quando slug é um slug
+// antigo de um post ou página publicada do blog
+func (b *BlogModule) redirectOldSlug(c *gin.Context, blog *models.Blog, kind, slug string) bool {
+	var redirect models.SlugRedirect
+	if err := b.db.Where("blog_id = ? AND kind = ? AND slug = ?", blog.ID, kind, slug).
+		First(&redirect).Error; err != nil {
+		return false
+	}
+
+	table, prefix := "posts", "/"
+	if kind == models.SlugKindPage {
+		table, prefix = "pages", "/p/"
+	}
+	var current []string
+	b.db.Table(table).
+		Where("id = ? AND blog_id = ? AND draft = ? AND deleted_at IS NULL", redirect.TargetID, blog.ID, false).
+		Pluck("slug", &current)
+	if len(current) == 0 {
+		return false
+	}
+
+	target := buildBlogURL(c, blog, prefix+current[0])
+	if c.Request.URL.RawQuery != "" {
+		target += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusMovedPermanently, target)
+	return true
+}
@@ -0,0 +1,86 @@
+package blog
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/analytics"
+	"harmonista/models"
+)
+
+// publicStatsDays é o período mostrado na página pública de estatísticas
+const publicStatsDays = 30
+
+type publicDay struct {
+	Date       string
+	Count      int64
+	Percentage float64
+}
+
+type publicPost struct {
+	Title string
+	URL   string
+	Count int64
+}
+
+// stats mostra as visitas do blog para qualquer pessoa, se o autor ativou
+// a opção. Só números agregados: visitas por dia e posts mais lidos.
+func (b *BlogModule) stats(c *gin.Context) {
+	blog, err := b.getBlogBySubdomain(c.Param("subdomain"))
+	if err != nil || !blog.PublicStats || b.analytics == nil {
+		c.HTML(http.StatusNotFound, "blog_error.html", gin.H{
+			"error": "Página não encontrada",
+		})
+		return
+	}
+
+	period := analytics.LastDays(publicStatsDays, time.Now())
+	visitsByDay := b.analytics.GetVisitSeries(blog.ID, period, analytics.BucketDay)
+	var total int64
+	maxCount := int64(1)
+	for _, day := range visitsByDay {
+		total += day.Count
+		if day.Count > maxCount {
+			maxCount = day.Count
+		}
+	}
+	days := make([]publicDay, len(visitsByDay))
+	for i, day := range visitsByDay {
+		days[i] = publicDay{
+			Date:       day.Date,
+			Count:      day.Count,
+			Percentage: float64(day.Count) / float64(maxCount) * 100,
+		}
+	}
+
+	// Posts mais visitados; rascunhos e posts apagados não aparecem
+	var topPosts []publicPost
+	for _, item := range b.analytics.GetTopPosts(blog.ID, period, 10) {
+		var post models.Post
+		if err := b.db.Select("title, slug").
+			Where("id = ? AND blog_id = ? AND draft = ?", item.PostID, blog.ID, false).
+			First(&post).Error; err != nil {
+			continue
+		}
+		topPosts = append(topPosts, publicPost{
+			Title: post.Title,
+			URL:   buildBlogURL(c, blog, "/"+post.Slug),
+			Count: item.Count,
+		})
+	}
+
+	c.HTML(http.StatusOK, "blog_stats.html", gin.H{
+		"blog":         blog,
+		"page":         gin.H{"Title": "Estatísticas", "Content": ""},
+		"pageURL":      buildBlogURL(c, blog, "/stats"),
+		"navLinks":     parseNavLinks(blog.Nav),
+		"blogThemeCSS": template.CSS(blog.Theme),
+		"days":         days,
+		"total":        total,
+		"statsDays":    publicStatsDays,
+		"topPosts":     topPosts,
+	})
+}
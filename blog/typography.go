@@ -0,0 +1,210 @@
+package blog
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// nbsp é o espaço não separável, que impede a quebra de linha
+const nbsp = " "
+
+// portugueseTypographer aplica a tipografia do português do Brasil:
+//
+//   - aspas curvas “ ” e, dentro delas, ‘ ’; << >> viram « »; o apóstrofo
+//     ("d'água") vira ’ e "..." vira reticências (…)
+//   - "--" entre espaços ou abrindo o parágrafo é travessão (—), o do
+//     diálogo e das intercalações; entre palavras ou números ("10--20") é
+//     meia-risca (–), a dos intervalos. "---" é sempre travessão, e um hífen
+//     solto entre espaços também vira travessão
+//   - o travessão que abre um diálogo fica preso à primeira palavra
+//   - ordinais: 1o, 2a e 3os viram 1º, 2ª e 3ºs
+//   - espaço não separável em "R$ 10" e depois de Sr., Sra., Srta., Dr.,
+//     Dra., Prof., Profa. e nº
+var portugueseTypographer = &portugueseTypography{}
+
+// O "--" fica de fora do typographer do goldmark, que não olha os espaços
+// em volta; quem decide entre travessão e meia-risca é o Transform
+var typographer = extension.NewTypographer(
+	extension.WithTypographicSubstitutions(map[extension.TypographicPunctuation][]byte{
+		extension.LeftDoubleQuote:  []byte("“"),
+		extension.RightDoubleQuote: []byte("”"),
+		extension.LeftSingleQuote:  []byte("‘"),
+		extension.RightSingleQuote: []byte("’"),
+		extension.Apostrophe:       []byte("’"),
+		extension.LeftAngleQuote:   []byte("«"),
+		extension.RightAngleQuote:  []byte("»"),
+		extension.EnDash:           nil,
+		extension.EmDash:           []byte("—"),
+		extension.Ellipsis:         []byte("…"),
+	}),
+)
+
+var (
+	ordinalPattern      = regexp.MustCompile(`\b(\d+)([oa])(s?)\b`)
+	currencyPattern     = regexp.MustCompile(`R\$ (\d)`)
+	abbreviationPattern = regexp.MustCompile(`\b(Sr|Sra|Srta|Dr|Dra|Prof|Profa)\. `)
+	numeroPattern       = regexp.MustCompile(`(nº|n\.º) `)
+)
+
+type portugueseTypography struct{}
+
+func (e *portugueseTypography) Extend(m goldmark.Markdown) {
+	typographer.Extend(m)
+	// Antes de headings, para que o sumário já mostre o texto final
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 200),
+	))
+}
+
+func (e *portugueseTypography) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	// O typographer do goldmark parte o texto em cada "-" e em cada aspa;
+	// os trechos seguidos da mesma linha são tratados juntos
+	var runs [][]*ast.Text
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.CodeSpan, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		var run []*ast.Text
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			t, ok := c.(*ast.Text)
+			if ok && !t.IsRaw() {
+				run = append(run, t)
+				if !t.SoftLineBreak() && !t.HardLineBreak() {
+					continue
+				}
+			}
+			if len(run) > 0 {
+				runs = append(runs, run)
+				run = nil
+			}
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, run := range runs {
+		var value strings.Builder
+		for _, t := range run {
+			value.Write(t.Segment.Value(source))
+		}
+		first, last := run[0], run[len(run)-1]
+		replaced := typesetPortuguese(value.String(), startsBlock(first), endsBlock(last))
+		if replaced == value.String() {
+			continue
+		}
+		// Os nós de texto ficam, vazios, para manter a quebra de linha
+		first.Parent().InsertBefore(first.Parent(), first, ast.NewString([]byte(replaced)))
+		for _, t := range run {
+			t.Segment = text.NewSegment(t.Segment.Stop, t.Segment.Stop)
+		}
+	}
+}
+
+// startsBlock indica se o texto abre uma linha do bloco
+func startsBlock(t *ast.Text) bool {
+	prev := t.PreviousSibling()
+	if prev == nil {
+		_, inline := t.Parent().(*ast.Paragraph)
+		_, tight := t.Parent().(*ast.TextBlock)
+		_, heading := t.Parent().(*ast.Heading)
+		return inline || tight || heading
+	}
+	if pt, ok := prev.(*ast.Text); ok {
+		return pt.SoftLineBreak() || pt.HardLineBreak()
+	}
+	return false
+}
+
+// endsBlock indica se o texto fecha uma linha do bloco
+func endsBlock(t *ast.Text) bool {
+	return t.NextSibling() == nil || t.SoftLineBreak() || t.HardLineBreak()
+}
+
+// typesetPortuguese aplica as regras de portugueseTypographer a um trecho
+// de texto. atStart e atEnd dizem se o trecho abre e fecha a linha; nas
+// bordas de outros nós (ênfase, links) o "--" é tratado como colado.
+func typesetPortuguese(value string, atStart, atEnd bool) string {
+	if strings.Contains(value, "-") {
+		value = typesetDashes(value, atStart, atEnd)
+	}
+	if atStart && strings.HasPrefix(value, "— ") {
+		value = "—" + nbsp + value[len("— "):]
+	}
+
+	value = ordinalPattern.ReplaceAllStringFunc(value, func(match string) string {
+		parts := ordinalPattern.FindStringSubmatch(match)
+		indicator := "º"
+		if parts[2] == "a" {
+			indicator = "ª"
+		}
+		return parts[1] + indicator + parts[3]
+	})
+	value = currencyPattern.ReplaceAllString(value, "R$$"+nbsp+"$1")
+	value = abbreviationPattern.ReplaceAllString(value, "$1."+nbsp)
+	value = numeroPattern.ReplaceAllString(value, "$1"+nbsp)
+	return value
+}
+
+func typesetDashes(value string, atStart, atEnd bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '-' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		double := i+1 < len(value) && value[i+1] == '-'
+		width := 1
+		if double {
+			width = 2
+		}
+		spaceBefore := spaceOrEdge(value[:i], true, atStart)
+		spaceAfter := spaceOrEdge(value[i+width:], false, atEnd)
+
+		switch {
+		case double && spaceBefore && spaceAfter:
+			b.WriteString("—")
+		case double:
+			b.WriteString("–")
+		case spaceBefore && spaceAfter && i > 0 && i+1 < len(value):
+			// Hífen solto no meio da frase
+			b.WriteString("—")
+		default:
+			b.WriteByte('-')
+		}
+		i += width - 1
+	}
+	return b.String()
+}
+
+// spaceOrEdge indica se s termina (before) ou começa com espaço, ou se está
+// vazio e a borda é o início ou o fim da linha
+func spaceOrEdge(s string, before, edge bool) bool {
+	if s == "" {
+		return edge
+	}
+	var r rune
+	if before {
+		r, _ = utf8.DecodeLastRuneInString(s)
+	} else {
+		r, _ = utf8.DecodeRuneInString(s)
+	}
+	return unicode.IsSpace(r)
+}
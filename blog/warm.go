@@ -0,0 +1,109 @@
+package blog
+
+import (
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"harmonista/analytics"
+	"harmonista/cache"
+	"harmonista/models"
+)
+
+const (
+	// warmInterval é de quanto em quanto tempo o aquecedor roda de novo;
+	// páginas que ainda estão no cache não são refeitas
+	warmInterval = time.Hour
+	// warmPosts é quantos posts, somando todos os blogs, são aquecidos
+	warmPosts = 100
+	// warmDays é a janela de visitas usada para escolher os posts
+	warmDays = 7
+)
+
+// topPostURLs devolve os endereços dos posts publicados mais visitados
+// nos últimos warmDays dias, do mais para o menos visitado
+func (b *BlogModule) topPostURLs(limit int) []string {
+	var blogs []models.Blog
+	if err := b.db.Select("id", "subdomain").Find(&blogs).Error; err != nil {
+		log.Printf("Error listing blogs to warm the cache: %v", err)
+		return nil
+	}
+
+	r := analytics.LastDays(warmDays, time.Now())
+	var top []analytics.PostVisits
+	for _, blog := range blogs {
+		top = append(top, b.analytics.GetTopPosts(blog.ID, r, limit)...)
+	}
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	if len(top) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(top))
+	for i, item := range top {
+		ids[i] = item.PostID
+	}
+	var posts []models.Post
+	b.db.Preload("Blog").Where("id IN ? AND draft = ?", ids, false).Find(&posts)
+	byID := make(map[int]models.Post, len(posts))
+	for _, post := range posts {
+		byID[int(post.ID)] = post
+	}
+
+	domain := os.Getenv("DOMAIN")
+	if domain == "" {
+		domain = "http://localhost"
+	}
+	var urls []string
+	for _, item := range top {
+		if post, ok := byID[item.PostID]; ok {
+			urls = append(urls, domain+"/@/"+post.Blog.Subdomain+"/"+post.Slug)
+		}
+	}
+	return urls
+}
+
+// WarmCache pré-renderiza os posts mais visitados que não estão no cache,
+// para que o primeiro leitor depois de um restart não espere por eles
+func (b *BlogModule) WarmCache() {
+	urls := b.topPostURLs(warmPosts)
+	if rendered := cache.Warm(urls...); rendered > 0 {
+		log.Printf("Cache warmer rendered %d of the %d most visited posts", rendered, len(urls))
+	}
+}
+
+// StartCacheWarmer roda WarmCache agora e depois a cada warmInterval, até
+// Close. O roteador precisa ter sido registrado com cache.SetRenderer.
+func (b *BlogModule) StartCacheWarmer() {
+	b.stopWarmer = make(chan struct{})
+	b.warmerDone = make(chan struct{})
+
+	go func() {
+		defer close(b.warmerDone)
+
+		ticker := time.NewTicker(warmInterval)
+		defer ticker.Stop()
+
+		for {
+			b.WarmCache()
+			select {
+			case <-b.stopWarmer:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close para o aquecedor do cache, esperando a rodada em andamento
+func (b *BlogModule) Close() {
+	if b.stopWarmer == nil {
+		return
+	}
+	close(b.stopWarmer)
+	<-b.warmerDone
+}
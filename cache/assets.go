@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAssetSize is the largest file kept in memory; bigger ones are served
+// straight from disk
+const maxAssetSize = 4 << 20
+
+// compressible lists the extensions worth precompressing; images and
+// fonts are compressed already
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".svg":  true,
+	".html": true,
+	".json": true,
+	".txt":  true,
+	".xml":  true,
+}
+
+// Assets serves the files under a directory the way CacheMiddleware serves
+// pages: with an ETag, precompressed variants and 304s. URL adds a
+// fingerprint (?v=<hash>) to a file's address, and requests carrying the
+// current fingerprint may be cached by browsers forever.
+type Assets struct {
+	prefix string
+	dir    string
+
+	mu    sync.Mutex
+	files map[string]*asset
+}
+
+// asset is a file loaded in memory, with the stat it was read with
+type asset struct {
+	modTime time.Time
+	size    int64
+	entry   *Entry
+}
+
+// NewAssets serves dir at the URL prefix (e.g. "/public", "./public")
+func NewAssets(prefix, dir string) *Assets {
+	return &Assets{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		dir:    dir,
+		files:  make(map[string]*asset),
+	}
+}
+
+// RegisterRoutes replaces router.Static for the prefix
+func (a *Assets) RegisterRoutes(router *gin.Engine) {
+	router.GET(a.prefix+"/*filepath", a.serve)
+	router.HEAD(a.prefix+"/*filepath", a.serve)
+}
+
+// URL returns the fingerprinted address of a file under the prefix, for
+// use in templates. Anything else is returned unchanged.
+func (a *Assets) URL(url string) string {
+	name, ok := strings.CutPrefix(url, a.prefix+"/")
+	if !ok || strings.Contains(name, "?") {
+		return url
+	}
+	file, err := a.load(name)
+	if err != nil || file.entry == nil {
+		return url
+	}
+	return url + "?v=" + file.entry.ETag[:8]
+}
+
+func (a *Assets) serve(c *gin.Context) {
+	name := c.Param("filepath")
+	file, err := a.load(name)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if file.entry == nil {
+		c.Header("Cache-Control", AssetPolicy)
+		c.File(a.path(name))
+		return
+	}
+
+	policy := AssetPolicy
+	if v := c.Query("v"); v != "" && v == file.entry.ETag[:8] {
+		policy = ImmutablePolicy
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	serveEntry(c, file.entry, contentType, policy)
+}
+
+// path maps a request path to the file, never leaving dir
+func (a *Assets) path(name string) string {
+	return filepath.Join(a.dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// load returns the file at name, reading it again when it changed on
+// disk. Files too big to keep in memory come back without an entry.
+func (a *Assets) load(name string) (*asset, error) {
+	name = path.Clean("/" + name)
+	info, err := os.Stat(a.path(name))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, os.ErrNotExist
+	}
+
+	a.mu.Lock()
+	file, ok := a.files[name]
+	a.mu.Unlock()
+	if ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return file, nil
+	}
+
+	file = &asset{modTime: info.ModTime(), size: info.Size()}
+	if info.Size() <= maxAssetSize {
+		body, err := os.ReadFile(a.path(name))
+		if err != nil {
+			return nil, err
+		}
+		file.entry = &Entry{Body: body, StoredAt: info.ModTime()}
+		if compressible[strings.ToLower(filepath.Ext(name))] {
+			precompress(file.entry)
+		} else {
+			file.entry.ETag = generateHash(string(body))
+		}
+	}
+
+	a.mu.Lock()
+	a.files[name] = file
+	a.mu.Unlock()
+	return file, nil
+}
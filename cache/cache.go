@@ -2,9 +2,6 @@ package cache
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -12,14 +9,6 @@ import (
 	"harmonista/models"
 )
 
-// GetCachePath returns the cache file path for a blog post
-func GetCachePath(subdomain, slug string) string {
-	hash := generateHash(subdomain + slug)
-	shortHash := hash[:16]
-	cacheDir := filepath.Join("cache", subdomain)
-	return filepath.Join(cacheDir, fmt.Sprintf("%s_%s.html", slug, shortHash))
-}
-
 // generateHash generates an xxHash hash for the given string
 func generateHash(s string) string {
 	hash := xxhash.Sum64String(s)
@@ -27,52 +16,11 @@ func generateHash(s string) string {
 	return fmt.Sprintf("%016x", hash)
 }
 
-// EnsureCacheDir ensures the cache directory exists
-func EnsureCacheDir(subdomain string) error {
-	cacheDir := filepath.Join("cache", subdomain)
-	return os.MkdirAll(cacheDir, 0755)
-}
-
-// WriteCache writes HTML content to cache file
-func WriteCache(subdomain, slug, html string) error {
-	if err := EnsureCacheDir(subdomain); err != nil {
-		return err
-	}
-
-	cachePath := GetCachePath(subdomain, slug)
-	return os.WriteFile(cachePath, []byte(html), 0644)
-}
-
-// ReadCache reads HTML content from cache file if it exists and is not expired
-func ReadCache(subdomain, slug string, maxAge time.Duration) (string, bool) {
-	cachePath := GetCachePath(subdomain, slug)
-
-	info, err := os.Stat(cachePath)
-	if err != nil {
-		return "", false
-	}
-
-	// Check if cache is expired
-	if time.Since(info.ModTime()) > maxAge {
-		return "", false
-	}
-
-	content, err := os.ReadFile(cachePath)
-	if err != nil {
-		return "", false
-	}
-
-	return string(content), true
-}
-
-// ClearCache removes a specific cache file
+// ClearCache removes every cached variant (host, Accept, preview) of a page
 func ClearCache(subdomain, slug string) error {
-	cachePath := GetCachePath(subdomain, slug)
-	err := os.Remove(cachePath)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	return nil
+	prefix := pageKey(subdomain, slug) + "?"
+	index.removePrefix(prefix)
+	return DefaultStore().DeletePrefix(prefix)
 }
 
 // ClearCacheByPostID removes cache for a post by its ID
@@ -90,62 +38,29 @@ func ClearCacheByPostID(db *gorm.DB, postID int) error {
 	return ClearCache(post.Blog.Subdomain, post.Slug)
 }
 
-// ClearCacheBySlugs removes cache files matching a glob pattern in subdomain directory
+// ClearCacheBySlugs removes the cached pages of the given slugs
 func ClearCacheBySlugs(subdomain string, slugs ...string) error {
-	cacheDir := filepath.Join("cache", subdomain)
-
 	for _, slug := range slugs {
-		// Remove exact match
 		if err := ClearCache(subdomain, slug); err != nil {
 			return err
 		}
-
-		// Also try to remove any files starting with this slug
-		// This handles cases where slug might have changed
-		pattern := filepath.Join(cacheDir, slug+"_*.html")
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			continue
-		}
-
-		for _, match := range matches {
-			os.Remove(match)
-		}
 	}
 
 	return nil
 }
 
-// ClearAllBlogCache removes all cache files for a blog
+// ClearAllBlogCache removes all cached pages of a blog
 func ClearAllBlogCache(subdomain string) error {
-	cacheDir := filepath.Join("cache", subdomain)
-	return os.RemoveAll(cacheDir)
+	prefix := pageKey(subdomain, "")
+	index.removePrefix(prefix)
+	return DefaultStore().DeletePrefix(prefix)
 }
 
-// ClearOldCache removes cache files older than the specified duration
+// ClearOldCache removes cached pages older than the specified duration,
+// on stores that support it (files; the memory tier is bounded by size)
 func ClearOldCache(maxAge time.Duration) error {
-	cacheRoot := "cache"
-
-	return filepath.Walk(cacheRoot, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		// Skip non-HTML files
-		if !strings.HasSuffix(path, ".html") {
-			return nil
-		}
-
-		// Remove if older than maxAge
-		if time.Since(info.ModTime()) > maxAge {
-			os.Remove(path)
-		}
-
-		return nil
-	})
+	if p, ok := DefaultStore().(pruner); ok {
+		return p.Prune(maxAge)
+	}
+	return nil
 }
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"harmonista/models"
+)
+
+// Dependencies are the entities a cached page was rendered from. Handlers
+// declare them with Depends; writes emit the same names through the
+// *Changed events, which purge exactly the pages that used them.
+func BlogDep(blogID int) string { return "blog:" + strconv.Itoa(blogID) }
+
+// PostsDep is the list of published posts of a blog (index and tag pages)
+func PostsDep(blogID int) string { return "posts:" + strconv.Itoa(blogID) }
+
+func PostDep(postID int) string { return "post:" + strconv.Itoa(postID) }
+
+// RepliesDep is the list of replies shown under a post
+func RepliesDep(postID int) string { return "replies:" + strconv.Itoa(postID) }
+
+func PageDep(pageID int) string { return "page:" + strconv.Itoa(pageID) }
+
+func TagDep(tagID int) string { return "tag:" + strconv.Itoa(tagID) }
+
+// ReaderDep is the /leia reader, which lists posts of every blog
+const ReaderDep = "reader"
+
+const (
+	depsContextKey  = "cache_deps"
+	visitContextKey = "cache_visit"
+)
+
+// Depends records what the page being rendered depends on. Only responses
+// that declared dependencies are stored, since nothing would purge the rest.
+func Depends(c *gin.Context, deps ...string) {
+	current, _ := c.Get(depsContextKey)
+	list, _ := current.([]string)
+	c.Set(depsContextKey, append(list, deps...))
+}
+
+// Visit is the analytics visit a cached page stands for
+type Visit struct {
+	BlogID int  `json:"blog"`
+	PostID *int `json:"post,omitempty"`
+}
+
+var (
+	hitMu   sync.RWMutex
+	hitFunc func(c *gin.Context, visit Visit)
+)
+
+// VisitOnHit marks the page as a visit to blogID/postID, so requests
+// served from the cache still reach the function registered with OnHit
+func VisitOnHit(c *gin.Context, blogID int, postID *int) {
+	c.Set(visitContextKey, &Visit{BlogID: blogID, PostID: postID})
+}
+
+// OnHit registers the function called for cache hits of pages marked with
+// VisitOnHit; the blog uses it to count visits the handler never saw
+func OnHit(fn func(c *gin.Context, visit Visit)) {
+	hitMu.Lock()
+	defer hitMu.Unlock()
+	hitFunc = fn
+}
+
+func callOnHit(c *gin.Context, visit *Visit) {
+	if visit == nil {
+		return
+	}
+	hitMu.RLock()
+	fn := hitFunc
+	hitMu.RUnlock()
+	if fn != nil {
+		fn(c, *visit)
+	}
+}
+
+// depIndex maps each dependency to the keys that used it. The sequence
+// numbers catch a page that started rendering before a write and would
+// otherwise be stored with the old data after the purge. Purges only
+// matter to renders in flight, so invalidated keeps just the ones after
+// the oldest of them.
+type depIndex struct {
+	mu          sync.Mutex
+	keys        map[string]map[string]struct{} // dependency -> keys
+	deps        map[string][]string            // key -> dependencies
+	seq         uint64
+	invalidated map[string]uint64 // dependency -> seq of its last purge
+	rendering   map[uint64]int    // start seq -> renders in flight
+}
+
+func newDepIndex() *depIndex {
+	return &depIndex{
+		keys:        make(map[string]map[string]struct{}),
+		deps:        make(map[string][]string),
+		invalidated: make(map[string]uint64),
+		rendering:   make(map[uint64]int),
+	}
+}
+
+var index = newDepIndex()
+
+// begin returns the current purge sequence, taken before rendering. Every
+// call must be paired with end once the page is stored or dropped.
+func (d *depIndex) begin() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rendering[d.seq]++
+	return d.seq
+}
+
+// end marks the render started at since as done and forgets the purges no
+// render in flight can be affected by
+func (d *depIndex) end(since uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rendering[since]--; d.rendering[since] <= 0 {
+		delete(d.rendering, since)
+	}
+	if len(d.rendering) == 0 {
+		clear(d.invalidated)
+		return
+	}
+	oldest := d.seq
+	for start := range d.rendering {
+		oldest = min(oldest, start)
+	}
+	for dep, seq := range d.invalidated {
+		if seq <= oldest {
+			delete(d.invalidated, dep)
+		}
+	}
+}
+
+// addIfFresh indexes key unless one of deps was purged after sequence
+// since, in which case the stored entry is already stale
+func (d *depIndex) addIfFresh(key string, deps []string, since uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, dep := range deps {
+		if d.invalidated[dep] > since {
+			return false
+		}
+	}
+	d.addLocked(key, deps)
+	return true
+}
+
+func (d *depIndex) add(key string, deps []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addLocked(key, deps)
+}
+
+func (d *depIndex) addLocked(key string, deps []string) {
+	d.removeLocked(key)
+	d.deps[key] = deps
+	for _, dep := range deps {
+		if d.keys[dep] == nil {
+			d.keys[dep] = make(map[string]struct{})
+		}
+		d.keys[dep][key] = struct{}{}
+	}
+}
+
+func (d *depIndex) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removeLocked(key)
+}
+
+func (d *depIndex) removePrefix(prefix string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.deps {
+		if strings.HasPrefix(key, prefix) {
+			d.removeLocked(key)
+		}
+	}
+}
+
+func (d *depIndex) removeLocked(key string) {
+	for _, dep := range d.deps[key] {
+		delete(d.keys[dep], key)
+		if len(d.keys[dep]) == 0 {
+			delete(d.keys, dep)
+		}
+	}
+	delete(d.deps, key)
+}
+
+// take removes and returns the keys that depend on any of deps
+func (d *depIndex) take(deps []string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	var keys []string
+	for _, dep := range deps {
+		if len(d.rendering) > 0 {
+			d.invalidated[dep] = d.seq
+		}
+		for key := range d.keys[dep] {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		d.removeLocked(key)
+	}
+	return keys
+}
+
+// reset forgets every key, keeping the purge sequence
+func (d *depIndex) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = make(map[string]map[string]struct{})
+	d.deps = make(map[string][]string)
+}
+
+// lister is implemented by stores that keep entries across restarts, so
+// the index can be rebuilt from them
+type lister interface {
+	Each(fn func(key string, deps []string))
+}
+
+// rebuildIndex fills the index with the entries already in the store
+func rebuildIndex(s Store) {
+	index.reset()
+	if l, ok := s.(lister); ok {
+		l.Each(index.add)
+	}
+}
+
+// Invalidate purges every cached page that depends on any of deps
+func Invalidate(deps ...string) {
+	store := DefaultStore()
+	for _, key := range index.take(deps) {
+		if err := store.Delete(key); err != nil {
+			log.Printf("Error purging cache entry %s: %v", key, err)
+		}
+	}
+}
+
+// BlogChanged is emitted when the blog itself changes (title, theme, menu,
+// settings): every page of the blog and the reader are purged
+func BlogChanged(blogID int) {
+	Invalidate(BlogDep(blogID), ReaderDep)
+}
+
+// PostChanged is emitted when a post is created, edited, published or
+// deleted. It purges the post, the blog's post lists, the reader and the
+// reply list of the post it answers.
+func PostChanged(post *models.Post) {
+	deps := []string{PostDep(int(post.ID)), PostsDep(post.BlogID), ReaderDep}
+	if post.ReplyPostID != nil {
+		deps = append(deps, RepliesDep(*post.ReplyPostID))
+	}
+	Invalidate(deps...)
+}
+
+// TagChanged is emitted when a tag is renamed, described, merged or
+// deleted: the pages that show it and the reader are purged
+func TagChanged(tag *models.Tag) {
+	Invalidate(TagDep(int(tag.ID)), ReaderDep)
+}
+
+// PageChanged is emitted when a static page is created, edited or deleted
+func PageChanged(page *models.Page) {
+	Invalidate(PageDep(int(page.ID)))
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// useStore troca o store padrão durante o teste
+func useStore(t *testing.T, s Store) {
+	previous := DefaultStore()
+	SetStore(s)
+	t.Cleanup(func() { SetStore(previous) })
+}
+
+func TestCacheMiddleware_InvalidatesByDependency(t *testing.T) {
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	renders := map[string]int{}
+	var hits []Visit
+	OnHit(func(c *gin.Context, visit Visit) { hits = append(hits, visit) })
+	t.Cleanup(func() { OnHit(nil) })
+
+	postID := 7
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/", func(c *gin.Context) {
+		renders["index"]++
+		Depends(c, BlogDep(1), PostsDep(1))
+		VisitOnHit(c, 1, nil)
+		c.Data(200, "text/html; charset=utf-8", []byte("índice"))
+	})
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		renders[c.Param("slug")]++
+		if c.Param("slug") == "sem-deps" {
+			c.Data(200, "text/html; charset=utf-8", []byte("x"))
+			return
+		}
+		Depends(c, BlogDep(1), PostDep(postID))
+		VisitOnHit(c, 1, &postID)
+		c.Data(200, "text/html; charset=utf-8", []byte("post"))
+	})
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "https://harmonista.org"+path, nil))
+		return w.Header().Get("X-Cache")
+	}
+
+	assert.Equal(t, "MISS", get("/@/blog/"))
+	assert.Equal(t, "MISS", get("/@/blog/post"))
+	assert.Equal(t, "HIT", get("/@/blog/"))
+	assert.Equal(t, "HIT", get("/@/blog/post"))
+	assert.Equal(t, []Visit{{BlogID: 1}, {BlogID: 1, PostID: &postID}}, hits)
+
+	// Sem dependências declaradas a página não é guardada
+	get("/@/blog/sem-deps")
+	assert.Equal(t, "MISS", get("/@/blog/sem-deps"))
+
+	// CSS fora dos temas nunca usa o cache
+	assert.Equal(t, "", get("/@/blog/post?css=/x.css"))
+
+	// Um post novo muda só as listas do blog
+	Invalidate(PostsDep(1))
+	assert.Equal(t, "MISS", get("/@/blog/"))
+	assert.Equal(t, "HIT", get("/@/blog/post"))
+
+	// Mudanças no blog afetam todas as páginas
+	Invalidate(BlogDep(1))
+	assert.Equal(t, "MISS", get("/@/blog/"))
+	assert.Equal(t, "MISS", get("/@/blog/post"))
+	assert.Equal(t, 3, renders["index"])
+	assert.Equal(t, 3, renders["post"]) // inclui a prévia
+}
+
+func TestCacheMiddleware_SkipsPagesChangedWhileRendering(t *testing.T) {
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		Depends(c, PostDep(1))
+		// O post é salvo enquanto a página antiga ainda está sendo montada
+		Invalidate(PostDep(1))
+		c.Data(200, "text/html; charset=utf-8", []byte("velho"))
+	})
+
+	req := httptest.NewRequest("GET", "https://harmonista.org/@/blog/post", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	key, _ := NewKeyBuilder("https://harmonista.org").Key(req)
+	_, found := DefaultStore().Get(key)
+	assert.False(t, found)
+}
+
+func TestKeyFromPath(t *testing.T) {
+	assert.Equal(t, "blog/", keyFromPath("/@/blog/"))
+	assert.Equal(t, "blog/meu-post", keyFromPath("/@/blog/meu-post"))
+	assert.Equal(t, "blog/t/go", keyFromPath("/@/blog/t/go"))
+	assert.Equal(t, "_site/leia", keyFromPath("/leia"))
+	assert.Equal(t, "_site/leia/go", keyFromPath("/leia/go"))
+	assert.Equal(t, "", keyFromPath("/admin/blog/posts"))
+	assert.Equal(t, "", keyFromPath("/"))
+}
+
+func TestFileStore_RebuildsIndex(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStore(dir)
+	postID := 3
+	s.Set("blog/post", &Entry{Body: []byte("<p>post</p>"), StoredAt: time.Now(), Deps: []string{PostDep(3)}, Visit: &Visit{BlogID: 1, PostID: &postID}})
+
+	got, ok := s.Get("blog/post")
+	assert.True(t, ok)
+	assert.Equal(t, "<p>post</p>", string(got.Body))
+	assert.Equal(t, []string{PostDep(3)}, got.Deps)
+	assert.Equal(t, 3, *got.Visit.PostID)
+
+	// Arquivo de uma versão sem dependências: não tem como ser invalidado
+	legacy := filepath.Join(dir, "blog", "antigo_0000000000000000.html")
+	os.WriteFile(legacy, []byte("<p>antigo</p>"), 0644)
+
+	useStore(t, s)
+	_, err := os.Stat(legacy)
+	assert.True(t, os.IsNotExist(err))
+
+	// Depois de um restart o índice vem dos arquivos
+	Invalidate(PostDep(3))
+	_, ok = s.Get("blog/post")
+	assert.False(t, ok)
+}
+
+func TestDepIndex_ForgetsPurgesNoRenderNeeds(t *testing.T) {
+	d := newDepIndex()
+	d.take([]string{PostDep(1)})
+
+	first := d.begin()
+	d.take([]string{PostDep(2)})
+	second := d.begin()
+	d.take([]string{PostDep(3)})
+	assert.Len(t, d.invalidated, 2, "a primeira render ainda em curso precisa das posteriores ao início dela")
+
+	d.end(first)
+	assert.Len(t, d.invalidated, 1)
+	assert.False(t, d.addIfFresh("a", []string{PostDep(3)}, second), "a segunda render continua vendo a limpeza")
+
+	d.end(second)
+	assert.Empty(t, d.invalidated)
+	assert.Empty(t, d.rendering)
+}
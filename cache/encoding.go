@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Cache-Control policies per route type
+const (
+	// PagePolicy is for blog and reader pages: they change whenever the
+	// author saves, so browsers revalidate every time, which the ETag
+	// turns into a bodyless 304
+	PagePolicy = "public, no-cache"
+	// PreviewPolicy is for theme previews, which only the author looks at
+	PreviewPolicy = "private, no-cache"
+	// PrivatePolicy is for the admin, the backoffice and the login pages
+	PrivatePolicy = "private, no-store"
+	// AssetPolicy is for /public files requested without a fingerprint
+	AssetPolicy = "public, max-age=3600"
+	// ImmutablePolicy is for /public files requested with their current
+	// fingerprint; a new version gets a new URL
+	ImmutablePolicy = "public, max-age=31536000, immutable"
+)
+
+// minCompressSize is the smallest body worth compressing
+const minCompressSize = 1024
+
+// precompress fills in the ETag and the gzip and brotli variants of
+// entry, so they are computed once per write instead of per request.
+// Variants that don't come out smaller are left empty.
+func precompress(entry *Entry) {
+	entry.ETag = generateHash(string(entry.Body))
+	entry.Gzip, entry.Brotli = nil, nil
+	if len(entry.Body) < minCompressSize {
+		return
+	}
+
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := gz.Write(entry.Body); err == nil && gz.Close() == nil && buf.Len() < len(entry.Body) {
+		entry.Gzip = bytes.Clone(buf.Bytes())
+	}
+
+	buf.Reset()
+	br := brotli.NewWriterLevel(&buf, 9)
+	if _, err := br.Write(entry.Body); err == nil && br.Close() == nil && buf.Len() < len(entry.Body) {
+		entry.Brotli = bytes.Clone(buf.Bytes())
+	}
+}
+
+// etag quotes the entry's hash; each encoding is a different
+// representation, so it gets its own tag
+func etag(hash, encoding string) string {
+	if encoding == "" {
+		return `"` + hash + `"`
+	}
+	return `"` + hash + "-" + encoding + `"`
+}
+
+// negotiateEncoding picks the variant of entry to send for an
+// Accept-Encoding header: brotli, then gzip, at the highest q allowed.
+// "" means the uncompressed body.
+func negotiateEncoding(header string, entry *Entry) string {
+	available := map[string]bool{"br": len(entry.Brotli) > 0, "gzip": len(entry.Gzip) > 0}
+	accepted := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else if name != "" {
+			accepted[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"br", "gzip"} {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if available[encoding] && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// notModified reports whether the client's copy, described by the
+// conditional headers of r, is still current. If-None-Match wins over
+// If-Modified-Since when both are sent.
+func notModified(r *http.Request, hash string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" {
+				return true
+			}
+			for _, encoding := range []string{"", "br", "gzip"} {
+				if tag == etag(hash, encoding) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// serveEntry writes entry with its validators, answering conditional
+// requests with 304 and sending the compressed variant the client accepts
+func serveEntry(c *gin.Context, entry *Entry, contentType, policy string) {
+	hash := entry.ETag
+	if hash == "" {
+		// Written before entries carried a hash
+		hash = generateHash(string(entry.Body))
+	}
+
+	header := c.Writer.Header()
+	header.Set("Cache-Control", policy)
+	header.Set("Last-Modified", entry.StoredAt.UTC().Format(http.TimeFormat))
+	header.Add("Vary", "Accept-Encoding")
+
+	encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), entry)
+	header.Set("ETag", etag(hash, encoding))
+	if notModified(c.Request, hash, entry.StoredAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body := entry.Body
+	switch encoding {
+	case "br":
+		body = entry.Brotli
+	case "gzip":
+		body = entry.Gzip
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	c.Data(http.StatusOK, contentType, body)
+}
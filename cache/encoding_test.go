@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// page é grande o bastante para valer a compressão
+var page = "<html>" + strings.Repeat("<p>Olá, mundo!</p>", 200) + "</html>"
+
+func pageRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ControlMiddleware())
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		Depends(c, PostDep(1))
+		c.Data(200, htmlContentType, []byte(page))
+	})
+	router.GET("/admin/:subdomain", func(c *gin.Context) {
+		c.Data(200, htmlContentType, []byte("admin"))
+	})
+	return router
+}
+
+func do(router http.Handler, url string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheMiddleware_ConditionalRequests(t *testing.T) {
+	router := pageRouter(t)
+	url := "https://harmonista.org/@/blog/post"
+
+	// A primeira resposta já sai com os validadores
+	first := do(router, url)
+	assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(t, page, first.Body.String())
+	tag := first.Header().Get("ETag")
+	assert.NotEmpty(t, tag)
+	assert.NotEmpty(t, first.Header().Get("Last-Modified"))
+	assert.Equal(t, PagePolicy, first.Header().Get("Cache-Control"))
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, first.Header().Values("Vary"))
+
+	w := do(router, url, "If-None-Match", tag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, tag, w.Header().Get("ETag"))
+
+	// Tag fraca, em lista, e a tag de uma variante comprimida
+	gz := do(router, url, "Accept-Encoding", "gzip")
+	for _, match := range []string{"W/" + tag, `"outra", ` + tag, gz.Header().Get("ETag")} {
+		assert.Equal(t, http.StatusNotModified, do(router, url, "If-None-Match", match).Code, match)
+	}
+	assert.Equal(t, http.StatusOK, do(router, url, "If-None-Match", `"outra"`).Code)
+
+	// If-Modified-Since só vale sem If-None-Match
+	later := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	assert.Equal(t, http.StatusNotModified, do(router, url, "If-Modified-Since", later).Code)
+	assert.Equal(t, http.StatusOK, do(router, url, "If-Modified-Since", earlier).Code)
+	assert.Equal(t, http.StatusOK, do(router, url, "If-Modified-Since", later, "If-None-Match", `"outra"`).Code)
+
+	// A tag vem do conteúdo: uma página refeita igual continua valendo
+	Invalidate(PostDep(1))
+	w = do(router, url, "If-None-Match", tag)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestCacheMiddleware_Compression(t *testing.T) {
+	router := pageRouter(t)
+	url := "https://harmonista.org/@/blog/post"
+	do(router, url)
+
+	w := do(router, url, "Accept-Encoding", "gzip, deflate, br")
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	body, err := io.ReadAll(brotli.NewReader(w.Body))
+	assert.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	w = do(router, url, "Accept-Encoding", "gzip, br;q=0")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	reader, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(reader)
+	assert.Equal(t, page, string(body))
+
+	for _, accept := range []string{"", "identity", "deflate", "*;q=0"} {
+		w = do(router, url, "Accept-Encoding", accept)
+		assert.Empty(t, w.Header().Get("Content-Encoding"), accept)
+		assert.Equal(t, page, w.Body.String())
+	}
+	assert.Equal(t, "br", do(router, url, "Accept-Encoding", "*").Header().Get("Content-Encoding"))
+
+	// Páginas que não entram no cache saem como o handler escreveu
+	w = do(router, "https://harmonista.org/admin/blog", "Accept-Encoding", "gzip")
+	assert.Equal(t, "admin", w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, PrivatePolicy, w.Header().Get("Cache-Control"))
+
+	// Prévias de tema também são variantes, mas privadas
+	w = do(router, url+"?css=/public/css/temas/sepia.css")
+	assert.Equal(t, PreviewPolicy, w.Header().Get("Cache-Control"))
+}
+
+func TestFileStore_KeepsVariants(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	entry := &Entry{Body: []byte(page), StoredAt: time.Now(), Deps: []string{PostDep(1)}}
+	precompress(entry)
+	assert.NotEmpty(t, entry.Gzip)
+	assert.NotEmpty(t, entry.Brotli)
+	assert.NoError(t, s.Set("blog/post", entry))
+
+	got, ok := s.Get("blog/post")
+	assert.True(t, ok)
+	assert.Equal(t, entry.Body, got.Body)
+	assert.Equal(t, entry.Gzip, got.Gzip)
+	assert.Equal(t, entry.Brotli, got.Brotli)
+	assert.Equal(t, entry.ETag, got.ETag)
+
+	// Corpos pequenos não são comprimidos
+	small := &Entry{Body: []byte("<p>oi</p>")}
+	precompress(small)
+	assert.NotEmpty(t, small.ETag)
+	assert.Nil(t, small.Gzip)
+	assert.Nil(t, small.Brotli)
+}
+
+func TestAssets(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	css := "body { color: black; }\n" + strings.Repeat("p { margin: 0 auto; }\n", 100)
+	os.WriteFile(filepath.Join(dir, "css", "base.css"), []byte(css), 0644)
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte("\x89PNG"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	assets := NewAssets("/public", dir)
+	router := gin.New()
+	assets.RegisterRoutes(router)
+
+	url := assets.URL("/public/css/base.css")
+	assert.Regexp(t, `^/public/css/base\.css\?v=[0-9a-f]{8}$`, url)
+	assert.Equal(t, "/public/nao-existe.css", assets.URL("/public/nao-existe.css"))
+	assert.Equal(t, "https://exemplo.com/x.css", assets.URL("https://exemplo.com/x.css"))
+
+	w := do(router, "http://harmonista.org"+url, "Accept-Encoding", "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ImmutablePolicy, w.Header().Get("Cache-Control"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+
+	// Sem fingerprint, ou com um antigo, o cache do navegador é curto
+	w = do(router, "http://harmonista.org/public/css/base.css")
+	assert.Equal(t, AssetPolicy, w.Header().Get("Cache-Control"))
+	assert.Equal(t, css, w.Body.String())
+	assert.Equal(t, AssetPolicy, do(router, "http://harmonista.org/public/css/base.css?v=00000000").Header().Get("Cache-Control"))
+
+	tag := w.Header().Get("ETag")
+	assert.Equal(t, http.StatusNotModified, do(router, "http://harmonista.org/public/css/base.css", "If-None-Match", tag).Code)
+
+	// Imagens não são comprimidas
+	w = do(router, "http://harmonista.org/public/logo.png", "Accept-Encoding", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "\x89PNG", w.Body.String())
+
+	// Um arquivo alterado ganha outro fingerprint
+	os.WriteFile(filepath.Join(dir, "css", "base.css"), []byte(css+"a {}\n"), 0644)
+	os.Chtimes(filepath.Join(dir, "css", "base.css"), time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	assert.NotEqual(t, url, assets.URL("/public/css/base.css"))
+
+	assert.Equal(t, http.StatusNotFound, do(router, "http://harmonista.org/public/css").Code)
+	assert.Equal(t, http.StatusNotFound, do(router, "http://harmonista.org/public/../assets.go").Code)
+	assert.False(t, bytes.Contains(do(router, "http://harmonista.org/public/%2e%2e/encoding.go").Body.Bytes(), []byte("package")))
+}
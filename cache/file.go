@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileStore keeps each entry in its own file, under dir/<subdomain>/.
+// The modification time of the file is the entry's StoredAt; the key and
+// dependencies go in a comment on the first line, before the body, and
+// the compressed variants follow the body.
+type FileStore struct {
+	dir string
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewFileStore creates a store that writes pages under dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// path maps "subdomain/name" to dir/subdomain/name_<hash>.html. The name
+// is kept readable; the hash tells apart names that clean up the same way.
+func (s *FileStore) path(key string) (string, error) {
+	subdomain, name, _ := strings.Cut(key, "/")
+	subdomain = cleanFileName(subdomain)
+	if subdomain == "" {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	hash := generateHash(strings.Replace(key, "/", "", 1))[:16]
+	readable := readableName(name)
+	if readable == "" {
+		readable = "index"
+	}
+	return filepath.Join(s.dir, subdomain, fmt.Sprintf("%s_%s.html", readable, hash)), nil
+}
+
+// maxReadableName bounds the readable part of file names; keys carry the
+// host and query, and the hash already makes them unique
+const maxReadableName = 80
+
+func readableName(name string) string {
+	name = cleanFileName(name)
+	if len(name) > maxReadableName {
+		name = name[:maxReadableName]
+	}
+	return name
+}
+
+// cleanFileName keeps only characters that are safe in a file name and
+// have no meaning in a glob pattern; dots go too, so ".." can't escape dir
+func cleanFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
+
+// fileHeader is the metadata line written before the body
+type fileHeader struct {
+	Key   string   `json:"key"`
+	Deps  []string `json:"deps"`
+	Visit *Visit   `json:"visit,omitempty"`
+	ETag  string   `json:"etag,omitempty"`
+	// Lengths of the variants written after the body
+	Gzip   int `json:"gzip,omitempty"`
+	Brotli int `json:"br,omitempty"`
+}
+
+const (
+	headerStart = "<!--harmonista-cache "
+	headerEnd   = "-->\n"
+)
+
+// readHeader reads the metadata line; files written before dependencies
+// were tracked have none
+func readHeader(r *bufio.Reader) (*fileHeader, bool) {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, headerStart) || !strings.HasSuffix(line, headerEnd) {
+		return nil, false
+	}
+	var header fileHeader
+	if err := json.Unmarshal([]byte(line[len(headerStart):len(line)-len(headerEnd)]), &header); err != nil {
+		return nil, false
+	}
+	return &header, true
+}
+
+func (s *FileStore) Get(key string) (*Entry, bool) {
+	path, err := s.path(key)
+	if err != nil {
+		s.misses.Add(1)
+		return nil, false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.misses.Add(1)
+		return nil, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		s.misses.Add(1)
+		return nil, false
+	}
+	r := bufio.NewReader(f)
+	header, ok := readHeader(r)
+	if !ok || header.Key != key {
+		s.misses.Add(1)
+		return nil, false
+	}
+	data, err := io.ReadAll(r)
+	bodyLen := len(data) - header.Gzip - header.Brotli
+	if err != nil || header.Gzip < 0 || header.Brotli < 0 || bodyLen < 0 {
+		s.misses.Add(1)
+		return nil, false
+	}
+
+	s.hits.Add(1)
+	entry := &Entry{StoredAt: info.ModTime(), Deps: header.Deps, Visit: header.Visit, ETag: header.ETag}
+	entry.Body = data[:bodyLen:bodyLen]
+	if header.Gzip > 0 {
+		entry.Gzip = data[bodyLen : bodyLen+header.Gzip : bodyLen+header.Gzip]
+	}
+	if header.Brotli > 0 {
+		entry.Brotli = data[bodyLen+header.Gzip:]
+	}
+	return entry, true
+}
+
+// Set writes to a temporary file and renames it, so concurrent readers
+// never see a partial page
+func (s *FileStore) Set(key string, entry *Entry) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	header, err := json.Marshal(fileHeader{
+		Key:    key,
+		Deps:   entry.Deps,
+		Visit:  entry.Visit,
+		ETag:   entry.ETag,
+		Gzip:   len(entry.Gzip),
+		Brotli: len(entry.Brotli),
+	})
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(headerStart + string(header) + headerEnd); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, data := range [][]byte{entry.Body, entry.Gzip, entry.Brotli} {
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if !entry.StoredAt.IsZero() {
+		os.Chtimes(tmp.Name(), entry.StoredAt, entry.StoredAt)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DeletePrefix removes a whole blog directory for "subdomain/" and the
+// files whose name starts with the rest of the prefix otherwise
+func (s *FileStore) DeletePrefix(prefix string) error {
+	subdomain, name, found := strings.Cut(prefix, "/")
+	subdomain = cleanFileName(subdomain)
+
+	if !found {
+		dirs, _ := filepath.Glob(filepath.Join(s.dir, subdomain+"*"))
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if subdomain == "" {
+		return nil
+	}
+	if name == "" {
+		return os.RemoveAll(filepath.Join(s.dir, subdomain))
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(s.dir, subdomain, readableName(name)+"*.html"))
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Each reads the metadata of every entry. Files from before dependencies
+// were tracked can't be purged by Invalidate, so they are removed here.
+func (s *FileStore) Each(fn func(key string, deps []string)) {
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".html") {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		header, ok := readHeader(bufio.NewReader(f))
+		f.Close()
+		if !ok {
+			os.Remove(path)
+			return nil
+		}
+		fn(header.Key, header.Deps)
+		return nil
+	})
+}
+
+// Prune removes files older than maxAge
+func (s *FileStore) Prune(maxAge time.Duration) error {
+	return filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".html") {
+			return nil
+		}
+		if time.Since(info.ModTime()) > maxAge {
+			if os.Remove(path) == nil {
+				s.evictions.Add(1)
+			}
+		}
+		return nil
+	})
+}
+
+// Stats walks the cache directory to count the files, so it is meant for
+// the backoffice rather than hot paths
+func (s *FileStore) Stats() Stats {
+	stats := Stats{
+		Name:      "file",
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Evictions: s.evictions.Load(),
+	}
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".html") {
+			stats.Entries++
+			stats.Bytes += info.Size()
+		}
+		return nil
+	})
+	return stats
+}
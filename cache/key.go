@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ignoredParams never change the page; they are dropped from the key so
+// campaign links share the cached body (analytics still reads them)
+var ignoredParams = map[string]bool{
+	"utm_source":   true,
+	"utm_medium":   true,
+	"utm_campaign": true,
+	"utm_term":     true,
+	"utm_content":  true,
+	"fbclid":       true,
+	"gclid":        true,
+	"ref":          true,
+}
+
+// themePreviewPath matches the bundled themes the editor previews with
+// ?css=; any other stylesheet is a one-off and is not worth a cache entry
+var themePreviewPath = regexp.MustCompile(`^/public/css/temas/[A-Za-z0-9_-]+\.css$`)
+
+// varyParams are the query parameters that render a different page, with
+// the values that may be cached. Any parameter not listed here or in
+// ignoredParams makes the request bypass the cache.
+var varyParams = map[string]func(value string) bool{
+	"css": themePreviewPath.MatchString,
+}
+
+// acceptVariants maps the media types the pages may be negotiated into to
+// the variant that goes in the key
+var acceptVariants = map[string]string{
+	"text/html":             "html",
+	"application/xhtml+xml": "html",
+	"text/*":                "html",
+	"*/*":                   "html",
+	"application/json":      "json",
+	"application/rss+xml":   "feed",
+	"application/atom+xml":  "feed",
+}
+
+// KeyBuilder builds the cache key of a request from its path, normalized
+// host, allowed query parameters and Accept variant
+type KeyBuilder struct {
+	baseHost string
+}
+
+// NewKeyBuilder creates a builder for the site served at domain (the DOMAIN
+// setting, e.g. https://harmonista.org); other hosts are never cached
+func NewKeyBuilder(domain string) *KeyBuilder {
+	if domain == "" {
+		domain = "http://localhost"
+	}
+	host := domain
+	if u, err := url.Parse(domain); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return &KeyBuilder{baseHost: normalizeHost(host)}
+}
+
+// Key returns the key of r and whether it may be cached at all. The path
+// comes first ("subdomain/rest?..."), so a blog's pages share a prefix.
+func (k *KeyBuilder) Key(r *http.Request) (string, bool) {
+	path := keyFromPath(r.URL.Path)
+	if path == "" {
+		return "", false
+	}
+
+	host := normalizeHost(r.Host)
+	if host != k.baseHost && !strings.HasSuffix(host, "."+k.baseHost) {
+		return "", false
+	}
+
+	variant := acceptVariant(r.Header.Get("Accept"))
+	if variant == "" {
+		return "", false
+	}
+
+	vary := url.Values{}
+	for name, values := range r.URL.Query() {
+		if ignoredParams[name] || strings.HasPrefix(name, "utm_") {
+			continue
+		}
+		allowed, ok := varyParams[name]
+		if !ok || len(values) != 1 || !allowed(values[0]) {
+			return "", false
+		}
+		vary.Set(name, values[0])
+	}
+	vary.Set("host", host)
+	vary.Set("accept", variant)
+
+	// Encode sorts by name, so parameter order doesn't matter
+	return path + "?" + vary.Encode(), true
+}
+
+// normalizeHost lowercases the host and drops the port, a trailing dot and
+// www. (which is redirected anyway)
+func normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// acceptVariant returns the variant of the preferred known media type in
+// an Accept header, or "" when none is acceptable. A missing header means
+// anything goes, which is the HTML page.
+func acceptVariant(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return "html"
+	}
+
+	variant, best := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		v, ok := acceptVariants[strings.ToLower(strings.TrimSpace(mediaType))]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		// Ties go to the type listed first
+		if q > best {
+			variant, best = v, q
+		}
+	}
+	return variant
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const theme = "/public/css/temas/sepia.css"
+
+// keyOf monta a chave de uma requisição para https://harmonista.org
+func keyOf(t *testing.T, url string, header ...string) (string, bool) {
+	t.Helper()
+	req := httptest.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return NewKeyBuilder("https://harmonista.org").Key(req)
+}
+
+func TestKeyBuilder_Host(t *testing.T) {
+	base, ok := keyOf(t, "https://harmonista.org/@/blog/post")
+	assert.True(t, ok)
+	assert.Equal(t, "blog/post?accept=html&host=harmonista.org", base)
+
+	// Caixa, porta, ponto final e www são o mesmo host
+	for _, host := range []string{"HARMONISTA.org", "harmonista.org:443", "harmonista.org.", "www.harmonista.org"} {
+		key, _ := keyOf(t, "https://"+host+"/@/blog/post")
+		assert.Equal(t, base, key, host)
+	}
+
+	// O subdomínio do blog gera outra URL canônica, então outra entrada
+	key, ok := keyOf(t, "https://blog.harmonista.org/@/blog/post")
+	assert.True(t, ok)
+	assert.NotEqual(t, base, key)
+
+	// Hosts de fora do domínio não entram no cache
+	_, ok = keyOf(t, "https://evil.example/@/blog/post")
+	assert.False(t, ok)
+	_, ok = keyOf(t, "https://fakeharmonista.org/@/blog/post")
+	assert.False(t, ok)
+
+	// Em desenvolvimento vale localhost com qualquer porta
+	req := httptest.NewRequest("GET", "http://localhost:8080/leia", nil)
+	key, ok = NewKeyBuilder("").Key(req)
+	assert.True(t, ok)
+	assert.Equal(t, "_site/leia?accept=html&host=localhost", key)
+}
+
+func TestKeyBuilder_QueryParameters(t *testing.T) {
+	base, _ := keyOf(t, "https://harmonista.org/@/blog/post")
+
+	// Parâmetros de campanha não mudam a página
+	key, ok := keyOf(t, "https://harmonista.org/@/blog/post?utm_source=x&fbclid=y&ref=z")
+	assert.True(t, ok)
+	assert.Equal(t, base, key)
+
+	// A prévia de um tema do editor é outra variante da página
+	preview, ok := keyOf(t, "https://harmonista.org/@/blog/post?css="+theme)
+	assert.True(t, ok)
+	assert.NotEqual(t, base, preview)
+	assert.Contains(t, preview, "css=%2Fpublic%2Fcss%2Ftemas%2Fsepia.css")
+	again, _ := keyOf(t, "https://harmonista.org/@/blog/post?utm_medium=x&css="+theme)
+	assert.Equal(t, preview, again)
+
+	// Qualquer outra coisa passa direto pelo cache
+	for _, query := range []string{
+		"css=/x.css",
+		"css=/public/css/temas/../../segredo.css",
+		"css=" + theme + "&css=/public/css/temas/outro.css",
+		"page=2",
+		"q=busca",
+	} {
+		_, ok := keyOf(t, "https://harmonista.org/@/blog/post?"+query)
+		assert.False(t, ok, query)
+	}
+}
+
+func TestKeyBuilder_Accept(t *testing.T) {
+	base, _ := keyOf(t, "https://harmonista.org/@/blog/post")
+
+	browser, ok := keyOf(t, "https://harmonista.org/@/blog/post",
+		"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.True(t, ok)
+	assert.Equal(t, base, browser)
+
+	anything, _ := keyOf(t, "https://harmonista.org/@/blog/post", "Accept", "*/*")
+	assert.Equal(t, base, anything)
+
+	json, ok := keyOf(t, "https://harmonista.org/@/blog/post", "Accept", "application/json, text/html;q=0.5")
+	assert.True(t, ok)
+	assert.Equal(t, "blog/post?accept=json&host=harmonista.org", json)
+
+	feed, _ := keyOf(t, "https://harmonista.org/@/blog/post", "Accept", "application/rss+xml")
+	assert.Equal(t, "blog/post?accept=feed&host=harmonista.org", feed)
+
+	// Nenhum tipo conhecido, ou HTML recusado explicitamente
+	_, ok = keyOf(t, "https://harmonista.org/@/blog/post", "Accept", "image/png")
+	assert.False(t, ok)
+	_, ok = keyOf(t, "https://harmonista.org/@/blog/post", "Accept", "text/html;q=0")
+	assert.False(t, ok)
+}
+
+func TestCacheMiddleware_KeepsVariantsApart(t *testing.T) {
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		Depends(c, PostDep(1))
+		c.Data(200, "text/html; charset=utf-8", []byte("tema:"+c.Query("css")))
+	})
+
+	get := func(url string) (string, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w.Header().Get("X-Cache"), w.Body.String()
+	}
+
+	get("https://harmonista.org/@/blog/post")
+	get("https://harmonista.org/@/blog/post?css=" + theme)
+
+	status, body := get("https://harmonista.org/@/blog/post")
+	assert.Equal(t, "HIT", status)
+	assert.Equal(t, "tema:", body)
+	status, body = get("https://harmonista.org/@/blog/post?css=" + theme)
+	assert.Equal(t, "HIT", status)
+	assert.Equal(t, "tema:"+theme, body)
+
+	// ClearCache leva todas as variantes da página
+	assert.NoError(t, ClearCache("blog", "post"))
+	status, _ = get("https://harmonista.org/@/blog/post?css=" + theme)
+	assert.Equal(t, "MISS", status)
+	status, _ = get("https://harmonista.org/@/blog/post")
+	assert.Equal(t, "MISS", status)
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps entries in memory up to maxBytes of body, evicting the
+// least recently used ones first
+type MemoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List // front = most recently used
+	entries  map[string]*list.Element
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemoryStore creates an LRU store holding at most maxBytes of bodies
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		s.misses++
+		return nil, false
+	}
+	s.hits++
+	s.order.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (s *MemoryStore) Set(key string, entry *Entry) error {
+	size := entry.size()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Bodies larger than the whole store would evict everything for nothing
+	if size > s.maxBytes {
+		s.removeLocked(key)
+		return nil
+	}
+
+	if el, ok := s.entries[key]; ok {
+		item := el.Value.(*memoryItem)
+		s.bytes += size - item.entry.size()
+		item.entry = entry
+		s.order.MoveToFront(el)
+	} else {
+		s.entries[key] = s.order.PushFront(&memoryItem{key: key, entry: entry})
+		s.bytes += size
+	}
+
+	for s.bytes > s.maxBytes {
+		oldest := s.order.Back()
+		s.removeLocked(oldest.Value.(*memoryItem).key)
+		s.evictions++
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(key)
+	return nil
+}
+
+func (s *MemoryStore) DeletePrefix(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			s.removeLocked(key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) removeLocked(key string) {
+	el, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.order.Remove(el)
+	delete(s.entries, key)
+	s.bytes -= el.Value.(*memoryItem).entry.size()
+}
+
+func (s *MemoryStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Name:      "memory",
+		Entries:   len(s.entries),
+		Bytes:     s.bytes,
+		MaxBytes:  s.maxBytes,
+		Hits:      s.hits,
+		Misses:    s.misses,
+		Evictions: s.evictions,
+	}
+}
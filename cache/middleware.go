@@ -3,23 +3,49 @@ package cache
 import (
 	"bytes"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// responseWriter holds the body of a page being rendered, so it can be
+// stored and sent with its validators and compressed variants
 type responseWriter struct {
 	gin.ResponseWriter
 	body *bytes.Buffer
 }
 
 func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+	return w.body.Write(b)
 }
 
-// CacheMiddleware is a middleware that caches blog post pages
+func (w *responseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow waits for flush; the status is still recorded
+func (w *responseWriter) WriteHeaderNow() {}
+
+func (w *responseWriter) Flush() {}
+
+// flush sends the response as the handler wrote it
+func (w *responseWriter) flush() {
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+const htmlContentType = "text/html; charset=utf-8"
+
+// CacheMiddleware caches the public pages of blogs and the /leia reader.
+// Pages are only stored when the handler declared what they depend on
+// (see Depends), so they can be purged when that data changes. Stored
+// pages carry an ETag and Last-Modified and are sent precompressed.
 func CacheMiddleware(maxAge time.Duration) gin.HandlerFunc {
+	keys := NewKeyBuilder(os.Getenv("DOMAIN"))
+
 	return func(c *gin.Context) {
 		// Only cache GET requests
 		if c.Request.Method != "GET" {
@@ -27,84 +53,137 @@ func CacheMiddleware(maxAge time.Duration) gin.HandlerFunc {
 			return
 		}
 
-		// Only cache blog post pages (/@/subdomain/slug)
-		path := c.Request.URL.Path
-		if !isBlogPostPath(path) {
+		// Foreign hosts and unknown parameters or media types bypass the cache
+		key, ok := keys.Key(c.Request)
+		if !ok {
 			c.Next()
 			return
 		}
 
-		// Extract subdomain and slug from path
-		subdomain, slug := extractFromPath(path)
-		if subdomain == "" || slug == "" {
-			c.Next()
-			return
+		policy := PagePolicy
+		if c.Query("css") != "" {
+			policy = PreviewPolicy
 		}
-
-		// Try to read from cache
-		if cached, found := ReadCache(subdomain, slug, maxAge); found {
-			c.Header("X-Cache", "HIT")
-			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(cached))
-			c.Abort()
-			return
+		c.Header("Vary", "Accept")
+
+		// Try to read from cache. Expired entries are still served for
+		// another maxAge while a background render replaces them.
+		store := DefaultStore()
+		if entry, found := store.Get(key); found && !Background(c) {
+			age := time.Since(entry.StoredAt)
+			if age <= 2*maxAge {
+				callOnHit(c, entry.Visit)
+				if age <= maxAge {
+					c.Header("X-Cache", "HIT")
+				} else {
+					c.Header("X-Cache", "STALE")
+					revalidate(key, c.Request)
+				}
+				serveEntry(c, entry, htmlContentType, policy)
+				c.Abort()
+				return
+			}
 		}
 
-		// Cache miss - capture response
+		// Cache miss - concurrent misses of the key wait for a single render
 		c.Header("X-Cache", "MISS")
-
-		// Create custom writer to capture response
-		writer := &responseWriter{
-			ResponseWriter: c.Writer,
-			body:           bytes.NewBuffer(nil),
-		}
-		c.Writer = writer
-
-		c.Next()
-
-		// Only cache successful HTML responses
-		if c.Writer.Status() == http.StatusOK &&
-			c.Writer.Header().Get("Content-Type") == "text/html; charset=utf-8" {
-			WriteCache(subdomain, slug, writer.body.String())
+		var writer *responseWriter
+		result, _, _ := flights.Do(key, func() (any, error) {
+			started := index.begin()
+			defer index.end(started)
+			writer = renderPage(c)
+			return storePage(c, store, key, writer, started), nil
+		})
+		entry, _ := result.(*Entry)
+
+		switch {
+		case entry != nil:
+			if writer == nil {
+				// Rendered by the request this one waited for
+				callOnHit(c, entry.Visit)
+				c.Abort()
+			}
+			serveEntry(c, entry, htmlContentType, policy)
+		case writer != nil:
+			writer.flush()
+		default:
+			// The page that was rendered can't be shared: render our own
+			c.Next()
 		}
 	}
 }
 
-// isBlogPostPath checks if the path is a blog post path (/@/subdomain/slug)
-func isBlogPostPath(path string) bool {
-	// /@/subdomain/postslug or subdomain.domain/postslug
-	// We'll detect based on the number of slashes
-	// /@/subdomain/slug has 3 parts when split by /
-	// Skip if it's an index, page, or tag route
-	if len(path) < 4 || path[len(path)-1] == '/' {
-		return false
+// renderPage runs the handlers, holding the response they write
+func renderPage(c *gin.Context) *responseWriter {
+	original := c.Writer
+	writer := &responseWriter{
+		ResponseWriter: original,
+		body:           bytes.NewBuffer(nil),
 	}
+	c.Writer = writer
+	defer func() { c.Writer = original }()
 
-	// Skip /p/ (pages) and /t/ (tags)
-	if bytes.Contains([]byte(path), []byte("/p/")) ||
-		bytes.Contains([]byte(path), []byte("/t/")) {
-		return false
+	c.Next()
+	return writer
+}
+
+// storePage stores the response held by writer and returns the entry, or
+// nil when the response can't be cached. started is the purge sequence
+// taken before rendering.
+func storePage(c *gin.Context, store Store, key string, writer *responseWriter, started uint64) *Entry {
+	// Only cache successful HTML responses that declared dependencies
+	deps := c.GetStringSlice(depsContextKey)
+	if len(deps) == 0 ||
+		writer.Status() != http.StatusOK ||
+		writer.Header().Get("Content-Type") != htmlContentType {
+		return nil
 	}
 
-	return true
+	entry := &Entry{Body: writer.body.Bytes(), StoredAt: time.Now(), Deps: deps}
+	if visit, ok := c.Get(visitContextKey); ok {
+		entry.Visit = visit.(*Visit)
+	}
+	precompress(entry)
+	if err := store.Set(key, entry); err == nil {
+		// Something the page used changed while it was rendering
+		if !index.addIfFresh(key, deps, started) {
+			store.Delete(key)
+		}
+	}
+	return entry
 }
 
-// extractFromPath extracts subdomain and slug from path
-// For /@/subdomain/slug format
-func extractFromPath(path string) (subdomain, slug string) {
-	// Remove leading slash
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
+// privateRoutes are the pages behind a session
+var privateRoutes = []string{"/admin", "/$", "/login", "/cadastrar", "/cadastro", "/confirmar"}
+
+// ControlMiddleware sets PrivatePolicy on the session pages, so neither
+// browsers nor proxies keep them; blog pages and assets set their own
+func ControlMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, route := range privateRoutes {
+			if path == route || strings.HasPrefix(path, route+"/") {
+				c.Header("Cache-Control", PrivatePolicy)
+				break
+			}
+		}
+		c.Next()
 	}
+}
 
-	// Split by /
+// keyFromPath returns the path part of the key of a cacheable path, or ""
+// otherwise:
+// /@/subdomain/rest becomes "subdomain/rest" and /leia/rest "_site/leia/rest"
+func keyFromPath(path string) string {
 	parts := splitPath(path)
-
-	// /@/subdomain/slug format
-	if len(parts) >= 3 && parts[0] == "@" {
-		return parts[1], parts[2]
+	switch {
+	case len(parts) >= 2 && parts[0] == "@":
+		return pageKey(parts[1], strings.Join(parts[2:], "/"))
+	case len(parts) >= 1 && parts[0] == "leia":
+		return pageKey(siteKeyPrefix, strings.Join(parts, "/"))
+	default:
+		return ""
 	}
-
-	return "", ""
 }
 
 func splitPath(path string) []string {
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// flights coalesces concurrent misses of the same key into one render
+	flights singleflight.Group
+
+	// refreshing holds the keys being revalidated in the background
+	refreshing sync.Map
+
+	rendererMu sync.RWMutex
+	renderer   http.Handler
+)
+
+// backgroundKey marks, in the request context, renders started by the
+// cache itself rather than by a client
+type backgroundKey struct{}
+
+// SetRenderer registers the handler (the router) that renders pages
+// outside of client requests: stale revalidation and Warm
+func SetRenderer(h http.Handler) {
+	rendererMu.Lock()
+	defer rendererMu.Unlock()
+	renderer = h
+}
+
+// Background reports whether c is a render started by the cache, which
+// handlers must not count as a visit
+func Background(c *gin.Context) bool {
+	return c.Request.Context().Value(backgroundKey{}) != nil
+}
+
+// discardWriter is the ResponseWriter of background renders; the page
+// only matters for what the middleware stores
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// backgroundRequest copies r for a background render, without what ties
+// it to the client: cookies, validators and cancellation
+func backgroundRequest(r *http.Request) *http.Request {
+	req := r.Clone(context.WithValue(context.Background(), backgroundKey{}, true))
+	req.Header.Del("Cookie")
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	return req
+}
+
+// render runs a background request through the renderer and returns the
+// status of the response, or 0 without a renderer
+func render(req *http.Request) int {
+	rendererMu.RLock()
+	h := renderer
+	rendererMu.RUnlock()
+	if h == nil {
+		return 0
+	}
+
+	w := &discardWriter{header: make(http.Header)}
+	h.ServeHTTP(w, req)
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// revalidate renders key again in the background, unless a refresh of it
+// is already running
+func revalidate(key string, r *http.Request) {
+	if _, running := refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	req := backgroundRequest(r)
+	go func() {
+		defer refreshing.Delete(key)
+		render(req)
+	}()
+}
+
+// Warm renders the pages at urls that are not in the store yet, so their
+// first visitor doesn't wait for them; on a tiered store, pages only on
+// disk are brought back to memory. It returns how many were rendered.
+func Warm(urls ...string) int {
+	keys := NewKeyBuilder(os.Getenv("DOMAIN"))
+	store := DefaultStore()
+
+	rendered := 0
+	for _, url := range urls {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			continue
+		}
+		key, ok := keys.Key(req)
+		if !ok {
+			continue
+		}
+		if _, found := store.Get(key); found {
+			continue
+		}
+		if render(backgroundRequest(req)) == http.StatusOK {
+			rendered++
+		}
+	}
+	return rendered
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMiddleware_CoalescesMisses(t *testing.T) {
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	var renders atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		if renders.Add(1) == 1 {
+			close(entered)
+		}
+		<-release
+		if c.Param("slug") == "sem-deps" {
+			c.Data(200, htmlContentType, []byte("x"))
+			return
+		}
+		Depends(c, PostDep(1))
+		c.Data(200, htmlContentType, []byte("post"))
+	})
+
+	run := func(path string, n int) []string {
+		bodies := make([]string, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "https://harmonista.org"+path, nil))
+				bodies[i] = w.Body.String()
+			}(i)
+			if i == 0 {
+				<-entered
+			}
+		}
+		// Dá tempo para as outras chegarem enquanto a primeira renderiza
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return bodies
+	}
+
+	// Quem chega durante a renderização espera por ela; quem chega depois
+	// já encontra a página no cache
+	for _, body := range run("/@/blog/post", 10) {
+		assert.Equal(t, "post", body)
+	}
+	assert.Equal(t, int32(1), renders.Load())
+
+	// Uma resposta que não vai para o cache não é compartilhada
+	renders.Store(0)
+	entered = make(chan struct{})
+	release = make(chan struct{})
+	for _, body := range run("/@/blog/sem-deps", 5) {
+		assert.Equal(t, "x", body)
+	}
+	assert.Equal(t, int32(5), renders.Load())
+}
+
+func TestCacheMiddleware_StaleWhileRevalidate(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	useStore(t, store)
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	var hits, background atomic.Int32
+	OnHit(func(c *gin.Context, visit Visit) { hits.Add(1) })
+	t.Cleanup(func() { OnHit(nil) })
+
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		if Background(c) {
+			background.Add(1)
+			assert.Empty(t, c.GetHeader("Cookie"))
+		}
+		Depends(c, PostDep(1))
+		VisitOnHit(c, 1, nil)
+		c.Data(200, htmlContentType, []byte("novo"))
+	})
+	SetRenderer(router)
+	t.Cleanup(func() { SetRenderer(nil) })
+
+	get := func() (string, string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://harmonista.org/@/blog/post", nil)
+		req.Header.Set("Cookie", "harmonista-session=x")
+		router.ServeHTTP(w, req)
+		return w.Header().Get("X-Cache"), w.Body.String()
+	}
+	key, _ := NewKeyBuilder("https://harmonista.org").Key(httptest.NewRequest("GET", "https://harmonista.org/@/blog/post", nil))
+	expired := &Entry{Body: []byte("velho"), StoredAt: time.Now().Add(-90 * time.Minute), Deps: []string{PostDep(1)}, Visit: &Visit{BlogID: 1}}
+
+	// Vencida há pouco: sai a versão velha e uma nova é feita em segundo plano
+	store.Set(key, expired)
+	status, body := get()
+	assert.Equal(t, "STALE", status)
+	assert.Equal(t, "velho", body)
+	assert.Eventually(t, func() bool {
+		entry, ok := store.Get(key)
+		return ok && string(entry.Body) == "novo"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), background.Load())
+
+	status, body = get()
+	assert.Equal(t, "HIT", status)
+	assert.Equal(t, "novo", body)
+	assert.Equal(t, int32(2), hits.Load(), "a renderização em segundo plano não é uma visita")
+
+	// Vencida há mais que maxAge de novo: é refeita na hora
+	expired.StoredAt = time.Now().Add(-3 * time.Hour)
+	store.Set(key, expired)
+	status, body = get()
+	assert.Equal(t, "MISS", status)
+	assert.Equal(t, "novo", body)
+}
+
+func TestWarm(t *testing.T) {
+	useStore(t, NewMemoryStore(1<<20))
+	t.Setenv("DOMAIN", "https://harmonista.org")
+	gin.SetMode(gin.TestMode)
+
+	renders := map[string]int{}
+	router := gin.New()
+	router.Use(CacheMiddleware(time.Hour))
+	router.GET("/@/:subdomain/:slug", func(c *gin.Context) {
+		renders[c.Param("slug")]++
+		if c.Param("slug") == "sumiu" {
+			c.Data(404, htmlContentType, []byte("não encontrado"))
+			return
+		}
+		Depends(c, PostDep(1))
+		c.Data(200, htmlContentType, []byte("post"))
+	})
+
+	// Sem roteador registrado não há o que fazer
+	assert.Equal(t, 0, Warm("https://harmonista.org/@/blog/a"))
+
+	SetRenderer(router)
+	t.Cleanup(func() { SetRenderer(nil) })
+	urls := []string{"https://harmonista.org/@/blog/a", "https://harmonista.org/@/blog/b", "https://harmonista.org/@/blog/sumiu", "https://outro.site/@/blog/c"}
+	assert.Equal(t, 2, Warm(urls...))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "https://harmonista.org/@/blog/a", nil))
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	// Páginas que já estão no cache não são refeitas
+	assert.Equal(t, 0, Warm(urls[:2]...))
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "sumiu": 1}, renders)
+}
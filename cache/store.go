@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response body and the time it was stored
+type Entry struct {
+	Body     []byte
+	StoredAt time.Time
+	Deps     []string // see Depends
+	Visit    *Visit   // see VisitOnHit
+
+	// Filled in by precompress when the entry is written
+	ETag   string // hash of Body
+	Gzip   []byte
+	Brotli []byte
+}
+
+// size is what the entry takes in memory, counting its variants
+func (e *Entry) size() int64 {
+	return int64(len(e.Body) + len(e.Gzip) + len(e.Brotli))
+}
+
+// Stats summarizes a store's usage since the process started
+type Stats struct {
+	Name      string
+	Entries   int
+	Bytes     int64
+	MaxBytes  int64 // 0 when the store is not size-bounded
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Tiers     []Stats // tiers of a composed store, fastest first
+}
+
+// HitRate returns the share of lookups that were hits, in percent
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses) * 100
+}
+
+// Store is where cached pages live. Keys use "/" to separate the blog
+// subdomain from the rest ("subdomain/slug"), so DeletePrefix("sub/")
+// drops a whole blog.
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry) error
+	Delete(key string) error
+	DeletePrefix(prefix string) error
+	Stats() Stats
+}
+
+// pruner is implemented by stores that can drop expired entries in bulk
+type pruner interface {
+	Prune(maxAge time.Duration) error
+}
+
+var (
+	storeMu      sync.RWMutex
+	defaultStore Store = NewFileStore("cache")
+)
+
+// SetStore replaces the store used by the middleware and the Clear* helpers
+// and loads the dependencies of the entries it already has
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	defaultStore = s
+	rebuildIndex(s)
+}
+
+// DefaultStore returns the store used by the middleware and the Clear* helpers
+func DefaultStore() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return defaultStore
+}
+
+// NewStoreFromEnv builds the store configured by CACHE_STORE: "file"
+// (pages on disk), "memory" (LRU limited to CACHE_MEMORY_MB) or "tiered"
+// (the default, memory in front of disk)
+func NewStoreFromEnv() Store {
+	maxBytes := int64(64) << 20
+	if mb, err := strconv.ParseInt(os.Getenv("CACHE_MEMORY_MB"), 10, 64); err == nil && mb > 0 {
+		maxBytes = mb << 20
+	}
+
+	switch kind := os.Getenv("CACHE_STORE"); kind {
+	case "file":
+		return NewFileStore("cache")
+	case "memory":
+		return NewMemoryStore(maxBytes)
+	case "", "tiered":
+		return NewTieredStore(NewMemoryStore(maxBytes), NewFileStore("cache"))
+	default:
+		log.Printf("Unknown CACHE_STORE %q, using tiered", kind)
+		return NewTieredStore(NewMemoryStore(maxBytes), NewFileStore("cache"))
+	}
+}
+
+// pageKey is the store key of a blog page; slug is the path after the
+// subdomain, empty for the index
+func pageKey(subdomain, slug string) string {
+	return subdomain + "/" + slug
+}
+
+// siteKeyPrefix holds the pages outside of blogs, like the /leia reader
+const siteKeyPrefix = "_site"
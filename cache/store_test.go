@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func entry(body string) *Entry {
+	return &Entry{Body: []byte(body), StoredAt: time.Now()}
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(10)
+	s.Set("blog/a", entry("1234"))
+	s.Set("blog/b", entry("1234"))
+	s.Get("blog/a") // a passa a ser a mais recente
+	s.Set("blog/c", entry("1234"))
+
+	_, ok := s.Get("blog/b")
+	assert.False(t, ok, "b deveria ter sido despejada")
+	_, ok = s.Get("blog/a")
+	assert.True(t, ok)
+
+	// Maior que o store inteiro: não é guardada
+	s.Set("blog/d", entry("12345678901"))
+	_, ok = s.Get("blog/d")
+	assert.False(t, ok)
+
+	stats := s.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(8), stats.Bytes)
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+}
+
+func TestMemoryStore_DeletePrefix(t *testing.T) {
+	s := NewMemoryStore(1 << 10)
+	s.Set("blog/a", entry("x"))
+	s.Set("blog/b", entry("x"))
+	s.Set("blog2/a", entry("x"))
+
+	assert.NoError(t, s.DeletePrefix("blog/"))
+	_, ok := s.Get("blog/a")
+	assert.False(t, ok)
+	_, ok = s.Get("blog2/a")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), s.Stats().Bytes)
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStore(dir)
+	stored := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	assert.NoError(t, s.Set("blog/meu-post", &Entry{Body: []byte("<p>oi</p>"), StoredAt: stored}))
+	got, ok := s.Get("blog/meu-post")
+	assert.True(t, ok)
+	assert.Equal(t, "<p>oi</p>", string(got.Body))
+	assert.True(t, stored.Equal(got.StoredAt))
+
+	// Mantém o formato de arquivo de antes do Store
+	_, err := os.Stat(filepath.Join(dir, "blog", "meu-post_"+generateHash("blogmeu-post")[:16]+".html"))
+	assert.NoError(t, err)
+
+	// Chaves não escapam do diretório do cache
+	path, err := s.path("../fora/../../x")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "--"), filepath.Dir(path))
+
+	s.Set("blog/outro", entry("x"))
+	assert.NoError(t, s.DeletePrefix("blog/meu"))
+	_, ok = s.Get("blog/meu-post")
+	assert.False(t, ok)
+	_, ok = s.Get("blog/outro")
+	assert.True(t, ok)
+
+	assert.NoError(t, s.DeletePrefix("blog/"))
+	_, err = os.Stat(filepath.Join(dir, "blog"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileStore_Prune(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	s.Set("blog/velho", &Entry{Body: []byte("x"), StoredAt: time.Now().Add(-48 * time.Hour)})
+	s.Set("blog/novo", entry("x"))
+
+	assert.NoError(t, s.Prune(24*time.Hour))
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, int64(1), stats.Evictions)
+}
+
+func TestTieredStore_PromotesFromBack(t *testing.T) {
+	front := NewMemoryStore(1 << 10)
+	back := NewFileStore(t.TempDir())
+	s := NewTieredStore(front, back)
+
+	back.Set("blog/a", entry("do disco"))
+	got, ok := s.Get("blog/a")
+	assert.True(t, ok)
+	assert.Equal(t, "do disco", string(got.Body))
+
+	// A segunda leitura já vem da memória
+	_, ok = front.Get("blog/a")
+	assert.True(t, ok)
+
+	s.Set("blog/b", entry("x"))
+	_, ok = back.Get("blog/b")
+	assert.True(t, ok)
+
+	assert.NoError(t, s.DeletePrefix("blog/"))
+	_, ok = s.Get("blog/a")
+	assert.False(t, ok)
+
+	stats := s.Stats()
+	assert.Equal(t, "tiered", stats.Name)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Len(t, stats.Tiers, 2)
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TieredStore puts a fast store in front of a larger one. Reads fall
+// through to the back and promote what they find; writes and deletes go
+// to both.
+type TieredStore struct {
+	front Store
+	back  Store
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewTieredStore composes front (usually memory) and back (usually files)
+func NewTieredStore(front, back Store) *TieredStore {
+	return &TieredStore{front: front, back: back}
+}
+
+func (s *TieredStore) Get(key string) (*Entry, bool) {
+	if entry, ok := s.front.Get(key); ok {
+		s.hits.Add(1)
+		return entry, true
+	}
+	entry, ok := s.back.Get(key)
+	if !ok {
+		s.misses.Add(1)
+		return nil, false
+	}
+	s.hits.Add(1)
+	s.front.Set(key, entry)
+	return entry, true
+}
+
+func (s *TieredStore) Set(key string, entry *Entry) error {
+	if err := s.back.Set(key, entry); err != nil {
+		return err
+	}
+	return s.front.Set(key, entry)
+}
+
+func (s *TieredStore) Delete(key string) error {
+	if err := s.front.Delete(key); err != nil {
+		return err
+	}
+	return s.back.Delete(key)
+}
+
+func (s *TieredStore) DeletePrefix(prefix string) error {
+	if err := s.front.DeletePrefix(prefix); err != nil {
+		return err
+	}
+	return s.back.DeletePrefix(prefix)
+}
+
+// Stats reports hits and misses of the composition; entries, sizes and
+// evictions are in each tier
+func (s *TieredStore) Stats() Stats {
+	front, back := s.front.Stats(), s.back.Stats()
+	return Stats{
+		Name:      "tiered",
+		Entries:   back.Entries,
+		Bytes:     back.Bytes,
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Evictions: front.Evictions + back.Evictions,
+		Tiers:     []Stats{front, back},
+	}
+}
+
+// Prune removes old entries from the tiers that support it
+func (s *TieredStore) Prune(maxAge time.Duration) error {
+	for _, tier := range []Store{s.front, s.back} {
+		if p, ok := tier.(pruner); ok {
+			if err := p.Prune(maxAge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Each lists the entries of the back tier, which outlives restarts
+func (s *TieredStore) Each(fn func(key string, deps []string)) {
+	if l, ok := s.back.(lister); ok {
+		l.Each(fn)
+	}
+}
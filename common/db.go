@@ -1,60 +1,95 @@
 package common
 
 import (
+	"fmt"
 	"log"
 	"os"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func ConnectDb() *gorm.DB {
-	var envFile map[string]string
-
-	get := func(key string) string {
-		if v, ok := envFile[key]; ok && v != "" {
-			return v
-		}
-		return os.Getenv(key)
-	}
+// Drivers de banco suportados (variáveis database e analytics_database)
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
 
-	dbFile := get("sqlite_db")
-	log.Println("attemptConnectDb: sqlite_db from env (raw):", dbFile)
-	if dbFile == "" {
-		log.Println("sqlite_db not set")
-		return nil
+// OpenDb abre o banco com o driver indicado. Para sqlite, dsn é o caminho
+// do arquivo; para postgres, uma URL (postgres://...) ou "host=... user=...".
+func OpenDb(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case "", DriverSQLite:
+		dialector = sqlite.Open(dsn)
+	case DriverPostgres, "postgresql":
+		dialector = postgres.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
 	}
 
-	db, err := gorm.Open(sqlite.Open(dbFile), &gorm.Config{
+	return gorm.Open(dialector, &gorm.Config{
 		DisableForeignKeyConstraintWhenMigrating: true,
 	})
+}
+
+func ConnectDb() *gorm.DB {
+	driver := os.Getenv("database")
+	if driver == "" {
+		driver = DriverSQLite
+	}
+
+	var dsn string
+	switch driver {
+	case DriverPostgres, "postgresql":
+		dsn = os.Getenv("postgres_dsn")
+		if dsn == "" {
+			log.Println("postgres_dsn not set")
+			return nil
+		}
+	default:
+		dsn = os.Getenv("sqlite_db")
+		log.Println("attemptConnectDb: sqlite_db from env (raw):", dsn)
+		if dsn == "" {
+			log.Println("sqlite_db not set")
+			return nil
+		}
+	}
+
+	db, err := OpenDb(driver, dsn)
 	if err != nil {
-		log.Println("Error opening sqlite db: " + err.Error())
+		log.Printf("Error opening %s db: %v", driver, err)
 		return nil
 	}
-	log.Println("opened sqlite db at:", dbFile)
+	log.Printf("opened %s db", driver)
 	return db
-
 }
 
-// ConnectAnalyticsDb conecta ao banco de dados de analytics separado
+// ConnectAnalyticsDb conecta ao banco de dados de analytics separado.
+// analytics_database escolhe o driver (sqlite por padrão) e analytics_db
+// é o arquivo ou a conexão do Postgres.
 func ConnectAnalyticsDb() *gorm.DB {
-	analyticsDbFile := os.Getenv("analytics_db")
-	log.Println("attemptConnectAnalyticsDb: analytics_db from env (raw):", analyticsDbFile)
+	driver := os.Getenv("analytics_database")
+	if driver == "" {
+		driver = DriverSQLite
+	}
+	dsn := os.Getenv("analytics_db")
+	if driver == DriverSQLite {
+		log.Println("attemptConnectAnalyticsDb: analytics_db from env (raw):", dsn)
+	}
 
-	if analyticsDbFile == "" {
+	if dsn == "" {
 		log.Println("analytics_db not set - analytics will be disabled")
 		return nil
 	}
 
-	db, err := gorm.Open(sqlite.Open(analyticsDbFile), &gorm.Config{
-		DisableForeignKeyConstraintWhenMigrating: true,
-	})
+	db, err := OpenDb(driver, dsn)
 	if err != nil {
-		log.Println("Error opening analytics sqlite db: " + err.Error())
+		log.Printf("Error opening analytics %s db: %v", driver, err)
 		return nil
 	}
 
-	log.Println("opened analytics sqlite db at:", analyticsDbFile)
+	log.Printf("opened analytics %s db", driver)
 	return db
 }
@@ -0,0 +1,14 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/common"
+)
+
+func TestOpenDb_UnknownDriver(t *testing.T) {
+	_, err := common.OpenDb("mysql", "x")
+	assert.Error(t, err)
+}
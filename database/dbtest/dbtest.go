@@ -0,0 +1,96 @@
+// Package dbtest abre os bancos usados nos testes.
+//
+// Por padrão cada teste ganha um SQLite novo. Com TEST_DATABASE=postgres,
+// os testes rodam no Postgres apontado por TEST_POSTGRES_DSN, cada um em
+// um schema próprio apagado no fim. scripts/test-postgres.sh sobe um
+// container e roda a suíte assim; o CI faz o mesmo a cada push.
+package dbtest
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"harmonista/common"
+)
+
+var schemas atomic.Int64
+
+// Driver é o driver dos bancos de teste, conforme TEST_DATABASE
+func Driver() string {
+	if os.Getenv("TEST_DATABASE") == common.DriverPostgres {
+		return common.DriverPostgres
+	}
+	return common.DriverSQLite
+}
+
+// Open devolve um banco vazio, só deste teste
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	if Driver() == common.DriverPostgres {
+		return openPostgres(t)
+	}
+
+	db, err := common.OpenDb(common.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDb(db) })
+	return db
+}
+
+func openPostgres(t testing.TB) *gorm.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Fatal("TEST_DATABASE=postgres needs TEST_POSTGRES_DSN")
+	}
+
+	admin, err := common.OpenDb(common.DriverPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d_%d_%d", os.Getpid(), time.Now().UnixNano()%1e6, schemas.Add(1))
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		closeDb(admin)
+		t.Fatal(err)
+	}
+
+	db, err := common.OpenDb(common.DriverPostgres, withSearchPath(dsn, schema))
+	if err != nil {
+		closeDb(admin)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		closeDb(db)
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		closeDb(admin)
+	})
+	return db
+}
+
+// withSearchPath faz a conexão usar o schema do teste, nos dois formatos
+// de DSN aceitos pelo driver
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+func closeDb(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
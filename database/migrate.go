@@ -0,0 +1,150 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration é uma mudança numerada do schema. Down nil marca uma migração
+// irreversível.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration registra uma migração aplicada
+type SchemaMigration struct {
+	Version   int    `gorm:"primary_key;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus é uma migração conhecida e, se aplicada, quando foi
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator aplica e desfaz uma lista ordenada de migrações
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	for i, m := range migrations {
+		if m.Version <= 0 || m.Up == nil {
+			return nil, fmt.Errorf("migration %q: needs a positive version and Up", m.Name)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("migration %d (%s) is out of order", m.Version, m.Name)
+		}
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Up aplica as migrações pendentes em ordem, cada uma na sua transação,
+// e devolve quantas foram aplicadas
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down desfaz as últimas steps migrações aplicadas, da mais nova para a
+// mais antiga, e devolve quantas foram desfeitas
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return count, fmt.Errorf("migration %d_%s is irreversible", migration.Version, migration.Name)
+		}
+		log.Printf("Reverting migration %d_%s", migration.Version, migration.Name)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lista todas as migrações conhecidas, aplicadas ou não
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i].Migration = migration
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status[i].AppliedAt = &appliedAt
+		}
+	}
+	return status, nil
+}
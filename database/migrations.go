@@ -1,6 +1,7 @@
 package database
 
 import (
+	"fmt"
 	"log"
 
 	"harmonista/models"
@@ -8,23 +9,277 @@ import (
 	"gorm.io/gorm"
 )
 
+// Migrations é o histórico do schema, em ordem. Uma migração aplicada não
+// muda mais: correções entram como uma nova no fim da lista. Por isso elas
+// usam as structs congeladas de schema.go ou SQL, nunca os models.
+var Migrations = []Migration{
+	{
+		// Schema de antes das migrações versionadas. Bancos existentes
+		// passam por aqui sem mudanças, porque o AutoMigrate só cria o que
+		// falta. Desfazer apaga todas as tabelas.
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(schemaV1...)
+		},
+		Down: func(tx *gorm.DB) error {
+			for i := len(schemaV1) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(schemaV1[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// A tag mal formada em Tag.Title fazia o gorm ignorar o índice
+		Version: 2,
+		Name:    "tags_title_index",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_tags_title ON tags (title)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX idx_tags_title").Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "unique_post_slugs",
+		Up: func(tx *gorm.DB) error {
+			return uniqueSlugs(tx, "posts")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX idx_posts_blog_slug").Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "unique_page_slugs",
+		Up: func(tx *gorm.DB) error {
+			return uniqueSlugs(tx, "pages")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX idx_pages_blog_slug").Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "slug_redirects",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&slugRedirectV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&slugRedirectV5{})
+		},
+	},
+	{
+		// DeletedAt virou gorm.DeletedAt: a coluna já existia, falta o índice
+		// que a tag antiga (sql:"index") nunca criou
+		Version: 6,
+		Name:    "soft_delete_indexes",
+		Up: func(tx *gorm.DB) error {
+			for _, table := range []string{"posts", "pages"} {
+				if err := tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_deleted_at ON %s (deleted_at)", table, table)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, table := range []string{"posts", "pages"} {
+				if err := tx.Exec(fmt.Sprintf("DROP INDEX idx_%s_deleted_at", table)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, {
+		Version: 7,
+		Name:    "blog_scoped_tags",
+		Up:      blogScopedTags,
+		Down: func(tx *gorm.DB) error {
+			for _, index := range []string{"idx_tags_blog_name", "idx_tags_name"} {
+				if err := tx.Exec("DROP INDEX " + index).Error; err != nil {
+					return err
+				}
+			}
+			// No SQLite o DropColumn do gorm recria a tabela e perde o
+			// idx_tags_title; o ALTER TABLE mantém os outros índices
+			for _, column := range []string{"name", "description", "blog_id"} {
+				if err := tx.Exec("ALTER TABLE tags DROP COLUMN " + column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// uniqueSlugs renomeia os slugs repetidos em um blog (o mais antigo fica
+// com o original, os outros ganham -2, -3...) e cria o índice único
+// (blog_id, slug). Desfazer remove só o índice; os slugs renomeados ficam.
+func uniqueSlugs(tx *gorm.DB, table string) error {
+	var rows []struct {
+		ID     uint
+		BlogID int
+		Slug   string
+	}
+	if err := tx.Table(table).Select("id, blog_id, slug").Order("id").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	taken := make(map[int]map[string]bool)
+	for _, row := range rows {
+		if taken[row.BlogID] == nil {
+			taken[row.BlogID] = make(map[string]bool)
+		}
+		taken[row.BlogID][row.Slug] = true
+	}
+
+	seen := make(map[int]map[string]bool)
+	for _, row := range rows {
+		if seen[row.BlogID] == nil {
+			seen[row.BlogID] = make(map[string]bool)
+		}
+		if !seen[row.BlogID][row.Slug] {
+			seen[row.BlogID][row.Slug] = true
+			continue
+		}
+
+		slug := row.Slug
+		for n := 2; taken[row.BlogID][slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", row.Slug, n)
+		}
+		taken[row.BlogID][slug] = true
+		seen[row.BlogID][slug] = true
+		log.Printf("Renaming duplicate slug in %s %d: %q -> %q", table, row.ID, row.Slug, slug)
+		if err := tx.Table(table).Where("id = ?", row.ID).Update("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_blog_slug ON %s (blog_id, slug)", table, table)).Error
+}
+
+// blogScopedTags separa as tags globais por blog. Cada blog que usava uma
+// tag ganha a sua (a primeira reaproveita a linha antiga); tags que só
+// diferem na caixa ou nos espaços viram uma só e as tags sem posts somem.
+func blogScopedTags(tx *gorm.DB) error {
+	for _, column := range []string{"BlogID", "Name", "Description"} {
+		if tx.Migrator().HasColumn(&tagV7{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&tagV7{}, column); err != nil {
+			return err
+		}
+	}
+
+	var tags []tagV7
+	if err := tx.Where("blog_id = 0").Find(&tags).Error; err != nil {
+		return err
+	}
+	titles := make(map[uint]string, len(tags))
+	for _, tag := range tags {
+		titles[tag.ID] = tag.Title
+	}
+
+	// Ligações de posts já apagados de vez não têm blog para onde ir
+	if err := tx.Where("post_id NOT IN (SELECT id FROM posts)").Delete(&postTagV1{}).Error; err != nil {
+		return err
+	}
+
+	// Inclui os posts da lixeira, que ainda podem ser restaurados
+	var links []struct {
+		ID     uint
+		PostID int
+		TagID  int
+		BlogID int
+	}
+	if err := tx.Table("post_tags").
+		Select("post_tags.id, post_tags.post_id, post_tags.tag_id, posts.blog_id").
+		Joins("JOIN posts ON posts.id = post_tags.post_id").
+		Order("post_tags.id").
+		Scan(&links).Error; err != nil {
+		return err
+	}
+
+	type scopedKey struct {
+		blogID int
+		name   string
+	}
+	scoped := make(map[scopedKey]uint)
+	reused := make(map[uint]bool)
+	linked := make(map[[2]uint]bool)
+	for _, link := range links {
+		title, ok := titles[uint(link.TagID)]
+		if !ok {
+			continue
+		}
+		key := scopedKey{link.BlogID, models.NormalizeTagName(title)}
+		tagID, ok := scoped[key]
+		if !ok {
+			if !reused[uint(link.TagID)] {
+				tagID = uint(link.TagID)
+				reused[tagID] = true
+				if err := tx.Model(&tagV7{}).Where("id = ?", tagID).
+					Updates(map[string]any{"blog_id": key.blogID, "name": key.name}).Error; err != nil {
+					return err
+				}
+			} else {
+				tag := tagV7{BlogID: key.blogID, Title: title, Name: key.name}
+				if err := tx.Create(&tag).Error; err != nil {
+					return err
+				}
+				tagID = tag.ID
+			}
+			scoped[key] = tagID
+		}
+
+		pair := [2]uint{uint(link.PostID), tagID}
+		if linked[pair] {
+			if err := tx.Delete(&postTagV1{}, link.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		linked[pair] = true
+		if tagID != uint(link.TagID) {
+			if err := tx.Model(&postTagV1{}).Where("id = ?", link.ID).Update("tag_id", tagID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Nenhuma ligação pode sobrar apontando para as tags globais
+	if err := tx.Where("tag_id IN (SELECT id FROM tags WHERE blog_id = 0)").Delete(&postTagV1{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("blog_id = 0").Delete(&tagV7{}).Error; err != nil {
+		return err
+	}
+
+	// Só agora, com blog_id e name preenchidos, o índice único pode existir
+	if err := tx.Exec("CREATE UNIQUE INDEX idx_tags_blog_name ON tags (blog_id, name)").Error; err != nil {
+		return err
+	}
+	return tx.Exec("CREATE INDEX idx_tags_name ON tags (name)").Error
+}
+
+// RunMigrations aplica as migrações pendentes do banco principal
 func RunMigrations(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
-	err := db.AutoMigrate(
-		&models.User{},
-		&models.Blog{},
-		&models.Post{},
-		&models.Page{},
-		&models.Tag{},
-		&models.PostTag{},
-	)
-
+	migrator, err := NewMigrator(db, Migrations)
+	if err != nil {
+		log.Printf("Error running migrations: %v", err)
+		return err
+	}
+	count, err := migrator.Up()
 	if err != nil {
 		log.Printf("Error running migrations: %v", err)
 		return err
 	}
 
-	log.Println("Migrations completed successfully")
+	log.Printf("Migrations completed successfully (%d applied)", count)
 	return nil
 }
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"harmonista/database/dbtest"
+	"harmonista/models"
+)
+
+func TestMigratorUpDownStatus(t *testing.T) {
+	db := dbtest.Open(t)
+	type nota struct {
+		ID    uint
+		Texto string
+	}
+	migrations := []Migration{
+		{Version: 1, Name: "notas", Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&nota{})
+		}, Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&nota{})
+		}},
+		{Version: 2, Name: "falha", Up: func(tx *gorm.DB) error {
+			if err := tx.Create(&nota{Texto: "não deve ficar"}).Error; err != nil {
+				return err
+			}
+			return errors.New("falhou")
+		}},
+	}
+
+	migrator, err := NewMigrator(db, migrations)
+	assert.NoError(t, err)
+
+	// A segunda falha e sua transação é desfeita
+	count, err := migrator.Up()
+	assert.Error(t, err)
+	assert.Equal(t, 1, count)
+	assert.True(t, db.Migrator().HasTable(&nota{}))
+	var notas int64
+	db.Model(&nota{}).Count(&notas)
+	assert.Zero(t, notas)
+
+	status, err := migrator.Status()
+	assert.NoError(t, err)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+
+	// Sem nada pendente além da que falha, Down desfaz só a aplicada
+	count, err = migrator.Down(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.False(t, db.Migrator().HasTable(&nota{}))
+
+	_, err = NewMigrator(db, []Migration{migrations[1], migrations[0]})
+	assert.Error(t, err)
+}
+
+func TestUniqueSlugMigration(t *testing.T) {
+	db := dbtest.Open(t)
+	migrator, err := NewMigrator(db, Migrations[:2])
+	assert.NoError(t, err)
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.True(t, db.Migrator().HasIndex(&models.Tag{}, "idx_tags_title"))
+
+	posts := []models.Post{
+		{BlogID: 1, Title: "Olá", Slug: "ola"},
+		{BlogID: 1, Title: "Olá", Slug: "ola"},
+		{BlogID: 1, Title: "Olá 2", Slug: "ola-2"},
+		{BlogID: 1, Title: "Olá", Slug: "ola"},
+		{BlogID: 2, Title: "Olá", Slug: "ola"},
+	}
+	db.Create(&posts)
+
+	migrator, err = NewMigrator(db, Migrations[:4])
+	assert.NoError(t, err)
+	count, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	var slugs []string
+	db.Model(&models.Post{}).Order("id").Pluck("slug", &slugs)
+	assert.Equal(t, []string{"ola", "ola-3", "ola-2", "ola-4", "ola"}, slugs)
+	assert.Error(t, db.Create(&models.Post{BlogID: 2, Title: "Olá", Slug: "ola"}).Error)
+	assert.NoError(t, db.Create(&models.Page{BlogID: 2, Title: "Olá", Slug: "ola"}).Error)
+	assert.Error(t, db.Create(&models.Page{BlogID: 2, Title: "Olá", Slug: "ola"}).Error)
+
+	count, err = migrator.Down(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, db.Create(&models.Post{BlogID: 2, Title: "Olá", Slug: "ola"}).Error)
+}
+
+// schemaOf lista as colunas e os índices de cada tabela do banco
+func schemaOf(t *testing.T, db *gorm.DB) map[string][]string {
+	t.Helper()
+	tables, err := db.Migrator().GetTables()
+	assert.NoError(t, err)
+
+	schema := make(map[string][]string)
+	for _, table := range tables {
+		columns, err := db.Migrator().ColumnTypes(table)
+		assert.NoError(t, err)
+		for _, column := range columns {
+			schema[table] = append(schema[table], "column "+column.Name())
+		}
+		indexes, err := db.Migrator().GetIndexes(table)
+		assert.NoError(t, err)
+		for _, index := range indexes {
+			schema[table] = append(schema[table], "index "+index.Name())
+		}
+		sort.Strings(schema[table])
+	}
+	return schema
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	db := dbtest.Open(t)
+	migrator, err := NewMigrator(db, Migrations)
+	assert.NoError(t, err)
+
+	count, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, len(Migrations), count)
+	migrated := schemaOf(t, db)
+	assert.Contains(t, migrated["tags"], "index idx_tags_title")
+	assert.Contains(t, migrated["posts"], "index idx_posts_deleted_at")
+
+	count, err = migrator.Down(len(Migrations))
+	assert.NoError(t, err)
+	assert.Equal(t, len(Migrations), count)
+	for _, model := range append(schemaV1, &slugRedirectV5{}) {
+		assert.False(t, db.Migrator().HasTable(model))
+	}
+
+	count, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, len(Migrations), count)
+	assert.Equal(t, migrated, schemaOf(t, db))
+}
+
+func TestBlogScopedTagsMigration(t *testing.T) {
+	// Banco criado antes das migrações versionadas, com as tags globais
+	db := dbtest.Open(t)
+	assert.NoError(t, db.AutoMigrate(schemaV1...))
+
+	now := time.Now()
+	posts := []postV1{
+		{BlogID: 1, Title: "Um", Slug: "um"},
+		{BlogID: 1, Title: "Dois", Slug: "dois"},
+		{BlogID: 2, Title: "Três", Slug: "tres", DeletedAt: &now}, // na lixeira, ainda conta
+	}
+	assert.NoError(t, db.Create(&posts).Error)
+	for _, title := range []string{"Go", "go ", "Web", "sem uso"} {
+		assert.NoError(t, db.Create(&tagV1{Title: title}).Error)
+	}
+	links := []postTagV1{
+		{PostID: int(posts[0].ID), TagID: 1},
+		{PostID: int(posts[0].ID), TagID: 2},
+		{PostID: int(posts[1].ID), TagID: 2},
+		{PostID: int(posts[2].ID), TagID: 1},
+		{PostID: int(posts[1].ID), TagID: 3},
+		{PostID: 99, TagID: 1}, // post apagado de vez
+		{PostID: 99, TagID: 4},
+	}
+	assert.NoError(t, db.Create(&links).Error)
+
+	assert.NoError(t, RunMigrations(db))
+
+	var tags []models.Tag
+	db.Order("id").Find(&tags)
+	assert.Len(t, tags, 3)
+	assert.Equal(t, models.Tag{ID: 1, BlogID: 1, Title: "Go", Name: "go"}, tags[0])
+	assert.Equal(t, models.Tag{ID: 3, BlogID: 1, Title: "Web", Name: "web"}, tags[1])
+	assert.Equal(t, 2, tags[2].BlogID)
+	assert.Equal(t, "go", tags[2].Name)
+
+	var pairs []struct{ PostID, TagID uint }
+	db.Model(&models.PostTag{}).Select("post_id, tag_id").Order("post_id, tag_id").Scan(&pairs)
+	assert.Equal(t, []struct{ PostID, TagID uint }{
+		{posts[0].ID, 1}, {posts[1].ID, 1}, {posts[1].ID, 3}, {posts[2].ID, tags[2].ID},
+	}, pairs)
+	var dangling int64
+	db.Model(&models.PostTag{}).Where("tag_id NOT IN (SELECT id FROM tags)").Count(&dangling)
+	assert.Zero(t, dangling)
+
+	// O nome é único por blog
+	assert.Error(t, db.Create(&models.Tag{BlogID: 1, Title: "GO", Name: "go"}).Error)
+	assert.NoError(t, db.Create(&models.Tag{BlogID: 3, Title: "GO", Name: "go"}).Error)
+}
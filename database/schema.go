@@ -0,0 +1,145 @@
+package database
+
+import "time"
+
+// Tabelas como as migrações as deixaram, congeladas na versão em que cada
+// uma foi escrita. As migrações usam estas structs, e não as de models,
+// para que uma mudança nos models não altere o que uma migração já
+// aplicada faz; a mudança entra como migração nova.
+
+// Versão 1: o schema de antes das migrações versionadas. Os relacionamentos
+// ficam de fora porque o banco é aberto sem chaves estrangeiras.
+
+type userV1 struct {
+	ID                     int    `gorm:"primary_key;autoIncrement"`
+	PasswordHash           string `gorm:"not null"`
+	Email                  string `gorm:"unique;not null"`
+	EmailVerified          bool   `gorm:"default:false"`
+	EmailVerificationToken string
+	SessionToken           string
+}
+
+func (userV1) TableName() string { return "users" }
+
+type blogV1 struct {
+	ID                      int    `gorm:"primary_key;autoIncrement"`
+	UserID                  int    `gorm:"not null;index"`
+	Title                   string `gorm:"not null"`
+	Description             string `gorm:"type:text"`
+	Subdomain               string `gorm:"unique;not null;index"`
+	Nav                     string `gorm:"type:text"`
+	Theme                   string `gorm:"type:text"`
+	IsListReader            bool   `gorm:"default:false;index"`
+	IsAdult                 bool   `gorm:"default:false"`
+	MediaQuota              int64  `gorm:"default:0"`
+	MarkdownFootnotes       bool   `gorm:"default:false"`
+	MarkdownHeadingAnchors  bool   `gorm:"default:false"`
+	MarkdownDefinitionLists bool   `gorm:"default:false"`
+	MarkdownTypographer     bool   `gorm:"default:false"`
+	MarkdownTOC             bool   `gorm:"default:false"`
+	ReadingStats            bool   `gorm:"default:false"`
+	PublicStats             bool   `gorm:"default:false"`
+}
+
+func (blogV1) TableName() string { return "blogs" }
+
+// postV1 e pageV1 tinham DeletedAt com a tag sql:"index", que o gorm
+// ignora: a coluna existe, o índice não (veja a versão 6)
+type postV1 struct {
+	ID          uint `gorm:"primary_key"`
+	BlogID      int  `gorm:"not null;index"`
+	ReplyPostID *int `gorm:"index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time
+	Title       string `gorm:"not null"`
+	Slug        string `gorm:"not null;index"`
+	Content     string `gorm:"type:text"`
+	Draft       bool
+}
+
+func (postV1) TableName() string { return "posts" }
+
+type pageV1 struct {
+	ID        uint `gorm:"primary_key"`
+	BlogID    int  `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	Title     string `gorm:"not null"`
+	Slug      string `gorm:"not null;index"`
+	Content   string `gorm:"type:text"`
+	Draft     bool
+}
+
+func (pageV1) TableName() string { return "pages" }
+
+// tagV1 não tem o índice em Title, perdido na tag mal formada (veja a
+// versão 2)
+type tagV1 struct {
+	ID    uint   `gorm:"primary_key"`
+	Title string `gorm:"not null"`
+}
+
+func (tagV1) TableName() string { return "tags" }
+
+type postTagV1 struct {
+	ID     uint `gorm:"primary_key"`
+	PostID int  `gorm:"not null;index"`
+	TagID  int  `gorm:"not null;index"`
+}
+
+func (postTagV1) TableName() string { return "post_tags" }
+
+type mediaV1 struct {
+	ID          uint   `gorm:"primary_key"`
+	BlogID      int    `gorm:"not null;index"`
+	Key         string `gorm:"not null;uniqueIndex"`
+	URL         string `gorm:"not null;index"`
+	Filename    string
+	ContentType string
+	Width       int
+	Height      int
+	Size        int64
+	Variants    string `gorm:"type:text"`
+	CreatedAt   time.Time
+}
+
+func (mediaV1) TableName() string { return "media" }
+
+// schemaV1 são as tabelas da versão 1, na ordem de criação
+var schemaV1 = []any{
+	&userV1{},
+	&blogV1{},
+	&postV1{},
+	&pageV1{},
+	&tagV1{},
+	&postTagV1{},
+	&mediaV1{},
+}
+
+// Versão 5
+
+type slugRedirectV5 struct {
+	ID        uint   `gorm:"primary_key"`
+	BlogID    int    `gorm:"not null;uniqueIndex:idx_slug_redirects_slug"`
+	Kind      string `gorm:"not null;uniqueIndex:idx_slug_redirects_slug"`
+	Slug      string `gorm:"not null;uniqueIndex:idx_slug_redirects_slug"`
+	TargetID  uint   `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (slugRedirectV5) TableName() string { return "slug_redirects" }
+
+// Versão 7: as colunas novas de tags. Os índices são criados à parte, só
+// depois de preenchidas.
+
+type tagV7 struct {
+	ID          uint   `gorm:"primary_key"`
+	BlogID      int    `gorm:"not null;default:0"`
+	Title       string `gorm:"not null"`
+	Name        string `gorm:"not null;default:''"`
+	Description string `gorm:"type:text"`
+}
+
+func (tagV7) TableName() string { return "tags" }
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 
 	"harmonista/admin"
 	"harmonista/analytics"
@@ -21,6 +24,7 @@ import (
 	"harmonista/cache"
 	"harmonista/common"
 	"harmonista/database"
+	"harmonista/media"
 	"harmonista/site"
 )
 
@@ -35,6 +39,21 @@ func main() {
 		log.Fatal("Failed to connect to database")
 	}
 
+	// harmonista migrate [analytics] up|down [n]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateDb, migrations, args := db, database.Migrations, os.Args[2:]
+		if len(args) > 0 && args[0] == "analytics" {
+			migrateDb, migrations, args = common.ConnectAnalyticsDb(), analytics.Migrations, args[1:]
+			if migrateDb == nil {
+				log.Fatal("Failed to connect to analytics database")
+			}
+		}
+		if err := runMigrate(migrateDb, migrations, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
@@ -76,8 +95,13 @@ func main() {
 	router.Use(common.SubdomainMiddleware())
 
 	// Add cache middleware for blog posts (24 hour cache)
+	cache.SetStore(cache.NewStoreFromEnv())
+	router.Use(cache.ControlMiddleware())
 	router.Use(cache.CacheMiddleware(24 * time.Hour))
 
+	// Arquivos de /public com ETag, gzip/brotli e URLs com fingerprint
+	assets := cache.NewAssets("/public", "./public")
+
 	router.SetFuncMap(map[string]interface{}{
 		"now": func() time.Time {
 			return time.Now()
@@ -89,25 +113,43 @@ func main() {
 			}
 			return d
 		},
+		"asset": assets.URL,
 	})
 
 	router.LoadHTMLGlob("*/views/*.html")
 
-	router.Static("/public", "./public")
+	assets.RegisterRoutes(router)
+
+	// Biblioteca de mídia (uploads de imagens dos blogs)
+	mediaStorage := media.NewStorageFromEnv()
+	if local, ok := mediaStorage.(*media.LocalStorage); ok {
+		local.RegisterRoutes(router)
+	}
 
 	siteModule := site.NewSiteModule(db, analyticsModule)
 	siteModule.RegisterRoutes(router)
 
-	adminModule := admin.NewAdminModule(db, analyticsModule)
+	adminModule := admin.NewAdminModule(db, analyticsModule, mediaStorage)
 	adminModule.RegisterRoutes(router)
+	adminModule.StartTrashPurger()
 
-	backofficeModule := backoffice.NewBackofficeModule(db)
+	backofficeModule := backoffice.NewBackofficeModule(db, analyticsModule)
 	backofficeModule.RegisterRoutes(router)
 
 	blogModule := blog.NewBlogModule(db, analyticsModule)
 	blogModule.RegisterRoutes(router)
 
+	// Revalidação em segundo plano e aquecimento do cache renderizam
+	// páginas pelo próprio roteador
+	cache.SetRenderer(router)
+	blogModule.StartCacheWarmer()
+
+	// Canal para capturar sinais de interrupção
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
 	// Configurar servidores HTTP e HTTPS
+	var servers []*http.Server
 	if useHTTPS {
 		// Servidor HTTP na porta 80 para redirecionamento
 		httpRedirect := &http.Server{
@@ -124,6 +166,7 @@ func main() {
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
 		}
+		servers = append(servers, httpRedirect, httpsServer)
 
 		// Iniciar servidor HTTP em goroutine
 		go func() {
@@ -133,10 +176,6 @@ func main() {
 			}
 		}()
 
-		// Canal para capturar sinais de interrupção
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
 		// Iniciar servidor HTTPS em goroutine
 		go func() {
 			log.Println("Starting HTTPS server on port 443...")
@@ -144,23 +183,6 @@ func main() {
 				log.Fatal("Failed to start HTTPS server:", err)
 			}
 		}()
-
-		// Aguardar sinal de interrupção
-		<-quit
-		log.Println("Shutting down servers...")
-
-		// Graceful shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := httpRedirect.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
-		}
-		if err := httpsServer.Shutdown(ctx); err != nil {
-			log.Printf("HTTPS server shutdown error: %v", err)
-		}
-
-		log.Println("Servers stopped")
 	} else {
 		// Modo HTTP apenas (desenvolvimento)
 		port := os.Getenv("PORT")
@@ -168,11 +190,41 @@ func main() {
 			port = "80"
 		}
 
-		log.Printf("Starting HTTP server on port %s (development mode)...", port)
-		if err := router.Run(":" + port); err != nil {
-			log.Fatal("Failed to start server:", err)
+		httpServer := &http.Server{
+			Addr:    ":" + port,
+			Handler: router,
+		}
+		servers = append(servers, httpServer)
+
+		go func() {
+			log.Printf("Starting HTTP server on port %s (development mode)...", port)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Failed to start server:", err)
+			}
+		}()
+	}
+
+	// Aguardar sinal de interrupção
+	<-quit
+	log.Println("Shutting down servers...")
+
+	// Graceful shutdown; os streams ao vivo não terminam sozinhos
+	analyticsModule.StopLive()
+	blogModule.Close()
+	adminModule.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server %s shutdown error: %v", server.Addr, err)
 		}
 	}
+
+	// Gravar os eventos de analytics que ainda estão na fila
+	analyticsModule.Close()
+
+	log.Println("Servers stopped")
 }
 
 // createHTTPRedirectHandler cria um handler que redireciona HTTP para HTTPS
@@ -186,3 +238,46 @@ func createHTTPRedirectHandler() http.Handler {
 		http.Redirect(w, r, target, http.StatusMovedPermanently)
 	})
 }
+
+func runMigrate(db *gorm.DB, migrations []database.Migration, args []string) error {
+	migrator, err := database.NewMigrator(db, migrations)
+	if err != nil {
+		return err
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		count, err := migrator.Up()
+		fmt.Printf("%d migrations applied\n", count)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %q", args[1])
+			}
+		}
+		count, err := migrator.Down(steps)
+		fmt.Printf("%d migrations reverted\n", count)
+		return err
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-24s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("usage: harmonista migrate [analytics] up|down [n]|status")
+	}
+}
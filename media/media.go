@@ -0,0 +1,149 @@
+package media
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"harmonista/models"
+)
+
+// Variant descreve uma versão redimensionada de uma mídia
+type Variant struct {
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// DefaultQuota retorna a cota padrão por blog, em bytes (MEDIA_QUOTA_MB, padrão 100MB)
+func DefaultQuota() int64 {
+	mb, err := strconv.ParseInt(os.Getenv("MEDIA_QUOTA_MB"), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = 100
+	}
+	return mb << 20
+}
+
+// MaxUploadSize retorna o tamanho máximo de um upload, em bytes (MEDIA_MAX_UPLOAD_MB, padrão 10MB)
+func MaxUploadSize() int64 {
+	mb, err := strconv.ParseInt(os.Getenv("MEDIA_MAX_UPLOAD_MB"), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = 10
+	}
+	return mb << 20
+}
+
+// QuotaFor retorna a cota do blog, usando a padrão quando não houver uma específica
+func QuotaFor(blog *models.Blog) int64 {
+	if blog.MediaQuota > 0 {
+		return blog.MediaQuota
+	}
+	return DefaultQuota()
+}
+
+// ParseVariants decodifica as variantes guardadas em Media.Variants
+func ParseVariants(m *models.Media) []Variant {
+	if m.Variants == "" {
+		return nil
+	}
+	var variants []Variant
+	if err := json.Unmarshal([]byte(m.Variants), &variants); err != nil {
+		return nil
+	}
+	return variants
+}
+
+// Save envia o resultado processado ao storage e monta o registro de Media
+// (ainda não salvo no banco). Em caso de erro, remove o que já foi enviado.
+func Save(storage Storage, blogID int, filename string, result *Result) (*models.Media, error) {
+	prefix, err := newPrefix(blogID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []string
+	put := func(f File) (string, error) {
+		key := prefix + f.Name
+		if err := storage.Put(key, bytes.NewReader(f.Data), f.ContentType); err != nil {
+			return "", err
+		}
+		stored = append(stored, key)
+		return key, nil
+	}
+	rollback := func() {
+		for _, key := range stored {
+			storage.Delete(key)
+		}
+	}
+
+	originalKey, err := put(result.Original)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+
+	size := int64(len(result.Original.Data))
+	variants := make([]Variant, 0, len(result.Variants))
+	for _, f := range result.Variants {
+		key, err := put(f)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		variants = append(variants, Variant{
+			Key:         key,
+			URL:         storage.URL(key),
+			Width:       f.Width,
+			Height:      f.Height,
+			ContentType: f.ContentType,
+			Size:        int64(len(f.Data)),
+		})
+		size += int64(len(f.Data))
+	}
+
+	variantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+
+	return &models.Media{
+		BlogID:      blogID,
+		Key:         originalKey,
+		URL:         storage.URL(originalKey),
+		Filename:    filename,
+		ContentType: result.Original.ContentType,
+		Width:       result.Original.Width,
+		Height:      result.Original.Height,
+		Size:        size,
+		Variants:    string(variantsJSON),
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// Remove apaga do storage o original e todas as variantes de uma mídia
+func Remove(storage Storage, m *models.Media) error {
+	for _, v := range ParseVariants(m) {
+		if err := storage.Delete(v.Key); err != nil {
+			return err
+		}
+	}
+	return storage.Delete(m.Key)
+}
+
+// newPrefix gera um diretório aleatório por upload, agrupado por blog.
+// Usamos o ID do blog porque o subdomínio pode mudar.
+func newPrefix(blogID int) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(blogID) + "/" + hex.EncodeToString(b) + "/", nil
+}
@@ -0,0 +1,317 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registra o decoder de WebP em image.Decode
+)
+
+var (
+	ErrInvalidKey        = errors.New("chave de mídia inválida")
+	ErrUnsupportedFormat = errors.New("formato de imagem não suportado")
+	ErrImageTooLarge     = errors.New("imagem grande demais")
+)
+
+// VariantWidths são as larguras geradas para cada imagem (apenas as menores que o original)
+var VariantWidths = []int{480, 960, 1600}
+
+const (
+	// MaxDimension limita o maior lado da imagem original guardada
+	MaxDimension = 2560
+	// maxPixels protege contra imagens que explodem ao serem decodificadas
+	maxPixels   = 50_000_000
+	jpegQuality = 85
+)
+
+// File é um arquivo gerado a partir do upload, pronto para ir ao storage
+type File struct {
+	Name        string // ex: "original.jpg", "w480.webp"
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Result contém o original reprocessado (sem metadados) e suas variantes
+type Result struct {
+	Original File
+	Variants []File
+}
+
+// Process decodifica a imagem, descarta EXIF/GPS e demais metadados
+// (reencodando apenas os pixels), corrige a orientação e gera as variantes.
+func Process(data []byte) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	// GIFs podem ser animados: reencodar todos os quadros já remove
+	// comentários e extensões, e não geramos variantes para eles
+	if format == "gif" {
+		// Cada quadro é decodificado inteiro: o limite vale para a soma
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, ErrUnsupportedFormat
+		}
+		if frames*cfg.Width*cfg.Height > maxPixels {
+			return nil, ErrImageTooLarge
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupportedFormat
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, err
+		}
+		return &Result{Original: File{
+			Name:        "original.gif",
+			ContentType: "image/gif",
+			Width:       g.Config.Width,
+			Height:      g.Config.Height,
+			Data:        buf.Bytes(),
+		}}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	img = fit(img, MaxDimension)
+
+	// PNG e imagens com transparência continuam em PNG, o resto vira JPEG
+	ext, contentType := ".jpg", "image/jpeg"
+	if format == "png" || !isOpaque(img) {
+		ext, contentType = ".png", "image/png"
+	}
+
+	original, err := encode(img, "original"+ext, contentType)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Original: original}
+
+	bounds := img.Bounds()
+	for _, width := range VariantWidths {
+		if width >= bounds.Dx() {
+			continue
+		}
+		resized := scaleToWidth(img, width)
+
+		variant, err := encode(resized, variantName(width, ext), contentType)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, variant)
+
+		if webp, ok := encodeWebP(resized, variantName(width, ".webp")); ok {
+			result.Variants = append(result.Variants, webp)
+		}
+	}
+
+	if webp, ok := encodeWebP(img, "original.webp"); ok {
+		result.Variants = append(result.Variants, webp)
+	}
+
+	return result, nil
+}
+
+// gifFrameCount conta os quadros do GIF percorrendo só a estrutura de
+// blocos, sem descomprimir os pixels
+func gifFrameCount(data []byte) (int, error) {
+	errTruncated := errors.New("gif truncado")
+	if len(data) < 13 {
+		return 0, errTruncated
+	}
+	pos := 13 // cabeçalho e descritor da tela
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1) // tabela de cores global
+	}
+
+	// skipSubBlocks pula uma sequência de sub-blocos terminada em zero
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncated
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for {
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		switch data[pos] {
+		case 0x21: // extensão: rótulo e sub-blocos
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // quadro: descritor, tabela local, LZW e sub-blocos
+			if pos+10 > len(data) {
+				return 0, errTruncated
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // tamanho mínimo do código LZW
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // fim
+			return frames, nil
+		default:
+			return 0, ErrUnsupportedFormat
+		}
+	}
+}
+
+func variantName(width int, ext string) string {
+	return "w" + strconv.Itoa(width) + ext
+}
+
+// fit reduz a imagem para que o maior lado não passe de max, mantendo a proporção
+func fit(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+
+	if w >= h {
+		return scale(img, max, h*max/w)
+	}
+	return scale(img, w*max/h, max)
+}
+
+// scaleToWidth redimensiona a imagem para a largura informada, mantendo a proporção
+func scaleToWidth(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	return scale(img, width, b.Dy()*width/b.Dx())
+}
+
+func scale(img image.Image, w, h int) image.Image {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return true
+}
+
+func encode(img image.Image, name, contentType string) (File, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		// JPEG não tem canal alfa: compor sobre fundo branco
+		if !isOpaque(img) {
+			flat := image.NewRGBA(img.Bounds())
+			draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+			img = flat
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return File{}, err
+	}
+
+	b := img.Bounds()
+	return File{
+		Name:        name,
+		ContentType: contentType,
+		Width:       b.Dx(),
+		Height:      b.Dy(),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// cwebpPath aponta para o binário cwebp (libwebp), se instalado.
+// Sem ele as variantes WebP simplesmente não são geradas.
+var cwebpPath, _ = exec.LookPath("cwebp")
+
+func encodeWebP(img image.Image, name string) (File, bool) {
+	if cwebpPath == "" {
+		return File{}, false
+	}
+
+	dir, err := os.MkdirTemp("", "harmonista-webp")
+	if err != nil {
+		return File{}, false
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out.webp")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return File{}, false
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0600); err != nil {
+		return File{}, false
+	}
+
+	if err := exec.Command(cwebpPath, "-quiet", "-metadata", "none", "-q", "80", in, "-o", out).Run(); err != nil {
+		return File{}, false
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return File{}, false
+	}
+
+	b := img.Bounds()
+	return File{
+		Name:        name,
+		ContentType: "image/webp",
+		Width:       b.Dx(),
+		Height:      b.Dy(),
+		Data:        data,
+	}, true
+}
@@ -0,0 +1,136 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withExif insere logo depois do SOI um segmento APP1 com a orientação e
+// um texto que faz as vezes de coordenadas GPS
+func withExif(jpg []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	binary.Write(&tiff, binary.LittleEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.LittleEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, orientation)
+	binary.Write(&tiff, binary.LittleEndian, uint16(0))
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString("GPS -23.5505,-46.6333")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess_StripsExifAndRotates(t *testing.T) {
+	data := withExif(encodeJPEG(t, solid(40, 20, color.RGBA{200, 10, 10, 255})), 6)
+	assert.Equal(t, 6, jpegOrientation(data))
+
+	result, err := Process(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", result.Original.ContentType)
+	// Girada 90°: largura e altura trocam
+	assert.Equal(t, 20, result.Original.Width)
+	assert.Equal(t, 40, result.Original.Height)
+
+	assert.NotContains(t, string(result.Original.Data), "Exif")
+	assert.NotContains(t, string(result.Original.Data), "GPS")
+	assert.Equal(t, 1, jpegOrientation(result.Original.Data))
+	assert.Empty(t, result.Variants, "menor que a menor variante")
+}
+
+func TestProcess_ResizesAndKeepsTransparency(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, solid(3000, 300, color.NRGBA{0, 0, 255, 128}))
+
+	result, err := Process(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", result.Original.ContentType)
+	assert.Equal(t, MaxDimension, result.Original.Width)
+	assert.Equal(t, 256, result.Original.Height)
+
+	var widths []int
+	for _, v := range result.Variants {
+		if v.ContentType == "image/png" {
+			widths = append(widths, v.Width)
+		}
+	}
+	assert.Equal(t, VariantWidths, widths)
+}
+
+func TestProcess_Rejects(t *testing.T) {
+	_, err := Process([]byte("não é imagem"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	// O cabeçalho do GIF diz 10000x10000: recusado antes de decodificar
+	var buf bytes.Buffer
+	gif.Encode(&buf, solid(2, 2, color.Black), nil)
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:8], 10000)
+	binary.LittleEndian.PutUint16(data[8:10], 10000)
+	_, err = Process(data)
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestProcess_RejectsManyFrameGIF(t *testing.T) {
+	// Poucos bytes, mas 201 quadros de 500x500 passam de maxPixels
+	frame := image.NewPaletted(image.Rect(0, 0, 500, 500), color.Palette{color.Black, color.White})
+	anim := &gif.GIF{}
+	for i := 0; i < 201; i++ {
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 0)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := gifFrameCount(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, 201, frames)
+	_, err = Process(buf.Bytes())
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	// Com poucos quadros o GIF animado passa
+	anim.Image, anim.Delay = anim.Image[:3], anim.Delay[:3]
+	buf.Reset()
+	gif.EncodeAll(&buf, anim)
+	result, err := Process(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "original.gif", result.Original.Name)
+}
@@ -0,0 +1,102 @@
+package media
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Storage é o backend onde os arquivos de mídia são guardados.
+// As chaves usam "/" como separador, independente do backend.
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// LocalStorage guarda os arquivos em disco e os serve pelo próprio servidor
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocalStorage cria um storage em disco servido em baseURL
+func NewLocalStorage(dir, baseURL string) *LocalStorage {
+	return &LocalStorage{
+		Dir:     dir,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// NewStorageFromEnv cria o storage configurado por variáveis de ambiente.
+// Por enquanto só existe o backend local (MEDIA_DIR, padrão "uploads").
+func NewStorageFromEnv() Storage {
+	dir := os.Getenv("MEDIA_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creating media directory %s: %v", dir, err)
+	}
+
+	return NewLocalStorage(dir, "/uploads")
+}
+
+func (s *LocalStorage) Put(key string, r io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// RegisterRoutes serve os arquivos guardados em disco
+func (s *LocalStorage) RegisterRoutes(router *gin.Engine) {
+	router.Static(s.BaseURL, s.Dir)
+}
+
+// path converte a chave em caminho no disco sem permitir sair de Dir
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(key))
+	if clean == string(filepath.Separator) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
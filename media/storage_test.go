@@ -0,0 +1,111 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"harmonista/models"
+)
+
+func TestLocalStorage_PathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	storage := NewLocalStorage(dir, "/uploads/")
+
+	for _, key := range []string{"../fora.txt", "1/../../fora.txt", "/../../fora.txt", "1/./../../../fora.txt"} {
+		assert.NoError(t, storage.Put(key, strings.NewReader("x"), "text/plain"), key)
+		_, err := os.Stat(filepath.Join(root, "fora.txt"))
+		assert.True(t, os.IsNotExist(err), "%s escapou do diretório", key)
+	}
+	// Chaves que tentam sair ficam presas dentro de Dir
+	_, err := os.Stat(filepath.Join(dir, "fora.txt"))
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "/", "..", "../.."} {
+		assert.ErrorIs(t, storage.Put(key, strings.NewReader("x"), "text/plain"), ErrInvalidKey, key)
+		assert.ErrorIs(t, storage.Delete(key), ErrInvalidKey, key)
+	}
+
+	assert.NoError(t, storage.Put("1/abc/original.jpg", strings.NewReader("jpg"), "image/jpeg"))
+	data, err := os.ReadFile(filepath.Join(dir, "1", "abc", "original.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpg", string(data))
+	assert.Equal(t, "/uploads/1/abc/original.jpg", storage.URL("1/abc/original.jpg"))
+
+	assert.NoError(t, storage.Delete("1/abc/original.jpg"))
+	assert.NoError(t, storage.Delete("1/abc/original.jpg"), "apagar de novo não é erro")
+}
+
+// failingStorage falha a partir do Put de número failAt
+type failingStorage struct {
+	*LocalStorage
+	puts   int
+	failAt int
+}
+
+func (s *failingStorage) Put(key string, r io.Reader, contentType string) error {
+	s.puts++
+	if s.puts >= s.failAt {
+		return errors.New("disco cheio")
+	}
+	return s.LocalStorage.Put(key, r, contentType)
+}
+
+func testResult() *Result {
+	return &Result{
+		Original: File{Name: "original.jpg", ContentType: "image/jpeg", Width: 1000, Height: 500, Data: make([]byte, 100)},
+		Variants: []File{
+			{Name: "w480.jpg", ContentType: "image/jpeg", Width: 480, Height: 240, Data: make([]byte, 30)},
+			{Name: "w960.jpg", ContentType: "image/jpeg", Width: 960, Height: 480, Data: make([]byte, 60)},
+		},
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	count := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir, "/uploads")
+
+	item, err := Save(storage, 7, "foto.jpg", testResult())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, item.BlogID)
+	assert.True(t, strings.HasPrefix(item.Key, "7/"))
+	assert.Equal(t, "/uploads/"+item.Key, item.URL)
+	assert.Equal(t, int64(190), item.Size)
+	assert.Len(t, ParseVariants(item), 2)
+	assert.Equal(t, 3, countFiles(t, dir))
+
+	assert.NoError(t, Remove(storage, item))
+	assert.Zero(t, countFiles(t, dir))
+
+	// Falha no meio: o que já foi enviado é apagado
+	_, err = Save(&failingStorage{LocalStorage: storage, failAt: 3}, 7, "foto.jpg", testResult())
+	assert.Error(t, err)
+	assert.Zero(t, countFiles(t, dir))
+}
+
+func TestQuotaFor(t *testing.T) {
+	t.Setenv("MEDIA_QUOTA_MB", "")
+	assert.Equal(t, int64(100<<20), QuotaFor(&models.Blog{}))
+	t.Setenv("MEDIA_QUOTA_MB", "5")
+	assert.Equal(t, int64(5<<20), QuotaFor(&models.Blog{}))
+	assert.Equal(t, int64(1234), QuotaFor(&models.Blog{MediaQuota: 1234}))
+	t.Setenv("MEDIA_QUOTA_MB", "-1")
+	assert.Equal(t, int64(100<<20), DefaultQuota())
+}
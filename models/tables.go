@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	ID                     int    `gorm:"primary_key;autoIncrement" json:"id"`
@@ -22,37 +27,77 @@ type Blog struct {
 	Theme        string `gorm:"type:text" json:"theme"`                    // Optional - large CSS text
 	IsListReader bool   `gorm:"default:false;index" json:"is_list_reader"` // always false until the user opts in
 	IsAdult      bool   `gorm:"default:false" json:"is_adult"`             // always false until the user opts in
+	MediaQuota   int64  `gorm:"default:0" json:"media_quota"`              // bytes; 0 uses the MEDIA_QUOTA_MB default
+
+	// Recursos opcionais de Markdown, desligados até o usuário ativar
+	MarkdownFootnotes       bool `gorm:"default:false" json:"markdown_footnotes"`
+	MarkdownHeadingAnchors  bool `gorm:"default:false" json:"markdown_heading_anchors"` // ids nos títulos com link permanente
+	MarkdownDefinitionLists bool `gorm:"default:false" json:"markdown_definition_lists"`
+	MarkdownTypographer     bool `gorm:"default:false" json:"markdown_typographer"` // tipografia do português (blog/typography.go)
+	MarkdownTOC             bool `gorm:"default:false" json:"markdown_toc"`         // expande [[toc]] em sumário
+
+	// Beacon que mede profundidade e tempo de leitura dos posts (opt-in)
+	ReadingStats bool `gorm:"default:false" json:"reading_stats"`
+	PublicStats  bool `gorm:"default:false" json:"public_stats"` // publica /@/:subdomain/stats
 }
 
 type Post struct {
-	ID          uint       `gorm:"primary_key"`
-	BlogID      int        `gorm:"not null;index" json:"blog_id"`
-	Blog        Blog       `gorm:"foreignKey:BlogID" json:"blog"`        // relação com Blog
-	ReplyPostID *int       `gorm:"index" json:"reply_post_id,omitempty"` // ID do post pai (quando for uma resposta)
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `sql:"index" json:"deleted_at,omitempty"`
-	Title       string     `gorm:"not null" json:"title"`
-	Slug        string     `gorm:"not null;index" json:"slug"`
-	Content     string     `gorm:"type:text" json:"content"`
-	Draft       bool       `json:"draft"`
+	ID          uint           `gorm:"primary_key"`
+	BlogID      int            `gorm:"not null;index" json:"blog_id"`
+	Blog        Blog           `gorm:"foreignKey:BlogID" json:"blog"`        // relação com Blog
+	ReplyPostID *int           `gorm:"index" json:"reply_post_id,omitempty"` // ID do post pai (quando for uma resposta)
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"` // na lixeira quando preenchido
+	Title       string         `gorm:"not null" json:"title"`
+	Slug        string         `gorm:"not null;index" json:"slug"` // único por blog (idx_posts_blog_slug)
+	Content     string         `gorm:"type:text" json:"content"`
+	Draft       bool           `json:"draft"`
 }
 
 type Page struct {
-	ID        uint       `gorm:"primary_key"`
-	BlogID    int        `gorm:"not null;index" json:"blog_id"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
-	Title     string     `gorm:"not null" json:"title"`
-	Slug      string     `gorm:"not null;index" json:"slug"`
-	Content   string     `gorm:"type:text" json:"content"`
-	Draft     bool       `json:"draft"`
+	ID        uint           `gorm:"primary_key"`
+	BlogID    int            `gorm:"not null;index" json:"blog_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"` // na lixeira quando preenchido
+	Title     string         `gorm:"not null" json:"title"`
+	Slug      string         `gorm:"not null;index" json:"slug"` // único por blog (idx_pages_blog_slug)
+	Content   string         `gorm:"type:text" json:"content"`
+	Draft     bool           `json:"draft"`
+}
+
+// Tipos de conteúdo com slug, usados em SlugRedirect
+const (
+	SlugKindPost = "post"
+	SlugKindPage = "page"
+)
+
+// SlugRedirect guarda um slug antigo de post ou página. Aponta para o ID,
+// então várias trocas seguidas levam sempre ao slug atual.
+type SlugRedirect struct {
+	ID        uint      `gorm:"primary_key"`
+	BlogID    int       `gorm:"not null;uniqueIndex:idx_slug_redirects_slug" json:"blog_id"`
+	Kind      string    `gorm:"not null;uniqueIndex:idx_slug_redirects_slug" json:"kind"` // SlugKindPost ou SlugKindPage
+	Slug      string    `gorm:"not null;uniqueIndex:idx_slug_redirects_slug" json:"slug"`
+	TargetID  uint      `gorm:"not null;index" json:"target_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
+// Tag pertence a um blog. Name é o Title normalizado (NormalizeTagName):
+// é por ele que as tags são comparadas, no blog e no /leia.
 type Tag struct {
-	ID    uint   `gorm:"primary_key"`
-	Title string `gorm:"not null;index json:"title"`
+	ID          uint   `gorm:"primary_key"`
+	BlogID      int    `gorm:"not null" json:"blog_id"`
+	Title       string `gorm:"not null;index" json:"title"`
+	Name        string `gorm:"not null;index" json:"name"`   // único por blog (idx_tags_blog_name)
+	Description string `gorm:"type:text" json:"description"` // Markdown, mostrado na página da tag
+}
+
+// NormalizeTagName deixa o nome da tag em minúsculas, sem espaços nas
+// bordas e com um só espaço entre as palavras
+func NormalizeTagName(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
 }
 
 type PostTag struct {
@@ -60,3 +105,17 @@ type PostTag struct {
 	PostID int  `gorm:"not null;index" json:"post_id"`
 	TagID  int  `gorm:"not null;index" json:"tag_id"`
 }
+
+type Media struct {
+	ID          uint      `gorm:"primary_key"`
+	BlogID      int       `gorm:"not null;index" json:"blog_id"`
+	Key         string    `gorm:"not null;uniqueIndex" json:"key"` // storage key of the original file
+	URL         string    `gorm:"not null;index" json:"url"`       // public URL of the original, used in Markdown
+	Filename    string    `json:"filename"`                        // name of the uploaded file
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int64     `json:"size"`                      // bytes of the original plus all variants (counts towards the quota)
+	Variants    string    `gorm:"type:text" json:"variants"` // JSON list of resized variants
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -5,6 +5,7 @@
  * - Salvamento automático (apenas rascunhos)
  * - Indicador visual de alterações
  * - Toolbar customizável
+ * - Upload de imagens (colar, arrastar ou botão da toolbar)
  */
 
 class EasyMDEManager {
@@ -14,6 +15,7 @@ class EasyMDEManager {
         this.isDraftField = options.isDraftField || 'draft';
         this.autoSaveUrl = options.autoSaveUrl || null;
         this.autoSaveInterval = options.autoSaveInterval || 30000; // 30 segundos
+        this.uploadUrl = options.uploadUrl || null;
 
         this.editor = null;
         this.autoSaveTimer = null;
@@ -61,12 +63,20 @@ class EasyMDEManager {
                 'quote',
                 'unordered-list',
                 'ordered-list',
+                ...(this.uploadUrl ? ['upload-image'] : []),
                 'preview',
                 'fullscreen',
                 '|',
                 'guide'
             ],
 
+            // Upload de imagens: colar e arrastar também usam esta função
+            uploadImage: !!this.uploadUrl,
+            imageAccept: 'image/jpeg, image/png, image/gif, image/webp',
+            imageUploadFunction: (file, onSuccess, onError) => {
+                this.uploadImage(file).then(onSuccess).catch(err => onError(err.message));
+            },
+
             // Atalhos de teclado
             shortcuts: {
                 toggleFullScreen: 'F11',
@@ -89,6 +99,30 @@ class EasyMDEManager {
         });
     }
 
+    // Envia a imagem para a biblioteca de mídia e devolve a URL para o EasyMDE
+    // inserir o link Markdown no editor
+    async uploadImage(file) {
+        const data = new FormData();
+        data.append('file', file);
+
+        this.showStatus('Enviando imagem...', '#ffc107');
+
+        const response = await fetch(this.uploadUrl, {
+            method: 'POST',
+            body: data
+        });
+        const body = await response.json().catch(() => ({}));
+
+        if (!response.ok) {
+            const message = body.error || 'Erro ao enviar imagem';
+            this.showStatus(message, '#dc3545');
+            throw new Error(message);
+        }
+
+        this.showStatus('Imagem enviada', '#28a745');
+        return body.url;
+    }
+
     createStatusIndicator() {
         const editorToolbar = document.querySelector('.EasyMDEContainer .editor-toolbar');
         if (!editorToolbar) return;
@@ -0,0 +1,71 @@
+// Beacon de leitura do Harmonista: mede até onde o post foi lido e por
+// quanto tempo a página ficou visível, e envia um único aviso ao sair.
+// Sem cookies, sem identificadores e sem serviços de terceiros.
+(function () {
+    var script = document.currentScript;
+    var article = document.querySelector('.blog-post');
+    if (!script || !article || !navigator.sendBeacon) {
+        return;
+    }
+
+    var endpoint = script.dataset.endpoint;
+    var postID = parseInt(script.dataset.post, 10);
+    var depth = 0;
+    var visibleMs = 0;
+    var shownAt = document.visibilityState === 'visible' ? Date.now() : null;
+    var sent = false;
+    var ticking = false;
+
+    // Faixas de 25% do post que já passaram pela tela
+    function measure() {
+        ticking = false;
+        var rect = article.getBoundingClientRect();
+        var read = (window.innerHeight - rect.top) / Math.max(rect.height, 1);
+        var bucket = read >= 0.95 ? 100 : read >= 0.75 ? 75 : read >= 0.5 ? 50 : read >= 0.25 ? 25 : 0;
+        if (bucket > depth) {
+            depth = bucket;
+        }
+    }
+
+    function send() {
+        if (sent) {
+            return;
+        }
+        sent = true;
+        var payload = JSON.stringify({
+            post: postID,
+            depth: depth,
+            seconds: Math.round(visibleMs / 1000)
+        });
+        navigator.sendBeacon(endpoint, new Blob([payload], { type: 'text/plain' }));
+    }
+
+    window.addEventListener('scroll', function () {
+        if (!ticking) {
+            ticking = true;
+            window.requestAnimationFrame(measure);
+        }
+    }, { passive: true });
+
+    document.addEventListener('visibilitychange', function () {
+        if (document.visibilityState === 'hidden') {
+            if (shownAt !== null) {
+                visibleMs += Date.now() - shownAt;
+                shownAt = null;
+            }
+            send();
+        } else {
+            shownAt = Date.now();
+        }
+    });
+
+    window.addEventListener('pagehide', function () {
+        if (shownAt !== null) {
+            visibleMs += Date.now() - shownAt;
+            shownAt = null;
+        }
+        send();
+    });
+
+    measure();
+})();
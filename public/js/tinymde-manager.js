@@ -4,6 +4,7 @@
  * - Modo tela cheia
  * - Salvamento automático (apenas rascunhos)
  * - Indicador visual de alterações
+ * - Upload de imagens ao colar ou arrastar
  */
 
 class TinyMDEManager {
@@ -13,6 +14,7 @@ class TinyMDEManager {
         this.isDraftField = options.isDraftField || 'draft';
         this.autoSaveUrl = options.autoSaveUrl || null;
         this.autoSaveInterval = options.autoSaveInterval || 30000; // 30 segundos
+        this.uploadUrl = options.uploadUrl || null;
         
         this.editor = null;
         this.autoSaveTimer = null;
@@ -68,10 +70,78 @@ class TinyMDEManager {
             this.markAsChanged();
         });
         
+        // Colar ou arrastar imagens envia para a biblioteca de mídia
+        if (this.uploadUrl) {
+            textarea.addEventListener('paste', (e) => {
+                const files = this.imageFiles(e.clipboardData);
+                if (files.length) {
+                    e.preventDefault();
+                    files.forEach(file => this.uploadImage(file, textarea));
+                }
+            });
+            
+            textarea.addEventListener('dragover', (e) => {
+                e.preventDefault();
+            });
+            
+            textarea.addEventListener('drop', (e) => {
+                const files = this.imageFiles(e.dataTransfer);
+                if (files.length) {
+                    e.preventDefault();
+                    files.forEach(file => this.uploadImage(file, textarea));
+                }
+            });
+        }
+        
         // Salvar conteúdo original
         this.originalContent = textarea.value;
     }
     
+    imageFiles(dataTransfer) {
+        if (!dataTransfer || !dataTransfer.files) return [];
+        return Array.from(dataTransfer.files).filter(file => file.type.startsWith('image/'));
+    }
+    
+    async uploadImage(file, textarea) {
+        const data = new FormData();
+        data.append('file', file);
+        
+        this.showStatus('Enviando imagem...', '#ffc107');
+        
+        try {
+            const response = await fetch(this.uploadUrl, {
+                method: 'POST',
+                body: data
+            });
+            const body = await response.json().catch(() => ({}));
+            
+            if (!response.ok) {
+                this.showStatus(body.error || 'Erro ao enviar imagem', '#dc3545');
+                return;
+            }
+            
+            this.insertAtCursor(textarea, body.markdown);
+            this.showStatus('Imagem enviada', '#28a745');
+        } catch (error) {
+            this.showStatus('Erro de conexão ao enviar imagem', '#dc3545');
+        }
+    }
+    
+    insertAtCursor(textarea, text) {
+        const start = textarea.selectionStart;
+        const end = textarea.selectionEnd;
+        const before = textarea.value.substring(0, start);
+        const after = textarea.value.substring(end);
+        
+        // Imagens ficam em um parágrafo próprio
+        const prefix = before && !before.endsWith('\n') ? '\n\n' : '';
+        const suffix = after && !after.startsWith('\n') ? '\n\n' : '';
+        
+        textarea.value = before + prefix + text + suffix + after;
+        textarea.selectionStart = textarea.selectionEnd = start + prefix.length + text.length;
+        textarea.dispatchEvent(new Event('input'));
+    }
+    
     addEventListeners() {
         // Escapar do modo fullscreen com ESC
         document.addEventListener('keydown', (e) => {
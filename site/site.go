@@ -2,6 +2,7 @@ package site
 
 import (
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"gorm.io/gorm"
 
 	"harmonista/analytics"
+	"harmonista/cache"
 	"harmonista/models"
 )
 
@@ -49,6 +51,8 @@ func (s *SiteModule) listReader(c *gin.Context) {
 		domain = "http://localhost/"
 	}
 
+	cache.Depends(c, cache.ReaderDep)
+
 	// Buscar todos os posts de blogs que tem isListReader = true
 	var posts []struct {
 		models.Post
@@ -107,15 +111,24 @@ func (s *SiteModule) listReaderByTag(c *gin.Context) {
 		domain = "http://localhost/"
 	}
 
-	// Buscar a tag pelo nome
-	var tag models.Tag
-	if err := s.db.Where("title = ?", tagName).First(&tag).Error; err != nil {
+	// Cada blog tem suas tags; o /leia junta as de mesmo nome normalizado
+	var matching []models.Tag
+	s.db.Where("name = ?", models.NormalizeTagName(tagName)).Order("id").Find(&matching)
+	if len(matching) == 0 {
 		c.HTML(http.StatusNotFound, "site_list_reader_by_tag.html", gin.H{
 			"error":  "Tag não encontrada",
 			"domain": domain,
 		})
 		return
 	}
+	tag := matching[0]
+
+	tagIDs := make([]uint, len(matching))
+	cache.Depends(c, cache.ReaderDep)
+	for i, t := range matching {
+		tagIDs[i] = t.ID
+		cache.Depends(c, cache.TagDep(int(t.ID)))
+	}
 
 	// Buscar todos os posts de blogs que tem isListReader = true com essa tag
 	var posts []struct {
@@ -129,7 +142,7 @@ func (s *SiteModule) listReaderByTag(c *gin.Context) {
 	err := s.db.Table("posts").
 		Joins("INNER JOIN blogs ON posts.blog_id = blogs.id").
 		Joins("INNER JOIN post_tags ON posts.id = post_tags.post_id").
-		Where("blogs.is_list_reader = ? AND posts.draft = ? AND post_tags.tag_id = ?", true, false, tag.ID).
+		Where("blogs.is_list_reader = ? AND posts.draft = ? AND post_tags.tag_id IN ?", true, false, tagIDs).
 		Order("posts.created_at DESC").
 		Find(&rawPosts).Error
 
@@ -245,15 +258,16 @@ func (s *SiteModule) sitemap(c *gin.Context) {
 	// Get all unique tags for tag pages
 	var tags []string
 	s.db.Model(&models.PostTag{}).
+		Joins("JOIN tags ON post_tags.tag_id = tags.id").
 		Joins("JOIN posts ON post_tags.post_id = posts.id").
 		Joins("JOIN blogs ON posts.blog_id = blogs.id").
-		Where("blogs.is_list_reader = ?", true).
-		Distinct("post_tags.tag_name").
-		Pluck("post_tags.tag_name", &tags)
+		Where("blogs.is_list_reader = ? AND posts.draft = ? AND posts.deleted_at IS NULL", true, false).
+		Distinct("tags.name").
+		Pluck("tags.name", &tags)
 
 	for _, tag := range tags {
 		sitemap.WriteString("  <url>\n")
-		sitemap.WriteString("    <loc>" + domain + "/leia/" + tag + "</loc>\n")
+		sitemap.WriteString("    <loc>" + domain + "/leia/" + url.PathEscape(tag) + "</loc>\n")
 		sitemap.WriteString("    <changefreq>weekly</changefreq>\n")
 		sitemap.WriteString("    <priority>0.4</priority>\n")
 		sitemap.WriteString("  </url>\n")